@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"gom2k/internal/bridge"
+	"gom2k/internal/config"
+	"gom2k/internal/kafka"
+	"gom2k/internal/mqtt"
+	"gom2k/pkg/types"
+)
+
+// runDLQCommand implements "gom2k dlq": tools working on the dead letter topics
+func runDLQCommand(args []string) {
+	if len(args) == 0 {
+		dlqUsage()
+	}
+
+	switch args[0] {
+	case "list":
+		runDLQList(args[1:])
+	case "stats":
+		runDLQStats(args[1:])
+	case "replay":
+		runDLQReplay(args[1:])
+	default:
+		dlqUsage()
+	}
+}
+
+// dlqUsage lists the dlq subcommands and exits
+func dlqUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: gom2k dlq <command> [flags]")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  list     list failed messages")
+	fmt.Fprintln(os.Stderr, "  stats    count failed messages by reason, direction, topic and time")
+	fmt.Fprintln(os.Stderr, "  replay   send failed messages through the bridge again")
+	os.Exit(2)
+}
+
+// deadLetterEntry is a decoded dead letter record with its position in the Kafka dead
+// letter topic. Records received from the MQTT dead letter topic have no position.
+type deadLetterEntry struct {
+	record     *kafka.TopicRecord
+	deadLetter *types.DeadLetterRecord
+	failedMsg  *types.FailedMessage
+}
+
+// position returns the partition and offset of the entry in the dead letter topic
+func (e deadLetterEntry) position() string {
+	if e.record == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d", e.record.Partition, e.record.Offset)
+}
+
+// filterFlags are the flags selecting dead-lettered messages
+type filterFlags struct {
+	direction, topic, since, until, reason *string
+}
+
+// addFilterFlags defines the filter flags, verb is what the command does with the
+// selected messages
+func addFilterFlags(flags *flag.FlagSet, verb string) *filterFlags {
+	return &filterFlags{
+		direction: flags.String("direction", "", "only "+verb+" mqtt-to-kafka or kafka-to-mqtt messages"),
+		topic:     flags.String("topic", "", "only "+verb+" messages whose original or target topic matches this regular expression"),
+		since:     flags.String("since", "", "only "+verb+" messages dead-lettered at or after this time (RFC 3339, or a duration such as 24h ago)"),
+		until:     flags.String("until", "", "only "+verb+" messages dead-lettered at or before this time (RFC 3339, or a duration ago)"),
+		reason:    flags.String("reason", "", "only "+verb+" messages whose failure reason contains this text"),
+	}
+}
+
+// parse builds the filter of the flags
+func (f *filterFlags) parse(now time.Time) (*bridge.ReplayFilter, error) {
+	return parseReplayFilter(*f.direction, *f.topic, *f.since, *f.until, *f.reason, now)
+}
+
+// runDLQReplay implements "gom2k dlq replay": failed messages read from the Kafka dead
+// letter topic are converted and produced or published again with the current configuration.
+// Dead letter records aren't removed, so filters keep a replay from being repeated.
+func runDLQReplay(args []string) {
+	flags := flag.NewFlagSet("dlq replay", flag.ExitOnError)
+	configPath := flags.String("config", config.GetConfigPath(), "configuration file of the bridge")
+	dlqTopic := flags.String("dlq-topic", "", "Kafka dead letter topic (default: bridge.dead_letter.kafka_topic)")
+	filterOptions := addFilterFlags(flags, "replay")
+	limit := flags.Int("limit", 0, "replay at most this many messages (0 is unlimited)")
+	dryRun := flags.Bool("dry-run", false, "convert the selected messages and report their targets without sending them")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gom2k dlq replay [-config file] [filters] [-dry-run]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	bridgeConfig, err := config.LoadForTesting(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	topic := *dlqTopic
+	if topic == "" {
+		topic = bridgeConfig.Bridge.DeadLetter.KafkaTopic
+	}
+	if topic == "" {
+		log.Fatalf("No dead letter topic: set bridge.dead_letter.kafka_topic or -dlq-topic")
+	}
+
+	filter, err := filterOptions.parse(time.Now())
+	if err != nil {
+		log.Fatalf("Invalid filter: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	collector := &deadLetterCollector{filter: filter, limit: *limit}
+	if err := readDeadLetters(ctx, &bridgeConfig.Kafka, topic, collector); err != nil {
+		log.Fatalf("Failed to read dead letter topic %s: %v", topic, err)
+	}
+	entries := collector.entries
+
+	var producer *kafka.Producer
+	var mqttClient *mqtt.Client
+	if !*dryRun {
+		producer, mqttClient, err = connectReplayClients(bridgeConfig, entries)
+		if err != nil {
+			log.Fatalf("Failed to connect: %v", err)
+		}
+		if producer != nil {
+			defer producer.Close()
+		}
+		if mqttClient != nil {
+			defer mqttClient.Disconnect()
+		}
+	}
+
+	replayer, err := bridge.NewReplayer(&bridgeConfig.Bridge, producer, mqttClient)
+	if err != nil {
+		log.Fatalf("Failed to create replayer: %v", err)
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "PARTITION/OFFSET\tMESSAGE ID\tDIRECTION\tFROM\tTO\tRESULT")
+	replayed, failed := 0, 0
+	for _, entry := range entries {
+		var target, result string
+		if *dryRun {
+			target, err = replayer.Plan(entry.failedMsg)
+			result = "would replay"
+		} else {
+			target, err = replayer.Replay(ctx, entry.failedMsg)
+			result = "replayed"
+		}
+		if err != nil {
+			failed++
+			result = "failed: " + err.Error()
+		} else {
+			replayed++
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.position(),
+			valueOrDash(entry.failedMsg.MessageID), entry.failedMsg.Direction, entry.failedMsg.OriginalTopic, valueOrDash(target), result)
+	}
+	out.Flush()
+
+	verb := "replayed"
+	if *dryRun {
+		verb = "replayable (dry run)"
+	}
+	fmt.Printf("\n%d records read, %d undecodable, %d selected, %d %s, %d failed\n",
+		collector.read, collector.undecodable, len(entries), replayed, verb, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// parseReplayFilter builds a replay filter from the command line flags
+func parseReplayFilter(direction, topicPattern, since, until, reason string, now time.Time) (*bridge.ReplayFilter, error) {
+	filter := &bridge.ReplayFilter{Direction: direction, Reason: reason}
+
+	switch direction {
+	case "", "mqtt-to-kafka", "kafka-to-mqtt":
+	default:
+		return nil, fmt.Errorf("unknown direction %q (expected mqtt-to-kafka or kafka-to-mqtt)", direction)
+	}
+
+	if topicPattern != "" {
+		pattern, err := regexp.Compile("^(?:" + topicPattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid topic pattern: %w", err)
+		}
+		filter.Topic = pattern
+	}
+
+	var err error
+	if filter.Since, err = parseTimeFlag(since, now); err != nil {
+		return nil, fmt.Errorf("invalid -since: %w", err)
+	}
+	if filter.Until, err = parseTimeFlag(until, now); err != nil {
+		return nil, fmt.Errorf("invalid -until: %w", err)
+	}
+	return filter, nil
+}
+
+// parseTimeFlag parses an RFC 3339 time or a duration before now. Empty values are zero.
+func parseTimeFlag(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	ago, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a duration", value)
+	}
+	return now.Add(-ago), nil
+}
+
+// deadLetterCollector keeps the decoded dead letter records passing the filter, up to the
+// limit, and counts the records read and those that couldn't be decoded
+type deadLetterCollector struct {
+	filter      *bridge.ReplayFilter
+	limit       int // 0 is unlimited
+	entries     []deadLetterEntry
+	read        int
+	undecodable int
+}
+
+// add collects a decoded dead letter record. Records that failed to decode are skipped
+// with a log entry.
+func (c *deadLetterCollector) add(record *kafka.TopicRecord, deadLetter *types.DeadLetterRecord, err error) {
+	c.read++
+	entry := deadLetterEntry{record: record, deadLetter: deadLetter}
+	if err == nil {
+		entry.failedMsg, err = deadLetter.FailedMessage()
+	}
+	if err != nil {
+		c.undecodable++
+		log.Printf("Skipping dead letter record %s: %v", entry.position(), err)
+		return
+	}
+	if c.filter.Matches(entry.failedMsg) && (c.limit <= 0 || len(c.entries) < c.limit) {
+		c.entries = append(c.entries, entry)
+	}
+}
+
+// readDeadLetters reads the Kafka dead letter topic from the beginning to its current end
+func readDeadLetters(ctx context.Context, kafkaConfig *types.KafkaConfig, topic string, collector *deadLetterCollector) error {
+	return kafka.ReadTopic(ctx, kafkaConfig, topic, func(record *kafka.TopicRecord) error {
+		deadLetter, err := bridge.DecodeDeadLetterRecord(record.Message)
+		collector.add(record, deadLetter, err)
+		return nil
+	})
+}
+
+// connectReplayClients connects the Kafka producer and MQTT client needed for the directions
+// of the entries. They get their own client and transactional IDs so a running bridge
+// isn't disconnected or fenced.
+func connectReplayClients(bridgeConfig *types.Config, entries []deadLetterEntry) (*kafka.Producer, *mqtt.Client, error) {
+	toKafka, toMQTT := false, false
+	for _, entry := range entries {
+		switch entry.failedMsg.Direction {
+		case "mqtt-to-kafka":
+			toKafka = true
+		case "kafka-to-mqtt":
+			toMQTT = true
+		}
+	}
+
+	var producer *kafka.Producer
+	if toKafka {
+		producer = kafka.NewProducer(kafka.ProducerConfig(&bridgeConfig.Kafka, kafka.ProducerRoleReplay), &bridgeConfig.Bridge)
+		if err := producer.Connect(); err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to Kafka: %w", err)
+		}
+	}
+
+	var mqttClient *mqtt.Client
+	if toMQTT {
+		mqttConfig := bridgeConfig.MQTT
+		mqttConfig.Client.ClientID += "-dlq-replay"
+		mqttClient = mqtt.NewClient(&mqttConfig)
+		if err := mqttClient.Connect(); err != nil {
+			if producer != nil {
+				producer.Close()
+			}
+			return nil, nil, fmt.Errorf("failed to connect to MQTT: %w", err)
+		}
+	}
+
+	return producer, mqttClient, nil
+}
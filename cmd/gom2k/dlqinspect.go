@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"gom2k/internal/bridge"
+	"gom2k/internal/config"
+	"gom2k/internal/mqtt"
+	"gom2k/pkg/types"
+)
+
+// Dead letter sources of the list and stats commands
+const (
+	sourceKafka = "kafka" // Read the Kafka dead letter topic from the beginning
+	sourceMQTT  = "mqtt"  // Listen on the MQTT dead letter topic for a while
+)
+
+// sourceFlags are the flags naming the dead letter topic to inspect
+type sourceFlags struct {
+	config *string
+	source *string
+	topic  *string
+	listen *time.Duration
+}
+
+// addSourceFlags defines the source flags
+func addSourceFlags(flags *flag.FlagSet) *sourceFlags {
+	return &sourceFlags{
+		config: flags.String("config", config.GetConfigPath(), "configuration file of the bridge"),
+		source: flags.String("source", sourceKafka, "dead letter topic to read: kafka, or mqtt to listen for new dead letters"),
+		topic:  flags.String("dlq-topic", "", "dead letter topic (default: bridge.dead_letter.kafka_topic or mqtt_topic)"),
+		listen: flags.Duration("listen", 30*time.Second, "how long to listen on the MQTT dead letter topic"),
+	}
+}
+
+// collectDeadLetters reads the dead letters selected by the flags and returns the topic
+// they were read from. Errors end the command.
+func collectDeadLetters(sourceOptions *sourceFlags, filterOptions *filterFlags, limit int) (string, *deadLetterCollector) {
+	bridgeConfig, err := config.LoadForTesting(*sourceOptions.config)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	filter, err := filterOptions.parse(time.Now())
+	if err != nil {
+		log.Fatalf("Invalid filter: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	collector := &deadLetterCollector{filter: filter, limit: limit}
+	topic := *sourceOptions.topic
+	switch *sourceOptions.source {
+	case sourceKafka:
+		if topic == "" {
+			topic = bridgeConfig.Bridge.DeadLetter.KafkaTopic
+		}
+		if topic == "" {
+			log.Fatalf("No dead letter topic: set bridge.dead_letter.kafka_topic or -dlq-topic")
+		}
+		if err := readDeadLetters(ctx, &bridgeConfig.Kafka, topic, collector); err != nil {
+			log.Fatalf("Failed to read dead letter topic %s: %v", topic, err)
+		}
+	case sourceMQTT:
+		if topic == "" {
+			topic = bridgeConfig.Bridge.DeadLetter.MQTTTopic
+		}
+		if topic == "" {
+			log.Fatalf("No dead letter topic: set bridge.dead_letter.mqtt_topic or -dlq-topic")
+		}
+		if err := listenDeadLetters(ctx, bridgeConfig, topic, *sourceOptions.listen, collector); err != nil {
+			log.Fatalf("Failed to listen on dead letter topic %s: %v", topic, err)
+		}
+	default:
+		log.Fatalf("Unknown source %q (expected kafka or mqtt)", *sourceOptions.source)
+	}
+	return topic, collector
+}
+
+// listenDeadLetters subscribes to the MQTT dead letter topic and collects the dead letters
+// published until the listen duration has passed. MQTT dead letters aren't retained, so
+// only messages dead-lettered while listening are seen.
+func listenDeadLetters(ctx context.Context, bridgeConfig *types.Config, topic string, listen time.Duration, collector *deadLetterCollector) error {
+	ctx, cancel := context.WithTimeout(ctx, listen)
+	defer cancel()
+
+	mqttConfig := bridgeConfig.MQTT
+	mqttConfig.Client.ClientID += "-dlq-inspect"
+	mqttConfig.Client.QoS = 1
+	mqttConfig.Topics.Subscribe = []string{topic}
+	mqttConfig.Topics.RetainOnly = false
+
+	payloads := make(chan []byte, 100)
+	client := mqtt.NewClient(&mqttConfig)
+	client.SetMessageHandler(func(msg *types.MQTTMessage) {
+		select {
+		case payloads <- msg.Payload:
+		case <-ctx.Done():
+		}
+	})
+	if err := client.Connect(); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+	if err := client.Subscribe(); err != nil {
+		return err
+	}
+
+	log.Printf("Listening on %s for %v", topic, listen)
+	for {
+		select {
+		case payload := <-payloads:
+			// MQTT dead letters are published uncompressed
+			deadLetter, err := bridge.DecodeDeadLetterPayload(payload, "")
+			collector.add(nil, deadLetter, err)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// checkFormat ends the command for output formats other than table and json
+func checkFormat(format string) {
+	if format != "table" && format != "json" {
+		log.Fatalf("Unknown format %q (expected table or json)", format)
+	}
+}
+
+// listedDeadLetter is the JSON form of a listed dead letter record
+type listedDeadLetter struct {
+	Partition *int                    `json:"dlq_partition,omitempty"`
+	Offset    *int64                  `json:"dlq_offset,omitempty"`
+	Record    *types.DeadLetterRecord `json:"record"`
+}
+
+// runDLQList implements "gom2k dlq list": the failed messages in a dead letter topic
+// with their failure details, one per line or as a JSON array of dead letter records
+func runDLQList(args []string) {
+	flags := flag.NewFlagSet("dlq list", flag.ExitOnError)
+	sourceOptions := addSourceFlags(flags)
+	filterOptions := addFilterFlags(flags, "list")
+	limit := flags.Int("limit", 0, "list at most this many messages (0 is unlimited)")
+	format := flags.String("format", "table", "output format: table or json")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gom2k dlq list [-config file] [-source kafka|mqtt] [filters] [-format table|json]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	checkFormat(*format)
+
+	topic, collector := collectDeadLetters(sourceOptions, filterOptions, *limit)
+
+	if *format == "json" {
+		listed := make([]listedDeadLetter, 0, len(collector.entries))
+		for _, entry := range collector.entries {
+			item := listedDeadLetter{Record: entry.deadLetter}
+			if entry.record != nil {
+				item.Partition, item.Offset = &entry.record.Partition, &entry.record.Offset
+			}
+			listed = append(listed, item)
+		}
+		writeJSON(listed)
+		log.Printf("%s: %d records read, %d undecodable, %d listed", topic, collector.read, collector.undecodable, len(listed))
+		return
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "PARTITION/OFFSET\tLAST ATTEMPT\tMESSAGE ID\tDIRECTION\tTOPIC\tCLASS\tATTEMPTS\tREASON")
+	for _, entry := range collector.entries {
+		deadLetter := entry.deadLetter
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n", entry.position(), formatTime(deadLetter.LastAttempt),
+			valueOrDash(deadLetter.MessageID), deadLetter.Direction, deadLetter.OriginalTopic,
+			valueOrDash(deadLetter.ErrorClass), deadLetter.AttemptCount, deadLetter.FailureReason)
+	}
+	out.Flush()
+
+	fmt.Printf("\n%s: %d records read, %d undecodable, %d listed\n", topic, collector.read, collector.undecodable, len(collector.entries))
+}
+
+// deadLetterStatsOutput is the JSON form of the dead letter statistics
+type deadLetterStatsOutput struct {
+	Topic       string                   `json:"dlq_topic"`
+	Read        int                      `json:"records_read"`
+	Undecodable int                      `json:"undecodable"`
+	Total       int                      `json:"total"`
+	GroupBy     []string                 `json:"group_by"`
+	Bucket      string                   `json:"bucket,omitempty"`
+	Groups      []bridge.DeadLetterGroup `json:"groups"`
+}
+
+// runDLQStats implements "gom2k dlq stats": the failed messages in a dead letter topic
+// counted by failure reason, error class, direction, original topic and time bucket
+func runDLQStats(args []string) {
+	flags := flag.NewFlagSet("dlq stats", flag.ExitOnError)
+	sourceOptions := addSourceFlags(flags)
+	filterOptions := addFilterFlags(flags, "count")
+	groupBy := flags.String("by", "direction,topic,reason", "comma-separated dimensions to group by: reason, class, direction, topic and time")
+	bucket := flags.Duration("bucket", time.Hour, "size of the time buckets when grouping by time")
+	format := flags.String("format", "table", "output format: table or json")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gom2k dlq stats [-config file] [-source kafka|mqtt] [filters] [-by dimensions] [-bucket 1h] [-format table|json]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	checkFormat(*format)
+
+	var dimensions []string
+	for _, dimension := range strings.Split(*groupBy, ",") {
+		if dimension = strings.TrimSpace(dimension); dimension != "" {
+			dimensions = append(dimensions, dimension)
+		}
+	}
+	stats, err := bridge.NewDeadLetterStats(dimensions, *bucket)
+	if err != nil {
+		log.Fatalf("Invalid grouping: %v", err)
+	}
+
+	topic, collector := collectDeadLetters(sourceOptions, filterOptions, 0)
+	for _, entry := range collector.entries {
+		stats.Add(entry.deadLetter)
+	}
+
+	if *format == "json" {
+		output := deadLetterStatsOutput{
+			Topic:       topic,
+			Read:        collector.read,
+			Undecodable: collector.undecodable,
+			Total:       stats.Total(),
+			GroupBy:     dimensions,
+			Groups:      stats.Groups(),
+		}
+		for _, dimension := range dimensions {
+			if dimension == bridge.GroupByTime {
+				output.Bucket = bucket.String()
+			}
+		}
+		writeJSON(output)
+		return
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, dimension := range dimensions {
+		fmt.Fprintf(out, "%s\t", strings.ToUpper(dimension))
+	}
+	fmt.Fprintln(out, "COUNT\tFIRST\tLAST")
+	for _, group := range stats.Groups() {
+		for _, dimension := range dimensions {
+			fmt.Fprintf(out, "%s\t", valueOrDash(groupValue(group, dimension)))
+		}
+		fmt.Fprintf(out, "%d\t%s\t%s\n", group.Count, formatTime(group.First), formatTime(group.Last))
+	}
+	out.Flush()
+
+	fmt.Printf("\n%s: %d records read, %d undecodable, %d counted in %d groups\n",
+		topic, collector.read, collector.undecodable, stats.Total(), len(stats.Groups()))
+}
+
+// groupValue returns the value of a dimension of a group
+func groupValue(group bridge.DeadLetterGroup, dimension string) string {
+	switch dimension {
+	case bridge.GroupByReason:
+		return group.Reason
+	case bridge.GroupByClass:
+		return group.Class
+	case bridge.GroupByDirection:
+		return group.Direction
+	case bridge.GroupByTopic:
+		return group.Topic
+	case bridge.GroupByTime:
+		if group.Bucket != nil {
+			return formatTime(*group.Bucket)
+		}
+	}
+	return ""
+}
+
+// formatTime formats a time for table cells, zero times as a dash
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// writeJSON prints a value as indented JSON
+func writeJSON(value interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		log.Fatalf("Failed to write JSON: %v", err)
+	}
+}
@@ -17,6 +17,16 @@ import (
 )
 
 func main() {
+	// Subcommands print machine-readable output, so they run before the banner
+	if len(os.Args) > 1 && os.Args[1] == "map" {
+		runMapCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "dlq" {
+		runDLQCommand(os.Args[2:])
+		return
+	}
+	
 	fmt.Println("GOM2K MQTT-Kafka Bridge")
 	fmt.Println("Version: 0.1.0")
 	
@@ -162,7 +172,7 @@ func testKafkaConnectivity() {
 	log.Printf("Security protocol: %s", kafkaConfig.Kafka.Security.Protocol)
 	
 	// Create Kafka producer  
-	producer := kafka.NewProducer(&kafkaConfig.Kafka, &kafkaConfig.Bridge)
+	producer := kafka.NewProducer(kafka.ProducerConfig(&kafkaConfig.Kafka, kafka.ProducerRoleTest), &kafkaConfig.Bridge)
 	if err := producer.Connect(); err != nil {
 		log.Fatalf("Failed to connect to Kafka: %v", err)
 	}
@@ -177,7 +187,7 @@ func testKafkaConnectivity() {
 	
 	// Recreate producer with test config to avoid modifying original
 	producer.Close()
-	producer = kafka.NewProducer(&kafkaConfig.Kafka, &testBridgeConfig)
+	producer = kafka.NewProducer(kafka.ProducerConfig(&kafkaConfig.Kafka, kafka.ProducerRoleTest), &testBridgeConfig)
 	if err := producer.Connect(); err != nil {
 		log.Fatalf("Failed to reconnect Kafka producer with test config: %v", err)
 	}
@@ -221,7 +231,7 @@ func testTopicCreation() {
 	testBridgeConfig.Kafka.DefaultPartitions = 3
 	testBridgeConfig.Kafka.ReplicationFactor = 1
 	
-	producer := kafka.NewProducer(&topicConfig.Kafka, &testBridgeConfig)
+	producer := kafka.NewProducer(kafka.ProducerConfig(&topicConfig.Kafka, kafka.ProducerRoleTest), &testBridgeConfig)
 	if err := producer.Connect(); err != nil {
 		log.Fatalf("Failed to connect to Kafka: %v", err)
 	}
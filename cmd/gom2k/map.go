@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"gom2k/internal/bridge"
+	"gom2k/internal/config"
+)
+
+// runMapCommand implements "gom2k map": a dry run of the MQTT→Kafka topic mapping.
+// Topics are taken from the arguments, from a captured topic list (-f) or from stdin,
+// and the resulting Kafka topic, partition key and the rule deciding the route are printed.
+// Ignore lists, the loop namespace, Sparkplug keying, the envelope and the topic guard are
+// applied as the bridge applies them.
+func runMapCommand(args []string) {
+	flags := flag.NewFlagSet("map", flag.ExitOnError)
+	configPath := flags.String("config", config.GetConfigPath(), "configuration file of the bridge")
+	topicFile := flags.String("f", "", "file with one MQTT topic per line (e.g. a captured topic list)")
+	summaryOnly := flags.Bool("summary", false, "only print the summary, not every mapped topic")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gom2k map [-config file] [-f topics.txt] [-summary] [mqtt-topic ...]")
+		fmt.Fprintln(flags.Output(), "Reads topics from stdin when no topics or file are given, or when a topic is \"-\".")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	bridgeConfig, err := config.LoadForTesting(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	topics, err := collectTopics(flags.Args(), *topicFile)
+	if err != nil {
+		log.Fatalf("Failed to read MQTT topics: %v", err)
+	}
+	if len(topics) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	router, err := bridge.NewMQTTRouter(&bridgeConfig.Bridge)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	kafkaTopics := make(map[string]int)
+	sanitizedCount, truncatedCount, skippedCount := 0, 0, 0
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !*summaryOnly {
+		fmt.Fprintln(out, "MQTT TOPIC\tKAFKA TOPIC\tPARTITION KEY\tRULE")
+	}
+
+	for _, topic := range topics {
+		route, err := router.Route(topic)
+		if err != nil {
+			log.Fatalf("Failed to map %s: %v", topic, err)
+		}
+		if route.KafkaTopic == "" {
+			skippedCount++
+		} else {
+			kafkaTopics[route.KafkaTopic]++
+		}
+		if route.Mapping.Sanitized {
+			sanitizedCount++
+		}
+		if route.Mapping.Truncated {
+			truncatedCount++
+		}
+
+		if !*summaryOnly {
+			fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", topic, valueOrDash(route.KafkaTopic), valueOrDash(route.Key), route.Rule)
+		}
+	}
+	out.Flush()
+
+	if !*summaryOnly {
+		fmt.Println()
+	}
+	fmt.Printf("%d MQTT topics → %d distinct Kafka topics (%d sanitized, %d truncated, %d not forwarded)\n",
+		len(topics), len(kafkaTopics), sanitizedCount, truncatedCount, skippedCount)
+}
+
+// collectTopics gathers MQTT topics from arguments, a topic list file and stdin
+func collectTopics(args []string, topicFile string) ([]string, error) {
+	var topics []string
+	readStdin := len(args) == 0 && topicFile == ""
+
+	for _, arg := range args {
+		if arg == "-" {
+			readStdin = true
+			continue
+		}
+		topics = append(topics, arg)
+	}
+
+	if topicFile != "" {
+		file, err := os.Open(topicFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		fileTopics, err := readTopicLines(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", topicFile, err)
+		}
+		topics = append(topics, fileTopics...)
+	}
+
+	if readStdin {
+		stdinTopics, err := readTopicLines(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+		topics = append(topics, stdinTopics...)
+	}
+
+	return topics, nil
+}
+
+// readTopicLines reads one topic per line, skipping empty lines.
+// Only line endings are trimmed because MQTT topic levels may contain spaces.
+func readTopicLines(r io.Reader) ([]string, error) {
+	var topics []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		topic := strings.TrimRight(scanner.Text(), "\r")
+		if topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	return topics, scanner.Err()
+}
+
+// valueOrDash returns the value, or a dash for empty table cells
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -4,9 +4,11 @@ go 1.21
 
 require (
 	github.com/eclipse/paho.mqtt.golang v1.5.0
+	github.com/mitchellh/mapstructure v1.5.0
 	github.com/segmentio/kafka-go v0.4.48
 	github.com/spf13/viper v1.18.2
 	golang.org/x/crypto v0.25.0
+	software.sslmate.com/src/go-pkcs12 v0.5.0
 )
 
 require (
@@ -15,7 +17,6 @@ require (
 	github.com/hashicorp/hcl v1.0.0 // indirect
 	github.com/klauspost/compress v1.17.0 // indirect
 	github.com/magiconair/properties v1.8.7 // indirect
-	github.com/mitchellh/mapstructure v1.5.0 // indirect
 	github.com/pelletier/go-toml/v2 v2.1.0 // indirect
 	github.com/pierrec/lz4/v4 v4.1.15 // indirect
 	github.com/sagikazarmark/locafero v0.4.0 // indirect
@@ -33,5 +34,4 @@ require (
 	golang.org/x/text v0.16.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
-	software.sslmate.com/src/go-pkcs12 v0.5.0 // indirect
 )
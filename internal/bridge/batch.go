@@ -0,0 +1,106 @@
+package bridge
+
+import (
+	"sync"
+	"time"
+
+	"gom2k/pkg/types"
+)
+
+// BatchedRecord is an MQTT message converted for Kafka, waiting to be written in a batch
+type BatchedRecord struct {
+	MQTTMessage  *types.MQTTMessage
+	KafkaMessage *types.KafkaMessage
+}
+
+// RecordBatcher collects converted messages and passes them to a flush function in batches
+// of up to size records, waiting at most the linger time for a batch to fill. Batches are
+// flushed one at a time in the order the records were added. The queue holds one batch,
+// so adding blocks while it is full. This type is thread-safe.
+type RecordBatcher struct {
+	size   int
+	linger time.Duration
+	flush  func([]*BatchedRecord)
+	queue  chan *BatchedRecord
+	done   chan struct{}
+	mutex  sync.RWMutex
+	closed bool
+}
+
+// NewRecordBatcher creates a batcher and starts its flush loop. Sizes below 1 flush every
+// record on its own.
+func NewRecordBatcher(size int, linger time.Duration, flush func([]*BatchedRecord)) *RecordBatcher {
+	if size < 1 {
+		size = 1
+	}
+	b := &RecordBatcher{
+		size:   size,
+		linger: linger,
+		flush:  flush,
+		queue:  make(chan *BatchedRecord, size),
+		done:   make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Add queues a record for the next batch. Records added after Close are flushed on their own.
+func (b *RecordBatcher) Add(record *BatchedRecord) {
+	b.mutex.RLock()
+	if b.closed {
+		b.mutex.RUnlock()
+		b.flush([]*BatchedRecord{record})
+		return
+	}
+	b.queue <- record
+	b.mutex.RUnlock()
+}
+
+// Close flushes the queued records and stops the flush loop
+func (b *RecordBatcher) Close() {
+	b.mutex.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.mutex.Unlock()
+	<-b.done
+}
+
+// run collects records into batches until the queue is closed
+func (b *RecordBatcher) run() {
+	defer close(b.done)
+
+	var batch []*BatchedRecord
+	var timer *time.Timer
+	var linger <-chan time.Time
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		timer, linger = nil, nil
+		b.flush(batch)
+		batch = nil
+	}
+
+	for {
+		select {
+		case record, ok := <-b.queue:
+			if !ok {
+				if len(batch) > 0 {
+					flush()
+				}
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) >= b.size {
+				flush()
+			} else if timer == nil {
+				timer = time.NewTimer(b.linger)
+				linger = timer.C
+			}
+		case <-linger:
+			flush()
+		}
+	}
+}
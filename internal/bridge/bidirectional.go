@@ -28,11 +28,19 @@ type BidirectionalBridge struct {
 // - If KafkaToMQTT is enabled, messages from Kafka topics will be forwarded to MQTT
 // At least one direction must be enabled for the bridge to function.
 func NewBidirectionalBridge(config *types.Config) *BidirectionalBridge {
-	return &BidirectionalBridge{
+	b := &BidirectionalBridge{
 		mqttToKafka: NewMQTTToKafkaBridge(config),
 		kafkaToMQTT: NewKafkaToMQTTBridge(config),
 		config:      config,
 	}
+
+	// With both directions in this process, they share message fingerprints to detect loops
+	if config.Bridge.Features.MQTTToKafka && config.Bridge.Features.KafkaToMQTT {
+		loops := NewLoopDetector(&config.Bridge.LoopPrevention, true)
+		b.mqttToKafka.loops = loops
+		b.kafkaToMQTT.loops = loops
+	}
+	return b
 }
 
 // Start initializes and starts the bidirectional bridge components based on configuration.
@@ -120,6 +128,8 @@ func (b *BidirectionalBridge) GetStatus() BridgeStatus {
 		MQTTToKafkaEnabled: b.config.Bridge.Features.MQTTToKafka,
 		KafkaToMQTTEnabled: b.config.Bridge.Features.KafkaToMQTT,
 		IsRunning:          true, // TODO: Add actual health checks
+		MQTTToKafkaSkipped: b.mqttToKafka.GetSkipCounts(),
+		KafkaToMQTTSkipped: b.kafkaToMQTT.GetSkipCounts(),
 	}
 }
 
@@ -130,4 +140,7 @@ type BridgeStatus struct {
 	MQTTToKafkaEnabled bool `json:"mqtt_to_kafka_enabled"` // Whether MQTT→Kafka flow is enabled
 	KafkaToMQTTEnabled bool `json:"kafka_to_mqtt_enabled"` // Whether Kafka→MQTT flow is enabled
 	IsRunning          bool `json:"is_running"`            // Overall bridge running status
+
+	MQTTToKafkaSkipped map[string]uint64 `json:"mqtt_to_kafka_skipped"` // Messages skipped on purpose by reason
+	KafkaToMQTTSkipped map[string]uint64 `json:"kafka_to_mqtt_skipped"` // Records skipped on purpose by reason
 }
\ No newline at end of file
@@ -4,26 +4,37 @@ package bridge
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"gom2k/internal/kafka"
+	"gom2k/internal/mapping"
 	"gom2k/internal/mqtt"
 	"gom2k/pkg/types"
 )
 
+// maxRetryPollInterval bounds how late a due retry is picked up
+const maxRetryPollInterval = time.Second
+
 // DeadLetterQueue handles messages that fail processing after retries
 type DeadLetterQueue struct {
 	config        *types.BridgeConfig
 	kafkaProducer *kafka.Producer
 	mqttClient    *mqtt.Client
+	topicMapper   *mapping.TopicMapper   // Applied when retrying MQTT→Kafka messages
+	reverseMapper *mapping.ReverseMapper // Applied when retrying Kafka→MQTT messages
+	codec         *kafka.Codec           // Envelope used when retrying messages
+	loops         *LoopDetector          // Places and tracks retried Kafka→MQTT messages, may be nil
 	
 	// Message tracking for retries
-	failedMessages map[string]*types.FailedMessage
-	messageMutex   sync.RWMutex
+	store        RetryStore // Messages pending retry, in memory until Start opens a file store
+	storeName    string     // File name of the file store, set by the owning bridge
+	messageMutex sync.RWMutex
 	
 	// Retry processing
 	retryTicker *time.Ticker
@@ -37,11 +48,24 @@ func NewDeadLetterQueue(config *types.BridgeConfig, kafkaProducer *kafka.Produce
 		return nil
 	}
 	
+	// Rules are validated at config load, retries fall back to envelope topics otherwise
+	reverseMapper, err := mapping.NewReverseMapper(config.Mapping.ReverseRules)
+	if err != nil {
+		log.Printf("Warning: dead letter queue ignoring invalid reverse mapping rules: %v", err)
+	}
+	codec, err := kafka.NewCodec(&config.Envelope)
+	if err != nil {
+		log.Printf("Warning: dead letter queue using the JSON envelope, invalid envelope config: %v", err)
+	}
+	
 	return &DeadLetterQueue{
 		config:         config,
 		kafkaProducer:  kafkaProducer,
 		mqttClient:     mqttClient,
-		failedMessages: make(map[string]*types.FailedMessage),
+		topicMapper:    mapping.NewTopicMapper(&config.Mapping),
+		reverseMapper:  reverseMapper,
+		codec:          codec,
+		store:          NewMemoryRetryStore(),
 		stopChan:       make(chan struct{}),
 	}
 }
@@ -52,10 +76,21 @@ func (dlq *DeadLetterQueue) Start() error {
 		return nil
 	}
 	
-	log.Printf("Starting dead letter queue with retry interval: %v", dlq.config.DeadLetter.RetryInterval)
+	log.Printf("Starting dead letter queue with retry interval: %v (max %v)", dlq.config.DeadLetter.RetryInterval, dlq.config.DeadLetter.MaxRetryInterval)
 	
-	// Start retry processing goroutine
-	dlq.retryTicker = time.NewTicker(dlq.config.DeadLetter.RetryInterval)
+	// Pending retries of the previous run are loaded and resumed by the retry loop
+	if dlq.config.DeadLetter.Store.Type == types.RetryStoreFile {
+		if err := dlq.openFileStore(); err != nil {
+			return err
+		}
+	}
+	
+	// Start retry processing goroutine, which checks for due retries
+	pollInterval := dlq.config.DeadLetter.RetryInterval
+	if pollInterval <= 0 || pollInterval > maxRetryPollInterval {
+		pollInterval = maxRetryPollInterval
+	}
+	dlq.retryTicker = time.NewTicker(pollInterval)
 	dlq.wg.Add(1)
 	go dlq.processRetries()
 	
@@ -75,11 +110,59 @@ func (dlq *DeadLetterQueue) Stop() error {
 	dlq.retryTicker.Stop()
 	dlq.wg.Wait()
 	
+	dlq.messageMutex.Lock()
+	defer dlq.messageMutex.Unlock()
+	if err := dlq.store.Close(); err != nil {
+		return fmt.Errorf("failed to close retry store: %w", err)
+	}
+	
 	return nil
 }
 
-// HandleFailedMessage processes a message that failed and determines if it should be retried or sent to DLQ
+// openFileStore replaces the in-memory retry store with the file store of this bridge.
+// Failures recorded before are moved over.
+func (dlq *DeadLetterQueue) openFileStore() error {
+	name := dlq.storeName
+	if name == "" {
+		name = "retries"
+	}
+	store, err := OpenFileRetryStore(filepath.Join(dlq.config.DeadLetter.Store.Dir, name+".log"))
+	if err != nil {
+		return fmt.Errorf("failed to open retry store: %w", err)
+	}
+	
+	dlq.messageMutex.Lock()
+	defer dlq.messageMutex.Unlock()
+	
+	for _, entry := range dlq.store.List() {
+		if err := store.Put(entry.Key, entry.Message); err != nil {
+			store.Close()
+			return fmt.Errorf("failed to move pending retries to retry store: %w", err)
+		}
+	}
+	dlq.store = store
+	
+	if pending := store.Len(); pending > 0 {
+		log.Printf("Resuming %d pending retries from the retry store", pending)
+	}
+	return nil
+}
+
+// HandleFailedMessage records a failed attempt of a message and schedules its retry.
+// The failure is treated as transient, HandleError classifies it first.
 func (dlq *DeadLetterQueue) HandleFailedMessage(originalMsg interface{}, failureReason string, direction string, originalTopic string, targetTopic string) {
+	dlq.handleFailure(originalMsg, failureReason, ErrorTransient, direction, originalTopic, targetTopic)
+}
+
+// HandleError handles a failed message by the class of its error: permanent failures go
+// straight to the dead letter topics, transient ones are retried with backoff
+func (dlq *DeadLetterQueue) HandleError(originalMsg interface{}, err error, direction string, originalTopic string, targetTopic string) {
+	dlq.handleFailure(originalMsg, err.Error(), ClassifyError(err), direction, originalTopic, targetTopic)
+}
+
+// handleFailure records a failed attempt and either schedules a retry or sends the
+// message to the dead letter topics
+func (dlq *DeadLetterQueue) handleFailure(originalMsg interface{}, failureReason string, errorClass string, direction string, originalTopic string, targetTopic string) {
 	if dlq == nil || !dlq.config.DeadLetter.Enabled {
 		// Just log the error if DLQ is disabled
 		log.Printf("Message failed processing (DLQ disabled): %s -> %s: %s", originalTopic, targetTopic, failureReason)
@@ -92,37 +175,145 @@ func (dlq *DeadLetterQueue) HandleFailedMessage(originalMsg interface{}, failure
 	dlq.messageMutex.Lock()
 	defer dlq.messageMutex.Unlock()
 	
-	failedMsg, exists := dlq.failedMessages[messageKey]
+	now := time.Now()
+	failedMsg, exists := dlq.store.Get(messageKey)
 	if !exists {
 		// First failure - create new failed message record
 		failedMsg = &types.FailedMessage{
+			MessageID:       messageID(originalMsg),
 			OriginalMessage: originalMsg,
 			FailureReason:   failureReason,
+			ErrorClass:      errorClass,
 			AttemptCount:    1,
-			FirstFailure:    time.Now(),
-			LastAttempt:     time.Now(),
+			FirstFailure:    now,
+			LastAttempt:     now,
 			Direction:       direction,
 			OriginalTopic:   originalTopic,
 			TargetTopic:     targetTopic,
 		}
-		dlq.failedMessages[messageKey] = failedMsg
-		log.Printf("Added message to retry queue (attempt 1/%d): %s", dlq.config.DeadLetter.MaxRetries, failureReason)
 	} else {
 		// Subsequent failure - update existing record
 		failedMsg.AttemptCount++
-		failedMsg.LastAttempt = time.Now()
+		failedMsg.LastAttempt = now
 		failedMsg.FailureReason = failureReason // Update with latest error
-		log.Printf("Message retry failed (attempt %d/%d): %s", failedMsg.AttemptCount, dlq.config.DeadLetter.MaxRetries, failureReason)
+		failedMsg.ErrorClass = errorClass
+	}
+	
+	// Retrying can't fix permanent failures
+	if errorClass == ErrorPermanent {
+		log.Printf("Message %s failed permanently, sending to dead letter queue: %s", failedMsg.MessageID, failureReason)
+		dlq.sendToDeadLetterQueue(failedMsg)
+		dlq.deletePending(messageKey)
+		return
 	}
 	
 	// Check if we've exceeded max retries
 	if failedMsg.AttemptCount >= dlq.config.DeadLetter.MaxRetries {
-		log.Printf("Message exceeded max retries, sending to dead letter queue: %s", failureReason)
+		log.Printf("Message %s exceeded max retries, sending to dead letter queue: %s", failedMsg.MessageID, failureReason)
+		dlq.sendToDeadLetterQueue(failedMsg)
+		dlq.deletePending(messageKey)
+		return
+	}
+	
+	if !exists && !dlq.makeRoom(failedMsg) {
+		return
+	}
+	
+	delay := dlq.RetryDelay(failedMsg.AttemptCount)
+	failedMsg.NextAttempt = now.Add(delay)
+	if exists {
+		log.Printf("Message %s retry failed (attempt %d/%d), retrying in %v: %s", failedMsg.MessageID, failedMsg.AttemptCount, dlq.config.DeadLetter.MaxRetries, delay, failureReason)
+	} else {
+		log.Printf("Added message %s to retry queue (attempt 1/%d), retrying in %v: %s", failedMsg.MessageID, dlq.config.DeadLetter.MaxRetries, delay, failureReason)
+	}
+	
+	if err := dlq.store.Put(messageKey, failedMsg); err != nil {
+		log.Printf("Warning: failed to store pending retry: %v", err)
+	}
+}
+
+// RetryDelay returns the delay before retrying a message that failed the given number of
+// times: the retry interval doubles with every failure up to the max retry interval, and
+// a random share of up to the retry jitter is taken off so messages failing together
+// don't all come back at once
+func (dlq *DeadLetterQueue) RetryDelay(failures int) time.Duration {
+	delay := dlq.config.DeadLetter.RetryInterval
+	maxDelay := dlq.config.DeadLetter.MaxRetryInterval
+	if maxDelay < delay {
+		maxDelay = delay
+	}
+	
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	
+	if jitter := dlq.config.DeadLetter.RetryJitter; jitter > 0 {
+		delay -= time.Duration(jitter * rand.Float64() * float64(delay))
+	}
+	return delay
+}
+
+// makeRoom applies the overflow policy when the retry store is full. It reports whether
+// the new failed message can be added. The caller must hold the message mutex.
+func (dlq *DeadLetterQueue) makeRoom(failedMsg *types.FailedMessage) bool {
+	maxMessages := dlq.config.DeadLetter.Store.MaxMessages
+	if maxMessages <= 0 {
+		maxMessages = types.DefaultMaxPendingRetries
+	}
+	if dlq.store.Len() < maxMessages {
+		return true
+	}
+	
+	switch dlq.config.DeadLetter.Store.Overflow {
+	case types.OverflowDrop:
+		log.Printf("Retry queue full (%d messages), dropping failed message %s: %s -> %s", maxMessages, failedMsg.MessageID, failedMsg.OriginalTopic, failedMsg.TargetTopic)
+		return false
+	case types.OverflowEvictOldest:
+		oldest := dlq.store.List()[0]
+		log.Printf("Retry queue full (%d messages), sending oldest pending message %s to dead letter queue: %s -> %s", maxMessages, oldest.Message.MessageID, oldest.Message.OriginalTopic, oldest.Message.TargetTopic)
+		dlq.sendToDeadLetterQueue(oldest.Message)
+		dlq.deletePending(oldest.Key)
+		return true
+	default:
+		log.Printf("Retry queue full (%d messages), sending failed message %s to dead letter queue: %s -> %s", maxMessages, failedMsg.MessageID, failedMsg.OriginalTopic, failedMsg.TargetTopic)
 		dlq.sendToDeadLetterQueue(failedMsg)
-		delete(dlq.failedMessages, messageKey)
+		return false
+	}
+}
+
+// deletePending removes a message from the retry store. The caller must hold the message mutex.
+func (dlq *DeadLetterQueue) deletePending(messageKey string) {
+	if err := dlq.store.Delete(messageKey); err != nil {
+		log.Printf("Warning: failed to remove pending retry: %v", err)
 	}
 }
 
+// SendToDeadLetter sends a message straight to the dead letter topics, skipping retries.
+// It's used for failures retrying can't fix, such as topics refused by the topic guard.
+func (dlq *DeadLetterQueue) SendToDeadLetter(originalMsg interface{}, failureReason string, direction string, originalTopic string, targetTopic string) {
+	if dlq == nil || !dlq.config.DeadLetter.Enabled {
+		log.Printf("Message dropped (DLQ disabled): %s -> %s: %s", originalTopic, targetTopic, failureReason)
+		return
+	}
+	
+	now := time.Now()
+	dlq.sendToDeadLetterQueue(&types.FailedMessage{
+		MessageID:       messageID(originalMsg),
+		OriginalMessage: originalMsg,
+		FailureReason:   failureReason,
+		AttemptCount:    1,
+		FirstFailure:    now,
+		LastAttempt:     now,
+		ErrorClass:      ErrorPermanent,
+		Direction:       direction,
+		OriginalTopic:   originalTopic,
+		TargetTopic:     targetTopic,
+	})
+}
+
 // processRetries periodically attempts to reprocess failed messages
 func (dlq *DeadLetterQueue) processRetries() {
 	defer dlq.wg.Done()
@@ -137,26 +328,24 @@ func (dlq *DeadLetterQueue) processRetries() {
 	}
 }
 
-// retryFailedMessages attempts to reprocess all failed messages
+// retryFailedMessages attempts to reprocess all failed messages that are due
 func (dlq *DeadLetterQueue) retryFailedMessages() {
 	dlq.messageMutex.Lock()
-	messagesToRetry := make([]*types.FailedMessage, 0, len(dlq.failedMessages))
-	for _, msg := range dlq.failedMessages {
-		messagesToRetry = append(messagesToRetry, msg)
-	}
+	pending := dlq.store.List()
 	dlq.messageMutex.Unlock()
 	
-	for _, failedMsg := range messagesToRetry {
-		// Only retry if enough time has passed since last attempt
-		if time.Since(failedMsg.LastAttempt) >= dlq.config.DeadLetter.RetryInterval {
-			dlq.retryMessage(failedMsg)
+	now := time.Now()
+	for _, entry := range pending {
+		failedMsg := entry.Message
+		if !now.Before(failedMsg.NextAttempt) {
+			dlq.retryMessage(entry.Key, failedMsg)
 		}
 	}
 }
 
 // retryMessage attempts to reprocess a single failed message
-func (dlq *DeadLetterQueue) retryMessage(failedMsg *types.FailedMessage) {
-	log.Printf("Retrying failed message (attempt %d): %s -> %s", failedMsg.AttemptCount+1, failedMsg.OriginalTopic, failedMsg.TargetTopic)
+func (dlq *DeadLetterQueue) retryMessage(messageKey string, failedMsg *types.FailedMessage) {
+	log.Printf("Retrying failed message %s (attempt %d): %s -> %s", failedMsg.MessageID, failedMsg.AttemptCount+1, failedMsg.OriginalTopic, failedMsg.TargetTopic)
 	
 	var err error
 	switch failedMsg.Direction {
@@ -165,19 +354,34 @@ func (dlq *DeadLetterQueue) retryMessage(failedMsg *types.FailedMessage) {
 	case "kafka-to-mqtt":
 		err = dlq.retryKafkaToMQTT(failedMsg)
 	default:
-		err = fmt.Errorf("unknown direction: %s", failedMsg.Direction)
+		err = Permanent(fmt.Errorf("unknown direction: %s", failedMsg.Direction))
 	}
 	
-	if err != nil {
+	if errors.Is(err, kafka.ErrTopicNotAllowed) {
+		// The topic guard won't accept the message on later attempts either
+		dlq.messageMutex.Lock()
+		dlq.deletePending(messageKey)
+		dlq.messageMutex.Unlock()
+		
+		failedMsg.AttemptCount++
+		failedMsg.LastAttempt = time.Now()
+		failedMsg.FailureReason = err.Error()
+		failedMsg.ErrorClass = ErrorPermanent
+		if dlq.config.Kafka.Guard.DisallowedPolicy == kafka.DisallowedDrop {
+			log.Printf("Dropped message %s for refused topic: %s -> %s: %v", failedMsg.MessageID, failedMsg.OriginalTopic, failedMsg.TargetTopic, err)
+			return
+		}
+		log.Printf("Topic refused, sending message %s to dead letter queue: %v", failedMsg.MessageID, err)
+		dlq.sendToDeadLetterQueue(failedMsg)
+	} else if err != nil {
 		// Retry failed, update failure info
-		dlq.HandleFailedMessage(failedMsg.OriginalMessage, err.Error(), failedMsg.Direction, failedMsg.OriginalTopic, failedMsg.TargetTopic)
+		dlq.HandleError(failedMsg.OriginalMessage, err, failedMsg.Direction, failedMsg.OriginalTopic, failedMsg.TargetTopic)
 	} else {
 		// Retry succeeded, remove from failed messages
-		messageKey := dlq.createMessageKey(failedMsg.OriginalMessage, failedMsg.Direction, failedMsg.OriginalTopic)
 		dlq.messageMutex.Lock()
-		delete(dlq.failedMessages, messageKey)
+		dlq.deletePending(messageKey)
 		dlq.messageMutex.Unlock()
-		log.Printf("✓ Retry successful: %s -> %s", failedMsg.OriginalTopic, failedMsg.TargetTopic)
+		log.Printf("✓ Retry of message %s successful: %s -> %s", failedMsg.MessageID, failedMsg.OriginalTopic, failedMsg.TargetTopic)
 	}
 }
 
@@ -185,13 +389,13 @@ func (dlq *DeadLetterQueue) retryMessage(failedMsg *types.FailedMessage) {
 func (dlq *DeadLetterQueue) retryMQTTToKafka(failedMsg *types.FailedMessage) error {
 	mqttMsg, ok := failedMsg.OriginalMessage.(*types.MQTTMessage)
 	if !ok {
-		return fmt.Errorf("invalid MQTT message type for retry")
+		return Permanent(fmt.Errorf("invalid MQTT message type for retry"))
 	}
 	
 	// Convert and send to Kafka
-	kafkaMsg, err := kafka.ConvertMQTTMessage(mqttMsg, failedMsg.TargetTopic)
+	kafkaMsg, err := convertMQTTToKafka(dlq.codec, mqttMsg, dlq.topicMapper.MapTopic(mqttMsg.Topic))
 	if err != nil {
-		return fmt.Errorf("retry: failed to convert MQTT message: %w", err)
+		return Permanent(fmt.Errorf("retry: failed to convert MQTT message: %w", err))
 	}
 	
 	ctx := context.Background()
@@ -206,13 +410,17 @@ func (dlq *DeadLetterQueue) retryMQTTToKafka(failedMsg *types.FailedMessage) err
 func (dlq *DeadLetterQueue) retryKafkaToMQTT(failedMsg *types.FailedMessage) error {
 	kafkaMsg, ok := failedMsg.OriginalMessage.(*types.KafkaMessage)
 	if !ok {
-		return fmt.Errorf("invalid Kafka message type for retry")
+		return Permanent(fmt.Errorf("invalid Kafka message type for retry"))
 	}
 	
 	// Convert and send to MQTT
-	mqttMsg, err := kafka.ConvertKafkaMessage(kafkaMsg)
+	mqttMsg, err := convertKafkaToMQTT(dlq.codec, dlq.reverseMapper, kafkaMsg)
 	if err != nil {
-		return fmt.Errorf("retry: failed to convert Kafka message: %w", err)
+		return Permanent(fmt.Errorf("retry: failed to convert Kafka message: %w", err))
+	}
+	if dlq.loops != nil {
+		mqttMsg.Topic = dlq.loops.PublishTopic(mqttMsg.Topic)
+		dlq.loops.Published(mqttMsg.Topic, mqttMsg.Payload)
 	}
 	
 	if err := dlq.mqttClient.Publish(mqttMsg.Topic, mqttMsg.Payload, mqttMsg.QoS, mqttMsg.Retained); err != nil {
@@ -224,8 +432,8 @@ func (dlq *DeadLetterQueue) retryKafkaToMQTT(failedMsg *types.FailedMessage) err
 
 // sendToDeadLetterQueue sends a failed message to the configured dead letter topics
 func (dlq *DeadLetterQueue) sendToDeadLetterQueue(failedMsg *types.FailedMessage) {
-	// Serialize the failed message
-	dlqPayload, err := json.Marshal(failedMsg)
+	// Serialize the failed message as a versioned dead letter record
+	dlqPayload, err := types.EncodeDeadLetterRecord(failedMsg, dlq.config.InstanceID)
 	if err != nil {
 		log.Printf("Error serializing failed message for DLQ: %v", err)
 		return
@@ -233,17 +441,10 @@ func (dlq *DeadLetterQueue) sendToDeadLetterQueue(failedMsg *types.FailedMessage
 	
 	// Send to Kafka dead letter topic if configured and producer is available
 	if dlq.config.DeadLetter.KafkaTopic != "" && dlq.kafkaProducer != nil {
-		kafkaMsg := &types.KafkaMessage{
-			Key:   fmt.Sprintf("dlq-%s-%d", failedMsg.Direction, time.Now().Unix()),
-			Value: dlqPayload,
-			Topic: dlq.config.DeadLetter.KafkaTopic,
-		}
-		
-		ctx := context.Background()
-		if err := dlq.kafkaProducer.WriteMessage(ctx, kafkaMsg); err != nil {
+		if err := dlq.sendToKafkaDeadLetter(failedMsg, dlqPayload); err != nil {
 			log.Printf("Error sending failed message to Kafka DLQ: %v", err)
 		} else {
-			log.Printf("✓ Sent failed message to Kafka DLQ: %s", dlq.config.DeadLetter.KafkaTopic)
+			log.Printf("✓ Sent failed message %s to Kafka DLQ: %s", failedMsg.MessageID, dlq.config.DeadLetter.KafkaTopic)
 		}
 	}
 	
@@ -252,13 +453,43 @@ func (dlq *DeadLetterQueue) sendToDeadLetterQueue(failedMsg *types.FailedMessage
 		if err := dlq.mqttClient.Publish(dlq.config.DeadLetter.MQTTTopic, dlqPayload, 1, false); err != nil {
 			log.Printf("Error sending failed message to MQTT DLQ: %v", err)
 		} else {
-			log.Printf("✓ Sent failed message to MQTT DLQ: %s", dlq.config.DeadLetter.MQTTTopic)
+			log.Printf("✓ Sent failed message %s to MQTT DLQ: %s", failedMsg.MessageID, dlq.config.DeadLetter.MQTTTopic)
 		}
 	}
 }
 
-// createMessageKey creates a unique key for tracking failed messages
+// sendToKafkaDeadLetter writes a serialized dead letter record to the Kafka dead letter
+// topic. Only the Kafka copy is compressed, its content encoding header names the codec.
+func (dlq *DeadLetterQueue) sendToKafkaDeadLetter(failedMsg *types.FailedMessage, dlqPayload []byte) error {
+	compression := dlq.config.DeadLetter.Compression
+	value, err := kafka.CompressPayload(dlqPayload, compression)
+	if err != nil {
+		return fmt.Errorf("failed to compress dead letter record: %w", err)
+	}
+	
+	key := fmt.Sprintf("dlq-%s-%d", failedMsg.Direction, time.Now().Unix())
+	if failedMsg.MessageID != "" {
+		key = fmt.Sprintf("dlq-%s-%s", failedMsg.Direction, failedMsg.MessageID)
+	}
+	kafkaMsg := &types.KafkaMessage{
+		Key:   key,
+		Value: value,
+		Topic: dlq.config.DeadLetter.KafkaTopic,
+	}
+	if compression != "" && compression != "none" {
+		kafkaMsg.Headers = []types.KafkaHeader{{Key: kafka.HeaderContentEncoding, Value: []byte(compression)}}
+	}
+	
+	return dlq.kafkaProducer.WriteMessage(context.Background(), kafkaMsg)
+}
+
+// createMessageKey creates a unique key for tracking failed messages. Messages received by
+// the bridge are tracked by their ID, messages without one by topic and timestamp or key.
 func (dlq *DeadLetterQueue) createMessageKey(originalMsg interface{}, direction string, originalTopic string) string {
+	if id := messageID(originalMsg); id != "" {
+		return direction + "-" + id
+	}
+	
 	switch msg := originalMsg.(type) {
 	case *types.MQTTMessage:
 		return fmt.Sprintf("%s-%s-%d", direction, originalTopic, msg.Timestamp.Unix())
@@ -269,6 +500,18 @@ func (dlq *DeadLetterQueue) createMessageKey(originalMsg interface{}, direction
 	}
 }
 
+// messageID returns the ID the bridge assigned to an MQTT or Kafka message on receipt
+func messageID(originalMsg interface{}) string {
+	switch msg := originalMsg.(type) {
+	case *types.MQTTMessage:
+		return msg.ID
+	case *types.KafkaMessage:
+		return msg.ID
+	default:
+		return ""
+	}
+}
+
 // GetFailedMessageCount returns the number of messages currently in retry queue
 func (dlq *DeadLetterQueue) GetFailedMessageCount() int {
 	if dlq == nil {
@@ -277,5 +520,5 @@ func (dlq *DeadLetterQueue) GetFailedMessageCount() int {
 	
 	dlq.messageMutex.RLock()
 	defer dlq.messageMutex.RUnlock()
-	return len(dlq.failedMessages)
+	return dlq.store.Len()
 }
\ No newline at end of file
@@ -0,0 +1,90 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gom2k/internal/kafka"
+	"gom2k/pkg/types"
+)
+
+// legacyDeadLetterRecord is a dead letter record written before the schema was versioned,
+// with the original message left undecoded until the direction is known
+type legacyDeadLetterRecord struct {
+	types.FailedMessage
+	OriginalMessage json.RawMessage `json:"original_message"`
+}
+
+// DecodeDeadLetterRecord parses a dead letter record read from Kafka, decompressing the value
+// as named by its content encoding header
+func DecodeDeadLetterRecord(kafkaMsg *types.KafkaMessage) (*types.DeadLetterRecord, error) {
+	compression, _ := kafkaMsg.Header(kafka.HeaderContentEncoding)
+	return DecodeDeadLetterPayload(kafkaMsg.Value, compression)
+}
+
+// DecodeDeadLetterPayload parses a dead letter record compressed with the given codec. MQTT
+// dead letters are never compressed and are decoded with an empty codec.
+func DecodeDeadLetterPayload(payload []byte, compression string) (*types.DeadLetterRecord, error) {
+	if compression != "" && compression != "none" {
+		decompressed, err := kafka.DecompressPayload(payload, compression)
+		if err != nil {
+			return nil, err
+		}
+		payload = decompressed
+	}
+	return decodeDeadLetterRecord(payload)
+}
+
+// decodeDeadLetterRecord parses a dead letter record of any version. Records without a
+// version are converted to the current schema and keep version 0.
+func decodeDeadLetterRecord(data []byte) (*types.DeadLetterRecord, error) {
+	var versioned struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &versioned); err != nil {
+		return nil, fmt.Errorf("invalid dead letter record: %w", err)
+	}
+	if versioned.Version != 0 {
+		return types.DecodeDeadLetterRecord(data)
+	}
+
+	failedMsg, err := decodeLegacyFailedMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	record, err := types.NewDeadLetterRecord(failedMsg, "")
+	if err != nil {
+		return nil, err
+	}
+	record.Version = 0
+	return record, nil
+}
+
+// decodeLegacyFailedMessage restores a failed message from an unversioned record. The
+// original message is decoded as an MQTT or Kafka message by the direction of the failure,
+// MQTT payloads without payload_encoding as base64, as they were written.
+func decodeLegacyFailedMessage(data []byte) (*types.FailedMessage, error) {
+	var record legacyDeadLetterRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid dead letter record: %w", err)
+	}
+
+	failedMsg := record.FailedMessage
+	switch failedMsg.Direction {
+	case "mqtt-to-kafka":
+		var mqttMsg types.MQTTMessage
+		if err := json.Unmarshal(record.OriginalMessage, &mqttMsg); err != nil {
+			return nil, fmt.Errorf("invalid MQTT message in dead letter record: %w", err)
+		}
+		failedMsg.OriginalMessage = &mqttMsg
+	case "kafka-to-mqtt":
+		var kafkaMsg types.KafkaMessage
+		if err := json.Unmarshal(record.OriginalMessage, &kafkaMsg); err != nil {
+			return nil, fmt.Errorf("invalid Kafka message in dead letter record: %w", err)
+		}
+		failedMsg.OriginalMessage = &kafkaMsg
+	default:
+		return nil, fmt.Errorf("unknown direction in dead letter record: %q", failedMsg.Direction)
+	}
+	return &failedMsg, nil
+}
@@ -0,0 +1,142 @@
+package bridge
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gom2k/pkg/types"
+)
+
+// Dimensions dead letter records are grouped by
+const (
+	GroupByReason    = "reason"    // Failure reason
+	GroupByClass     = "class"     // Error classification
+	GroupByDirection = "direction" // Bridge direction
+	GroupByTopic     = "topic"     // Original topic
+	GroupByTime      = "time"      // Time bucket of the last attempt
+)
+
+// DeadLetterGroup counts the dead letter records sharing the values of the grouped
+// dimensions. Dimensions that aren't grouped by are left empty.
+type DeadLetterGroup struct {
+	Reason    string     `json:"reason,omitempty"`
+	Class     string     `json:"error_class,omitempty"`
+	Direction string     `json:"direction,omitempty"`
+	Topic     string     `json:"topic,omitempty"`
+	Bucket    *time.Time `json:"bucket,omitempty"` // Start of the time bucket
+	Count     int        `json:"count"`
+	First     time.Time  `json:"first"` // Earliest last attempt in the group
+	Last      time.Time  `json:"last"`  // Latest last attempt in the group
+}
+
+// deadLetterGroupKey identifies a group, the bucket is in Unix seconds
+type deadLetterGroupKey struct {
+	reason, class, direction, topic string
+	bucket                          int64
+}
+
+// DeadLetterStats groups dead letter records by a set of dimensions
+type DeadLetterStats struct {
+	dimensions map[string]bool
+	bucket     time.Duration
+	groups     map[deadLetterGroupKey]*DeadLetterGroup
+	total      int
+}
+
+// NewDeadLetterStats creates statistics grouping by the given dimensions. Records are
+// bucketed by the time of their last attempt if grouped by time.
+func NewDeadLetterStats(dimensions []string, bucket time.Duration) (*DeadLetterStats, error) {
+	stats := &DeadLetterStats{
+		dimensions: make(map[string]bool),
+		bucket:     bucket,
+		groups:     make(map[deadLetterGroupKey]*DeadLetterGroup),
+	}
+	for _, dimension := range dimensions {
+		switch dimension {
+		case GroupByReason, GroupByClass, GroupByDirection, GroupByTopic, GroupByTime:
+			stats.dimensions[dimension] = true
+		default:
+			return nil, fmt.Errorf("unknown dimension %q (expected reason, class, direction, topic or time)", dimension)
+		}
+	}
+	if stats.dimensions[GroupByTime] && bucket <= 0 {
+		return nil, fmt.Errorf("time buckets must be positive, got %v", bucket)
+	}
+	return stats, nil
+}
+
+// Add counts a dead letter record in its group
+func (s *DeadLetterStats) Add(record *types.DeadLetterRecord) {
+	var key deadLetterGroupKey
+	if s.dimensions[GroupByReason] {
+		key.reason = record.FailureReason
+	}
+	if s.dimensions[GroupByClass] {
+		key.class = record.ErrorClass
+	}
+	if s.dimensions[GroupByDirection] {
+		key.direction = record.Direction
+	}
+	if s.dimensions[GroupByTopic] {
+		key.topic = record.OriginalTopic
+	}
+
+	group, exists := s.groups[key]
+	if s.dimensions[GroupByTime] {
+		bucket := record.LastAttempt.UTC().Truncate(s.bucket)
+		key.bucket = bucket.Unix()
+		if group, exists = s.groups[key]; !exists {
+			group = &DeadLetterGroup{Bucket: &bucket}
+		}
+	} else if !exists {
+		group = &DeadLetterGroup{}
+	}
+	if !exists {
+		group.Reason, group.Class, group.Direction, group.Topic = key.reason, key.class, key.direction, key.topic
+		group.First, group.Last = record.LastAttempt, record.LastAttempt
+		s.groups[key] = group
+	}
+
+	group.Count++
+	if record.LastAttempt.Before(group.First) {
+		group.First = record.LastAttempt
+	}
+	if record.LastAttempt.After(group.Last) {
+		group.Last = record.LastAttempt
+	}
+	s.total++
+}
+
+// Total returns the number of records added
+func (s *DeadLetterStats) Total() int {
+	return s.total
+}
+
+// Groups returns the groups ordered by time bucket, then by descending count
+func (s *DeadLetterStats) Groups() []DeadLetterGroup {
+	groups := make([]DeadLetterGroup, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if a.Bucket != nil && !a.Bucket.Equal(*b.Bucket) {
+			return a.Bucket.Before(*b.Bucket)
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Direction != b.Direction {
+			return a.Direction < b.Direction
+		}
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		if a.Class != b.Class {
+			return a.Class < b.Class
+		}
+		return a.Reason < b.Reason
+	})
+	return groups
+}
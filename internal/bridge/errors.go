@@ -0,0 +1,40 @@
+package bridge
+
+import (
+	"errors"
+
+	"gom2k/internal/kafka"
+	"gom2k/internal/mqtt"
+)
+
+// Error classes of failed messages
+const (
+	ErrorTransient = "transient" // Retried with backoff, such as network errors and unavailable leaders
+	ErrorPermanent = "permanent" // Sent straight to the dead letter topics, retrying can't fix it
+)
+
+// permanentError marks a failure retrying can't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as permanent, such as a message that can't be converted
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// ClassifyError returns the error class of a failed message. Conversion errors, invalid
+// topics and missing authorization are permanent, all other errors are transient.
+func ClassifyError(err error) string {
+	var permanent *permanentError
+	if errors.As(err, &permanent) || errors.Is(err, mqtt.ErrInvalidTopic) || kafka.IsPermanentError(err) {
+		return ErrorPermanent
+	}
+	return ErrorTransient
+}
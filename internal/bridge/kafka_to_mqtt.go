@@ -4,10 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"strings"
 	"sync"
+	"time"
 
 	"gom2k/internal/kafka"
+	"gom2k/internal/mapping"
 	"gom2k/internal/mqtt"
 	"gom2k/pkg/types"
 )
@@ -21,6 +22,11 @@ type KafkaToMQTTBridge struct {
 	cancel        context.CancelFunc // To signal goroutine shutdown
 	errorChan     chan error      // Channel to receive errors from goroutine
 	deadLetterQueue *DeadLetterQueue // Dead letter queue for failed messages
+	reverseMapper   *mapping.ReverseMapper // Derives MQTT topics from Kafka record metadata
+	codec           *kafka.Codec           // Decodes records in any supported envelope
+	loops           *LoopDetector          // Places and tracks messages so they aren't bridged back
+	ignore          *mqtt.IgnoreList       // MQTT topics records aren't published to
+	skips           *SkipCounter           // Counts records skipped on purpose
 }
 
 // NewKafkaToMQTTBridge creates a new Kafka to MQTT bridge
@@ -28,11 +34,31 @@ func NewKafkaToMQTTBridge(config *types.Config) *KafkaToMQTTBridge {
 	return &KafkaToMQTTBridge{
 		config:    config,
 		errorChan: make(chan error, 10), // Buffered channel for async error reporting
+		loops:     NewLoopDetector(&config.Bridge.LoopPrevention, false),
+		skips:     NewSkipCounter(),
 	}
 }
 
 // Start initializes and starts the bridge
 func (b *KafkaToMQTTBridge) Start(ctx context.Context) error {
+	reverseMapper, err := mapping.NewReverseMapper(b.config.Bridge.Mapping.ReverseRules)
+	if err != nil {
+		return fmt.Errorf("invalid reverse mapping rules: %w", err)
+	}
+	b.reverseMapper = reverseMapper
+	
+	codec, err := kafka.NewCodec(&b.config.Bridge.Envelope)
+	if err != nil {
+		return fmt.Errorf("invalid envelope config: %w", err)
+	}
+	b.codec = codec
+	
+	ignore, err := mqtt.NewIgnoreList(b.config.Bridge.Ignore.KafkaToMQTT)
+	if err != nil {
+		return fmt.Errorf("invalid ignore list: %w", err)
+	}
+	b.ignore = ignore
+	
 	// Initialize Kafka consumer
 	b.kafkaConsumer = kafka.NewConsumer(&b.config.Kafka, &b.config.Bridge)
 	if err := b.kafkaConsumer.Connect(); err != nil {
@@ -48,7 +74,7 @@ func (b *KafkaToMQTTBridge) Start(ctx context.Context) error {
 	// Initialize Kafka producer for dead letter queue (if DLQ is enabled)
 	var kafkaProducer *kafka.Producer
 	if b.config.Bridge.DeadLetter.Enabled && b.config.Bridge.DeadLetter.KafkaTopic != "" {
-		kafkaProducer = kafka.NewProducer(&b.config.Kafka, &b.config.Bridge)
+		kafkaProducer = kafka.NewProducer(kafka.ProducerConfig(&b.config.Kafka, kafka.ProducerRoleDeadLetter), &b.config.Bridge)
 		if err := kafkaProducer.Connect(); err != nil {
 			return fmt.Errorf("failed to connect Kafka producer for DLQ: %w", err)
 		}
@@ -57,6 +83,8 @@ func (b *KafkaToMQTTBridge) Start(ctx context.Context) error {
 	// Initialize dead letter queue  
 	b.deadLetterQueue = NewDeadLetterQueue(&b.config.Bridge, kafkaProducer, b.mqttClient)
 	if b.deadLetterQueue != nil {
+		b.deadLetterQueue.loops = b.loops
+		b.deadLetterQueue.storeName = "kafka-to-mqtt"
 		if err := b.deadLetterQueue.Start(); err != nil {
 			return fmt.Errorf("failed to start dead letter queue: %w", err)
 		}
@@ -133,7 +161,7 @@ func (b *KafkaToMQTTBridge) consumeMessages(ctx context.Context) {
 			
 			// Convert and forward to MQTT
 			if err := b.handleKafkaMessage(kafkaMsg); err != nil {
-				b.reportError(fmt.Errorf("error handling Kafka message: %w", err))
+				b.reportError(fmt.Errorf("error handling Kafka message %s: %w", kafkaMsg.ID, err))
 				continue
 			}
 		}
@@ -143,11 +171,11 @@ func (b *KafkaToMQTTBridge) consumeMessages(ctx context.Context) {
 // handleKafkaMessage processes a Kafka message and forwards it to MQTT
 func (b *KafkaToMQTTBridge) handleKafkaMessage(kafkaMsg *types.KafkaMessage) error {
 	// Convert Kafka message back to MQTT format
-	mqttMsg, err := kafka.ConvertKafkaMessage(kafkaMsg)
+	mqttMsg, err := convertKafkaToMQTT(b.codec, b.reverseMapper, kafkaMsg)
 	if err != nil {
 		errorMsg := fmt.Errorf("failed to convert Kafka message: %w", err)
 		if b.deadLetterQueue != nil {
-			b.deadLetterQueue.HandleFailedMessage(kafkaMsg, errorMsg.Error(), "kafka-to-mqtt", kafkaMsg.Topic, "")
+			b.deadLetterQueue.HandleError(kafkaMsg, Permanent(errorMsg), "kafka-to-mqtt", kafkaMsg.Topic, "")
 		}
 		return errorMsg
 	}
@@ -156,45 +184,74 @@ func (b *KafkaToMQTTBridge) handleKafkaMessage(kafkaMsg *types.KafkaMessage) err
 	if mqttMsg.Topic == "" {
 		errorMsg := fmt.Errorf("empty MQTT topic from Kafka message")
 		if b.deadLetterQueue != nil {
-			b.deadLetterQueue.HandleFailedMessage(kafkaMsg, errorMsg.Error(), "kafka-to-mqtt", kafkaMsg.Topic, "")
+			b.deadLetterQueue.HandleError(kafkaMsg, Permanent(errorMsg), "kafka-to-mqtt", kafkaMsg.Topic, "")
 		}
 		return errorMsg
 	}
 	
-	// Check if this topic should be republished (avoid loops)
-	if b.shouldSkipTopic(mqttMsg.Topic) {
-		log.Printf("Skipping topic to prevent loop: %s", mqttMsg.Topic)
+	// Broker and bridge topics are ignored by default
+	if filter, ignored := b.ignore.Match(mqttMsg.Topic); ignored {
+		b.skips.Count(SkipIgnored, "matches ignore filter "+filter, mqttMsg.Topic)
 		return nil
 	}
 	
+	// Records of messages just forwarded from MQTT would echo them back to their sender
+	mqttMsg.Topic = b.loops.PublishTopic(mqttMsg.Topic)
+	if b.loops.IsReturning(mqttMsg.Topic, mqttMsg.Payload) {
+		b.skips.Count(SkipLoop, "just forwarded from MQTT", mqttMsg.Topic)
+		return nil
+	}
+	b.loops.Published(mqttMsg.Topic, mqttMsg.Payload)
+	
 	// Publish to MQTT
 	if err := b.mqttClient.Publish(mqttMsg.Topic, mqttMsg.Payload, mqttMsg.QoS, mqttMsg.Retained); err != nil {
 		errorMsg := fmt.Errorf("failed to publish to MQTT: %w", err)
 		if b.deadLetterQueue != nil {
-			b.deadLetterQueue.HandleFailedMessage(kafkaMsg, errorMsg.Error(), "kafka-to-mqtt", kafkaMsg.Topic, mqttMsg.Topic)
+			b.deadLetterQueue.HandleError(kafkaMsg, errorMsg, "kafka-to-mqtt", kafkaMsg.Topic, mqttMsg.Topic)
 		}
 		return errorMsg
 	}
 	
-	log.Printf("✓ Forwarded Kafka message: %s -> %s", kafkaMsg.Topic, mqttMsg.Topic)
+	log.Printf("✓ Forwarded Kafka message %s: %s -> %s", kafkaMsg.ID, kafkaMsg.Topic, mqttMsg.Topic)
 	return nil
 }
 
-// shouldSkipTopic determines if a topic should be skipped to prevent message loops
-func (b *KafkaToMQTTBridge) shouldSkipTopic(mqttTopic string) bool {
-	// Skip certain system topics that might cause loops
-	skipPrefixes := []string{
-		"$SYS/",
-		"gom2k/",  // Skip our own bridge topics
+// convertKafkaToMQTT converts a Kafka record to an MQTT message, applying reverse mapping rules.
+// Records matched by a rule are published to the rule's topic. If such a record isn't a gom2k
+// envelope, its raw value becomes the MQTT payload with the QoS and retain flag of the rule.
+// The MQTT message keeps the ID the record was given on receipt.
+func convertKafkaToMQTT(codec *kafka.Codec, reverseMapper *mapping.ReverseMapper, kafkaMsg *types.KafkaMessage) (*types.MQTTMessage, error) {
+	match, err := reverseMapper.Map(kafkaMsg)
+	if err != nil {
+		return nil, err
+	}
+	if match == nil {
+		mqttMsg, err := codec.Decode(kafkaMsg)
+		if err != nil {
+			return nil, err
+		}
+		mqttMsg.ID = kafkaMsg.ID
+		return mqttMsg, nil
 	}
 	
-	for _, prefix := range skipPrefixes {
-		if strings.HasPrefix(mqttTopic, prefix) {
-			return true
+	mqttMsg, err := codec.Decode(kafkaMsg)
+	if err != nil {
+		mqttMsg = &types.MQTTMessage{
+			Payload:   kafkaMsg.Value,
+			QoS:       match.QoS,
+			Retained:  match.Retained,
+			Timestamp: time.Now(),
 		}
 	}
+	mqttMsg.ID = kafkaMsg.ID
+	mqttMsg.Topic = match.Topic
 	
-	return false
+	return mqttMsg, nil
+}
+
+// GetSkipCounts returns the number of records skipped on purpose by reason
+func (b *KafkaToMQTTBridge) GetSkipCounts() map[string]uint64 {
+	return b.skips.Counts()
 }
 
 // reportError sends error to error channel for monitoring
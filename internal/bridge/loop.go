@@ -0,0 +1,194 @@
+package bridge
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"time"
+
+	"gom2k/pkg/types"
+)
+
+// DefaultFingerprintTTL is how long forwarded messages are remembered if no TTL is configured
+const DefaultFingerprintTTL = time.Minute
+
+// DefaultMaxFingerprints limits the fingerprints remembered per direction if no limit is configured
+const DefaultMaxFingerprints = 100000
+
+// LoopDetector keeps bidirectional mode from forwarding messages in circles. Messages from
+// Kafka are published below the configured namespace, which MQTT→Kafka ignores. When both
+// directions run in one process, the detector also remembers fingerprints of forwarded
+// messages: messages the bridge published to MQTT are dropped when they are received again,
+// and records carrying a message just forwarded to Kafka aren't echoed back to its MQTT topic.
+// The Paho client speaks MQTT 3.1.1, so MQTT 5 user properties and no-local subscriptions
+// aren't available. This type is thread-safe.
+type LoopDetector struct {
+	namespace string
+	published *fingerprintCache // Messages published to MQTT by Kafka→MQTT, nil without fingerprints
+	forwarded *fingerprintCache // Messages forwarded to Kafka by MQTT→Kafka, nil without fingerprints
+}
+
+// NewLoopDetector creates a loop detector. Fingerprints are only tracked if enabled, since
+// they only help when the same process runs both directions.
+func NewLoopDetector(config *types.LoopPreventionConfig, fingerprints bool) *LoopDetector {
+	detector := &LoopDetector{
+		namespace: strings.TrimSuffix(config.Namespace, "/"),
+	}
+
+	if fingerprints && !config.DisableFingerprints {
+		ttl := config.FingerprintTTL
+		if ttl <= 0 {
+			ttl = DefaultFingerprintTTL
+		}
+		maxEntries := config.MaxFingerprints
+		if maxEntries <= 0 {
+			maxEntries = DefaultMaxFingerprints
+		}
+		detector.published = newFingerprintCache(ttl, maxEntries)
+		detector.forwarded = newFingerprintCache(ttl, maxEntries)
+	}
+
+	return detector
+}
+
+// PublishTopic returns the MQTT topic a message from Kafka is published to
+func (d *LoopDetector) PublishTopic(topic string) string {
+	if d.namespace == "" {
+		return topic
+	}
+	return d.namespace + "/" + topic
+}
+
+// Published records a message about to be published to MQTT by the bridge
+func (d *LoopDetector) Published(topic string, payload []byte) {
+	if d.published != nil {
+		d.published.add(topic, payload, time.Now())
+	}
+}
+
+// IsEcho reports whether a message received from MQTT was published by the bridge itself,
+// either because it's in the namespace or because its fingerprint was recorded. Each
+// recorded publication matches one received message.
+func (d *LoopDetector) IsEcho(topic string, payload []byte) bool {
+	if d.namespace != "" && (topic == d.namespace || strings.HasPrefix(topic, d.namespace+"/")) {
+		return true
+	}
+	return d.published != nil && d.published.take(topic, payload, time.Now())
+}
+
+// Forwarded records a message received from MQTT that is about to be forwarded to Kafka
+func (d *LoopDetector) Forwarded(topic string, payload []byte) {
+	if d.forwarded != nil {
+		d.forwarded.add(topic, payload, time.Now())
+	}
+}
+
+// IsReturning reports whether a message about to be published to MQTT was just forwarded
+// to Kafka from the same topic, so publishing it would echo it back to its sender.
+// Each recorded forward matches one returning message.
+func (d *LoopDetector) IsReturning(topic string, payload []byte) bool {
+	return d.forwarded != nil && d.forwarded.take(topic, payload, time.Now())
+}
+
+// fingerprint identifies a message by its topic and payload
+type fingerprint [sha256.Size]byte
+
+// fingerprintEntry counts the pending occurrences of a message
+type fingerprintEntry struct {
+	fp      fingerprint
+	count   int
+	expires time.Time
+	element *list.Element // Position in the expiry order
+}
+
+// fingerprintCache remembers message fingerprints for a limited time. When it is full, the
+// entry expiring first is evicted, so messages that never come back can't grow it without
+// bounds during bursts.
+type fingerprintCache struct {
+	ttl        time.Duration
+	maxEntries int
+	mutex      sync.Mutex
+	entries    map[fingerprint]*fingerprintEntry
+	order      *list.List // Entries by expiry, the first expires first
+}
+
+// newFingerprintCache creates a fingerprint cache with the given time to live and capacity
+func newFingerprintCache(ttl time.Duration, maxEntries int) *fingerprintCache {
+	return &fingerprintCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[fingerprint]*fingerprintEntry),
+		order:      list.New(),
+	}
+}
+
+// fingerprintOf hashes a message's topic and payload
+func fingerprintOf(topic string, payload []byte) fingerprint {
+	hash := sha256.New()
+	hash.Write([]byte(topic))
+	hash.Write([]byte{0})
+	hash.Write(payload)
+
+	var fp fingerprint
+	copy(fp[:], hash.Sum(nil))
+	return fp
+}
+
+// add records an occurrence of a message
+func (c *fingerprintCache) add(topic string, payload []byte, now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Every add expires last, so expired entries are at the front
+	for front := c.order.Front(); front != nil; front = c.order.Front() {
+		entry := front.Value.(*fingerprintEntry)
+		if now.Before(entry.expires) {
+			break
+		}
+		c.remove(entry)
+	}
+
+	fp := fingerprintOf(topic, payload)
+	entry, exists := c.entries[fp]
+	if !exists {
+		if len(c.entries) >= c.maxEntries {
+			c.remove(c.order.Front().Value.(*fingerprintEntry))
+		}
+		entry = &fingerprintEntry{fp: fp}
+		entry.element = c.order.PushBack(entry)
+		c.entries[fp] = entry
+	} else {
+		c.order.MoveToBack(entry.element)
+	}
+	entry.count++
+	entry.expires = now.Add(c.ttl)
+}
+
+// remove deletes an entry. The caller must hold the mutex.
+func (c *fingerprintCache) remove(entry *fingerprintEntry) {
+	c.order.Remove(entry.element)
+	delete(c.entries, entry.fp)
+}
+
+// take removes an occurrence of a message and reports whether there was one
+func (c *fingerprintCache) take(topic string, payload []byte, now time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fp := fingerprintOf(topic, payload)
+	entry, exists := c.entries[fp]
+	if !exists {
+		return false
+	}
+	if !now.Before(entry.expires) {
+		c.remove(entry)
+		return false
+	}
+
+	entry.count--
+	if entry.count == 0 {
+		c.remove(entry)
+	}
+	return true
+}
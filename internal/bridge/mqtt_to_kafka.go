@@ -2,12 +2,14 @@ package bridge
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
 
 	"gom2k/internal/kafka"
+	"gom2k/internal/mapping"
 	"gom2k/internal/mqtt"
+	"gom2k/internal/sparkplug"
 	"gom2k/pkg/types"
 )
 
@@ -19,18 +21,44 @@ type MQTTToKafkaBridge struct {
 	errorChan    chan error  // Channel to propagate errors from message handler
 	errorCount   int         // Counter for failed messages
 	deadLetterQueue *DeadLetterQueue // Dead letter queue for failed messages
+	topicMapper     *mapping.TopicMapper // Maps MQTT topics to sanitized Kafka topic names
+	codec           *kafka.Codec         // Encodes messages with the configured envelope
+	sparkplugDecoder *sparkplug.Decoder  // Decodes Sparkplug B messages, nil unless enabled
+	loops            *LoopDetector       // Recognizes messages published by the Kafka→MQTT direction
+	ignore           *mqtt.IgnoreList    // MQTT topics that aren't forwarded
+	skips            *SkipCounter        // Counts messages skipped on purpose
+	batcher          *RecordBatcher      // Groups converted messages into Kafka writes
 }
 
 // NewMQTTToKafkaBridge creates a new MQTT to Kafka bridge
 func NewMQTTToKafkaBridge(config *types.Config) *MQTTToKafkaBridge {
-	return &MQTTToKafkaBridge{
-		config:    config,
-		errorChan: make(chan error, 100), // Buffered channel for async error handling
+	b := &MQTTToKafkaBridge{
+		config:      config,
+		errorChan:   make(chan error, 100), // Buffered channel for async error handling
+		topicMapper: mapping.NewTopicMapper(&config.Bridge.Mapping),
+		loops:       NewLoopDetector(&config.Bridge.LoopPrevention, false),
+		skips:       NewSkipCounter(),
 	}
+	if config.Bridge.Sparkplug.Enabled {
+		b.sparkplugDecoder = sparkplug.NewDecoder(&config.Bridge.Sparkplug)
+	}
+	return b
 }
 
 // Start initializes and starts the bridge
 func (b *MQTTToKafkaBridge) Start(ctx context.Context) error {
+	codec, err := kafka.NewCodec(&b.config.Bridge.Envelope)
+	if err != nil {
+		return fmt.Errorf("invalid envelope config: %w", err)
+	}
+	b.codec = codec
+	
+	ignore, err := mqtt.NewIgnoreList(b.config.Bridge.Ignore.MQTTToKafka)
+	if err != nil {
+		return fmt.Errorf("invalid ignore list: %w", err)
+	}
+	b.ignore = ignore
+	
 	// Initialize MQTT client
 	b.mqttClient = mqtt.NewClient(&b.config.MQTT)
 	b.mqttClient.SetMessageHandler(b.handleMQTTMessage)
@@ -40,14 +68,20 @@ func (b *MQTTToKafkaBridge) Start(ctx context.Context) error {
 	}
 	
 	// Initialize Kafka producer
-	b.kafkaProducer = kafka.NewProducer(&b.config.Kafka, &b.config.Bridge)
+	b.kafkaProducer = kafka.NewProducer(kafka.ProducerConfig(&b.config.Kafka, kafka.ProducerRoleMQTTToKafka), &b.config.Bridge)
 	if err := b.kafkaProducer.Connect(); err != nil {
 		return fmt.Errorf("failed to connect Kafka producer: %w", err)
 	}
 
+	// Converted messages are written in batches, or each before it is acknowledged to MQTT
+	if b.config.Kafka.Producer.BatchSize > 1 {
+		b.batcher = NewRecordBatcher(b.config.Kafka.Producer.BatchSize, b.config.Kafka.Producer.BatchLinger, b.writeBatch)
+	}
+	
 	// Initialize dead letter queue
 	b.deadLetterQueue = NewDeadLetterQueue(&b.config.Bridge, b.kafkaProducer, b.mqttClient)
 	if b.deadLetterQueue != nil {
+		b.deadLetterQueue.storeName = "mqtt-to-kafka"
 		if err := b.deadLetterQueue.Start(); err != nil {
 			return fmt.Errorf("failed to start dead letter queue: %w", err)
 		}
@@ -69,6 +103,11 @@ func (b *MQTTToKafkaBridge) Start(ctx context.Context) error {
 func (b *MQTTToKafkaBridge) Stop() error {
 	log.Println("Stopping MQTT to Kafka bridge")
 	
+	// Write the pending batch while the dead letter queue can still take its failures
+	if b.batcher != nil {
+		b.batcher.Close()
+	}
+	
 	// Stop dead letter queue first
 	if b.deadLetterQueue != nil {
 		if err := b.deadLetterQueue.Stop(); err != nil {
@@ -89,78 +128,134 @@ func (b *MQTTToKafkaBridge) Stop() error {
 
 // Handle incoming MQTT messages
 func (b *MQTTToKafkaBridge) handleMQTTMessage(mqttMsg *types.MQTTMessage) {
+	if filter, ignored := b.ignore.Match(mqttMsg.Topic); ignored {
+		b.skips.Count(SkipIgnored, "matches ignore filter "+filter, mqttMsg.Topic)
+		return
+	}
+	
+	// Messages the bridge published itself would be forwarded in circles
+	if b.loops.IsEcho(mqttMsg.Topic, mqttMsg.Payload) {
+		b.skips.Count(SkipLoop, "published by the bridge", mqttMsg.Topic)
+		return
+	}
+	
+	// Sparkplug B node and device messages are decoded, STATE and other topics pass through
+	if b.sparkplugDecoder != nil && sparkplug.IsSparkplugTopic(mqttMsg.Topic) {
+		if _, err := sparkplug.ParseTopic(mqttMsg.Topic); err == nil {
+			b.handleSparkplugMessage(mqttMsg)
+			return
+		}
+	}
+	
 	// Map MQTT topic to Kafka topic
-	kafkaTopic := b.mapMQTTToKafkaTopic(mqttMsg.Topic)
+	topicMapping := b.topicMapper.MapTopic(mqttMsg.Topic)
+	kafkaTopic := topicMapping.KafkaTopic
 	
 	// Convert message
-	kafkaMsg, err := kafka.ConvertMQTTMessage(mqttMsg, kafkaTopic)
+	kafkaMsg, err := convertMQTTToKafka(b.codec, mqttMsg, topicMapping)
 	if err != nil {
-		b.reportError(fmt.Errorf("failed to convert MQTT message from topic %s: %w", mqttMsg.Topic, err))
+		b.reportError(fmt.Errorf("failed to convert MQTT message %s from topic %s: %w", mqttMsg.ID, mqttMsg.Topic, err))
 		if b.deadLetterQueue != nil {
-			b.deadLetterQueue.HandleFailedMessage(mqttMsg, err.Error(), "mqtt-to-kafka", mqttMsg.Topic, kafkaTopic)
+			b.deadLetterQueue.HandleError(mqttMsg, Permanent(err), "mqtt-to-kafka", mqttMsg.Topic, kafkaTopic)
 		}
 		return
 	}
 	
-	// Send to Kafka
-	ctx := context.Background()
-	if err := b.kafkaProducer.WriteMessage(ctx, kafkaMsg); err != nil {
-		errorMsg := fmt.Errorf("failed to send message to Kafka topic %s: %w", kafkaTopic, err)
-		b.reportError(errorMsg)
-		if b.deadLetterQueue != nil {
-			b.deadLetterQueue.HandleFailedMessage(mqttMsg, errorMsg.Error(), "mqtt-to-kafka", mqttMsg.Topic, kafkaTopic)
-		}
+	// Send to Kafka, remembering the message so its record isn't echoed back to MQTT
+	b.loops.Forwarded(mqttMsg.Topic, mqttMsg.Payload)
+	record := &BatchedRecord{MQTTMessage: mqttMsg, KafkaMessage: kafkaMsg}
+	if b.batcher == nil {
+		b.writeRecord(record)
 		return
 	}
-	
-	log.Printf("✓ Forwarded MQTT message: %s -> %s", mqttMsg.Topic, kafkaTopic)
+	b.batcher.Add(record)
 }
 
-// Map MQTT topic to Kafka topic using configured rules
-func (b *MQTTToKafkaBridge) mapMQTTToKafkaTopic(mqttTopic string) string {
-	// Use strings.Builder for efficient string concatenation
-	var builder strings.Builder
-	
-	// Pre-allocate capacity (estimate: prefix + topic + separators)
-	builder.Grow(len(b.config.Bridge.Mapping.KafkaPrefix) + len(mqttTopic) + 10)
+// writeBatch writes a batch of converted messages to Kafka in a single write, committed in one
+// transaction by a transactional producer. If the write fails, the messages that weren't
+// written are written one by one, so refused topics and failures are handled per message.
+func (b *MQTTToKafkaBridge) writeBatch(records []*BatchedRecord) {
+	if len(records) == 1 {
+		b.writeRecord(records[0])
+		return
+	}
 	
-	// Add prefix
-	builder.WriteString(b.config.Bridge.Mapping.KafkaPrefix)
+	messages := make([]*types.KafkaMessage, len(records))
+	for i, record := range records {
+		messages[i] = record.KafkaMessage
+	}
 	
-	// Process topic levels directly without creating intermediate slices
-	maxLevels := b.config.Bridge.Mapping.MaxTopicLevels
-	levelCount := 0
-	startIdx := 0
+	err := b.kafkaProducer.WriteMessages(context.Background(), messages)
+	failed := make(map[int]bool)
+	for _, i := range kafka.FailedWrites(err, len(records)) {
+		failed[i] = true
+	}
+	for i, record := range records {
+		if !failed[i] {
+			log.Printf("✓ Forwarded MQTT message %s: %s -> %s", record.MQTTMessage.ID, record.MQTTMessage.Topic, record.KafkaMessage.Topic)
+		}
+	}
+	if len(failed) == 0 {
+		return
+	}
 	
-	for i := 0; i < len(mqttTopic); i++ {
-		if mqttTopic[i] == '/' {
-			if levelCount < maxLevels {
-				builder.WriteByte('.')
-				builder.WriteString(mqttTopic[startIdx:i])
-				levelCount++
-			}
-			startIdx = i + 1
+	// Messages a partial write stored are not written again, that would duplicate them
+	log.Printf("Failed to write %d of %d messages in a batch to Kafka, writing them one by one: %v", len(failed), len(records), err)
+	for i, record := range records {
+		if failed[i] {
+			b.writeRecord(record)
+		}
+	}
+}
+
+// writeRecord writes a single converted message to Kafka
+func (b *MQTTToKafkaBridge) writeRecord(record *BatchedRecord) {
+	mqttMsg, kafkaTopic := record.MQTTMessage, record.KafkaMessage.Topic
+	if err := b.kafkaProducer.WriteMessage(context.Background(), record.KafkaMessage); errors.Is(err, kafka.ErrTopicNotAllowed) {
+		b.handleRefusedTopic(mqttMsg, kafkaTopic, err)
+		return
+	} else if err != nil {
+		// The message ID stays out of the failure reason, dead letter records carry it
+		errorMsg := fmt.Errorf("failed to send message to Kafka topic %s: %w", kafkaTopic, err)
+		b.reportError(fmt.Errorf("message %s: %w", mqttMsg.ID, errorMsg))
+		if b.deadLetterQueue != nil {
+			b.deadLetterQueue.HandleError(mqttMsg, errorMsg, "mqtt-to-kafka", mqttMsg.Topic, kafkaTopic)
 		}
+		return
 	}
 	
-	// Handle the last segment (including empty segment from trailing slash)
-	if levelCount < maxLevels && startIdx <= len(mqttTopic) {
-		builder.WriteByte('.')
-		builder.WriteString(mqttTopic[startIdx:])
+	log.Printf("✓ Forwarded MQTT message %s: %s -> %s", mqttMsg.ID, mqttMsg.Topic, kafkaTopic)
+}
+
+// handleRefusedTopic applies the disallowed topic policy to a message whose Kafka topic the
+// topic guard refused. Messages redirected to the catch-all topic never get here.
+func (b *MQTTToKafkaBridge) handleRefusedTopic(mqttMsg *types.MQTTMessage, kafkaTopic string, err error) {
+	if b.config.Bridge.Kafka.Guard.DisallowedPolicy == kafka.DisallowedDrop {
+		log.Printf("Dropped MQTT message %s for refused topic: %s -> %s: %v", mqttMsg.ID, mqttMsg.Topic, kafkaTopic, err)
+		return
 	}
 	
-	kafkaTopic := builder.String()
+	log.Printf("Sending MQTT message %s for refused topic to dead letter queue: %s -> %s: %v", mqttMsg.ID, mqttMsg.Topic, kafkaTopic, err)
+	b.deadLetterQueue.SendToDeadLetter(mqttMsg, err.Error(), "mqtt-to-kafka", mqttMsg.Topic, kafkaTopic)
+}
+
+// convertMQTTToKafka converts an MQTT message for its mapped Kafka topic using the configured
+// envelope mode. When the topic name had to be truncated, the original MQTT topic is recorded
+// in a header for traceability.
+func convertMQTTToKafka(codec *kafka.Codec, mqttMsg *types.MQTTMessage, topicMapping mapping.TopicMapping) (*types.KafkaMessage, error) {
+	kafkaMsg, err := codec.Encode(mqttMsg, topicMapping.KafkaTopic)
+	if err != nil {
+		return nil, err
+	}
 	
-	// Ensure Kafka topic doesn't exceed maximum length (249 chars)
-	if len(kafkaTopic) > 249 {
-		kafkaTopic = kafkaTopic[:249]
-		// Remove trailing dot if present
-		if kafkaTopic[len(kafkaTopic)-1] == '.' {
-			kafkaTopic = kafkaTopic[:len(kafkaTopic)-1]
-		}
+	if _, exists := kafkaMsg.Header(kafka.HeaderMQTTTopic); topicMapping.Truncated && !exists {
+		kafkaMsg.Headers = append(kafkaMsg.Headers, types.KafkaHeader{
+			Key:   kafka.HeaderMQTTTopic,
+			Value: []byte(mqttMsg.Topic),
+		})
 	}
 	
-	return kafkaTopic
+	return kafkaMsg, nil
 }
 
 // reportError sends error to error channel for monitoring
@@ -196,6 +291,11 @@ func (b *MQTTToKafkaBridge) monitorErrors(ctx context.Context) {
 	}
 }
 
+// GetSkipCounts returns the number of messages skipped on purpose by reason
+func (b *MQTTToKafkaBridge) GetSkipCounts() map[string]uint64 {
+	return b.skips.Counts()
+}
+
 // GetErrorCount returns the current error count for monitoring
 func (b *MQTTToKafkaBridge) GetErrorCount() int {
 	return b.errorCount
@@ -0,0 +1,138 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gom2k/internal/kafka"
+	"gom2k/internal/mapping"
+	"gom2k/internal/mqtt"
+	"gom2k/pkg/types"
+)
+
+// ReplayFilter selects the failed messages to replay. Zero fields match everything.
+type ReplayFilter struct {
+	Direction string         // "mqtt-to-kafka" or "kafka-to-mqtt"
+	Topic     *regexp.Regexp // Matches the whole original or target topic
+	Since     time.Time      // Earliest last attempt
+	Until     time.Time      // Latest last attempt
+	Reason    string         // Part of the failure reason, case-insensitive
+}
+
+// Matches reports whether a failed message passes the filter
+func (f *ReplayFilter) Matches(failedMsg *types.FailedMessage) bool {
+	if f.Direction != "" && failedMsg.Direction != f.Direction {
+		return false
+	}
+	if f.Topic != nil && !f.Topic.MatchString(failedMsg.OriginalTopic) && !f.Topic.MatchString(failedMsg.TargetTopic) {
+		return false
+	}
+	if !f.Since.IsZero() && failedMsg.LastAttempt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && failedMsg.LastAttempt.After(f.Until) {
+		return false
+	}
+	return f.Reason == "" || strings.Contains(strings.ToLower(failedMsg.FailureReason), strings.ToLower(f.Reason))
+}
+
+// Replayer sends failed messages from the dead letter topics through the normal conversion
+// and produce/publish path again. The mapping rules and envelope of the current
+// configuration apply, so fixed configuration errors don't fail the replay.
+type Replayer struct {
+	kafkaProducer *kafka.Producer // May be nil without MQTT→Kafka messages to replay
+	mqttClient    *mqtt.Client    // May be nil without Kafka→MQTT messages to replay
+	topicMapper   *mapping.TopicMapper
+	reverseMapper *mapping.ReverseMapper
+	codec         *kafka.Codec
+	loops         *LoopDetector // Places replayed messages in the bridge namespace
+}
+
+// NewReplayer creates a replayer with the mapping and envelope settings of the bridge
+func NewReplayer(config *types.BridgeConfig, kafkaProducer *kafka.Producer, mqttClient *mqtt.Client) (*Replayer, error) {
+	reverseMapper, err := mapping.NewReverseMapper(config.Mapping.ReverseRules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reverse mapping rules: %w", err)
+	}
+	codec, err := kafka.NewCodec(&config.Envelope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid envelope config: %w", err)
+	}
+
+	return &Replayer{
+		kafkaProducer: kafkaProducer,
+		mqttClient:    mqttClient,
+		topicMapper:   mapping.NewTopicMapper(&config.Mapping),
+		reverseMapper: reverseMapper,
+		codec:         codec,
+		loops:         NewLoopDetector(&config.LoopPrevention, false),
+	}, nil
+}
+
+// Plan converts the original message of a failed message without sending it and returns
+// the topic it would be replayed to
+func (r *Replayer) Plan(failedMsg *types.FailedMessage) (string, error) {
+	kafkaMsg, mqttMsg, err := r.convert(failedMsg)
+	if err != nil {
+		return "", err
+	}
+	if kafkaMsg != nil {
+		return kafkaMsg.Topic, nil
+	}
+	return mqttMsg.Topic, nil
+}
+
+// Replay converts and sends the original message of a failed message and returns the
+// topic it was replayed to
+func (r *Replayer) Replay(ctx context.Context, failedMsg *types.FailedMessage) (string, error) {
+	kafkaMsg, mqttMsg, err := r.convert(failedMsg)
+	if err != nil {
+		return "", err
+	}
+
+	if kafkaMsg != nil {
+		if r.kafkaProducer == nil {
+			return kafkaMsg.Topic, fmt.Errorf("no Kafka producer to replay to")
+		}
+		if err := r.kafkaProducer.WriteMessage(ctx, kafkaMsg); err != nil {
+			return kafkaMsg.Topic, fmt.Errorf("failed to send to Kafka: %w", err)
+		}
+		return kafkaMsg.Topic, nil
+	}
+
+	if r.mqttClient == nil {
+		return mqttMsg.Topic, fmt.Errorf("no MQTT client to replay to")
+	}
+	if err := r.mqttClient.Publish(mqttMsg.Topic, mqttMsg.Payload, mqttMsg.QoS, mqttMsg.Retained); err != nil {
+		return mqttMsg.Topic, fmt.Errorf("failed to publish to MQTT: %w", err)
+	}
+	return mqttMsg.Topic, nil
+}
+
+// convert converts the original message for its direction. Exactly one of the returned
+// Kafka record and MQTT message is set.
+func (r *Replayer) convert(failedMsg *types.FailedMessage) (*types.KafkaMessage, *types.MQTTMessage, error) {
+	switch original := failedMsg.OriginalMessage.(type) {
+	case *types.MQTTMessage:
+		kafkaMsg, err := convertMQTTToKafka(r.codec, original, r.topicMapper.MapTopic(original.Topic))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to convert MQTT message: %w", err)
+		}
+		return kafkaMsg, nil, nil
+	case *types.KafkaMessage:
+		mqttMsg, err := convertKafkaToMQTT(r.codec, r.reverseMapper, original)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to convert Kafka message: %w", err)
+		}
+		mqttMsg.Topic = r.loops.PublishTopic(mqttMsg.Topic)
+		if err := mqtt.ValidateTopicName(mqttMsg.Topic); err != nil {
+			return nil, nil, err
+		}
+		return nil, mqttMsg, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported message type %T", failedMsg.OriginalMessage)
+	}
+}
@@ -0,0 +1,372 @@
+package bridge
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gom2k/pkg/types"
+)
+
+// RetryEntry is a failed message pending retry with its tracking key
+type RetryEntry struct {
+	Key     string
+	Message *types.FailedMessage
+}
+
+// RetryStore keeps failed messages pending retry. The dead letter queue serializes
+// access, so implementations don't have to be thread-safe.
+type RetryStore interface {
+	Get(key string) (*types.FailedMessage, bool)
+	Put(key string, msg *types.FailedMessage) error
+	Delete(key string) error
+	List() []RetryEntry // Oldest first failure first
+	Len() int
+	Close() error
+}
+
+// MemoryRetryStore keeps pending retries in memory
+type MemoryRetryStore struct {
+	entries map[string]*types.FailedMessage
+}
+
+// NewMemoryRetryStore creates an empty in-memory retry store
+func NewMemoryRetryStore() *MemoryRetryStore {
+	return &MemoryRetryStore{entries: make(map[string]*types.FailedMessage)}
+}
+
+// Get returns the pending message with the given key
+func (s *MemoryRetryStore) Get(key string) (*types.FailedMessage, bool) {
+	msg, exists := s.entries[key]
+	return msg, exists
+}
+
+// Put adds or updates a pending message
+func (s *MemoryRetryStore) Put(key string, msg *types.FailedMessage) error {
+	s.entries[key] = msg
+	return nil
+}
+
+// Delete removes a pending message
+func (s *MemoryRetryStore) Delete(key string) error {
+	delete(s.entries, key)
+	return nil
+}
+
+// List returns all pending messages, oldest first failure first
+func (s *MemoryRetryStore) List() []RetryEntry {
+	return sortedEntries(s.entries)
+}
+
+// Len returns the number of pending messages
+func (s *MemoryRetryStore) Len() int {
+	return len(s.entries)
+}
+
+// Close releases nothing, pending messages are lost
+func (s *MemoryRetryStore) Close() error {
+	return nil
+}
+
+// FileRetryStore keeps pending retries in an append-only file of JSON records, one per
+// line. Every change appends a record, and the file is rewritten with only the pending
+// messages when it has grown well beyond them. Opening the file replays the records, so
+// retries survive restarts and process crashes. A record cut short by a crash is skipped.
+type FileRetryStore struct {
+	path    string
+	file    *os.File
+	entries map[string]*types.FailedMessage
+	records int // Records in the file, including superseded ones
+}
+
+// retryRecord is a line of the retry store file. The original message is stored in the
+// field of its type, so it can be restored for retries.
+type retryRecord struct {
+	Key     string               `json:"key"`
+	Deleted bool                 `json:"deleted,omitempty"`
+	Message *types.FailedMessage `json:"message,omitempty"`
+	MQTT    *types.MQTTMessage   `json:"mqtt,omitempty"`
+	Kafka   *types.KafkaMessage  `json:"kafka,omitempty"`
+}
+
+// compactionSlack is how many superseded records the file may hold before it is rewritten
+const compactionSlack = 1000
+
+// OpenFileRetryStore opens or creates a retry store file and loads its pending messages
+func OpenFileRetryStore(path string) (*FileRetryStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create retry store directory: %w", err)
+	}
+
+	store := &FileRetryStore{
+		path:    path,
+		entries: make(map[string]*types.FailedMessage),
+	}
+
+	corrupt, err := store.load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Rewriting drops corrupt records, so new records don't get appended to a partial line
+	if corrupt > 0 || store.records > len(store.entries)+compactionSlack {
+		if corrupt > 0 {
+			log.Printf("Warning: skipped %d corrupt records in retry store %s", corrupt, path)
+		}
+		if err := store.compact(); err != nil {
+			store.Close()
+			return nil, err
+		}
+	} else if err := store.openForAppend(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// load replays the records of the store file and returns the number of corrupt records
+func (s *FileRetryStore) load() (int, error) {
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open retry store: %w", err)
+	}
+	defer file.Close()
+
+	corrupt := 0
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			s.records++
+			if decodeErr := s.apply(line); decodeErr != nil {
+				corrupt++
+			}
+		}
+		if err == io.EOF {
+			return corrupt, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read retry store: %w", err)
+		}
+	}
+}
+
+// apply decodes a record and applies it to the pending messages
+func (s *FileRetryStore) apply(line []byte) error {
+	var record retryRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return err
+	}
+	if record.Key == "" {
+		return fmt.Errorf("record without key")
+	}
+
+	if record.Deleted {
+		delete(s.entries, record.Key)
+		return nil
+	}
+	if record.Message == nil {
+		return fmt.Errorf("record %s without message", record.Key)
+	}
+
+	msg := record.Message
+	switch {
+	case record.MQTT != nil:
+		msg.OriginalMessage = record.MQTT
+	case record.Kafka != nil:
+		msg.OriginalMessage = record.Kafka
+	}
+	s.entries[record.Key] = msg
+	return nil
+}
+
+// Get returns the pending message with the given key
+func (s *FileRetryStore) Get(key string) (*types.FailedMessage, bool) {
+	msg, exists := s.entries[key]
+	return msg, exists
+}
+
+// Put adds or updates a pending message
+func (s *FileRetryStore) Put(key string, msg *types.FailedMessage) error {
+	record, err := newRetryRecord(key, msg)
+	if err != nil {
+		return err
+	}
+	if err := s.append(record); err != nil {
+		return err
+	}
+	s.entries[key] = msg
+	return s.compactIfNeeded()
+}
+
+// Delete removes a pending message
+func (s *FileRetryStore) Delete(key string) error {
+	if _, exists := s.entries[key]; !exists {
+		return nil
+	}
+	if err := s.append(retryRecord{Key: key, Deleted: true}); err != nil {
+		return err
+	}
+	delete(s.entries, key)
+	return s.compactIfNeeded()
+}
+
+// List returns all pending messages, oldest first failure first
+func (s *FileRetryStore) List() []RetryEntry {
+	return sortedEntries(s.entries)
+}
+
+// Len returns the number of pending messages
+func (s *FileRetryStore) Len() int {
+	return len(s.entries)
+}
+
+// Close closes the store file, pending messages are loaded again on the next open
+func (s *FileRetryStore) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// append writes a record to the end of the store file
+func (s *FileRetryStore) append(record retryRecord) error {
+	if s.file == nil {
+		return fmt.Errorf("retry store %s is closed", s.path)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode retry record: %w", err)
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write retry store: %w", err)
+	}
+	s.records++
+	return nil
+}
+
+// compactIfNeeded rewrites the store file once it holds many superseded records
+func (s *FileRetryStore) compactIfNeeded() error {
+	if s.records <= 2*len(s.entries)+compactionSlack {
+		return nil
+	}
+	return s.compact()
+}
+
+// compact rewrites the store file with only the pending messages. The new file replaces
+// the old one atomically, so a crash leaves either of them intact. If the rewrite fails,
+// records are appended to the old file again.
+func (s *FileRetryStore) compact() error {
+	records := s.records
+	err := s.rewrite()
+	if err != nil && s.file == nil {
+		s.records = records
+		if openErr := s.openForAppend(); openErr != nil {
+			log.Printf("Warning: %v", openErr)
+		}
+	}
+	return err
+}
+
+// rewrite replaces the store file with one holding only the pending messages and opens it
+// for appending
+func (s *FileRetryStore) rewrite() error {
+	if err := s.Close(); err != nil {
+		return fmt.Errorf("failed to close retry store: %w", err)
+	}
+
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create retry store: %w", err)
+	}
+
+	s.file = tmp
+	s.records = 0
+	for _, entry := range s.List() {
+		record, err := newRetryRecord(entry.Key, entry.Message)
+		if err == nil {
+			err = s.append(record)
+		}
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			s.file = nil
+			return err
+		}
+	}
+	s.file = nil
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to sync retry store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close retry store: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace retry store: %w", err)
+	}
+
+	return s.openForAppend()
+}
+
+// newRetryRecord creates the record of a pending message. The original message is stored
+// in the field of its type, the copy of the failed message leaves it out.
+func newRetryRecord(key string, msg *types.FailedMessage) (retryRecord, error) {
+	record := retryRecord{Key: key}
+	switch original := msg.OriginalMessage.(type) {
+	case *types.MQTTMessage:
+		record.MQTT = original
+	case *types.KafkaMessage:
+		record.Kafka = original
+	default:
+		return record, fmt.Errorf("unsupported message type %T", msg.OriginalMessage)
+	}
+
+	stored := *msg
+	stored.OriginalMessage = nil
+	record.Message = &stored
+	return record, nil
+}
+
+// openForAppend opens the store file for appending records
+func (s *FileRetryStore) openForAppend() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open retry store: %w", err)
+	}
+	s.file = file
+	return nil
+}
+
+// sortedEntries orders pending messages by first failure, then by key
+func sortedEntries(entries map[string]*types.FailedMessage) []RetryEntry {
+	list := make([]RetryEntry, 0, len(entries))
+	for key, msg := range entries {
+		list = append(list, RetryEntry{Key: key, Message: msg})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Message.FirstFailure.Equal(list[j].Message.FirstFailure) {
+			return list[i].Message.FirstFailure.Before(list[j].Message.FirstFailure)
+		}
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
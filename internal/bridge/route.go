@@ -0,0 +1,140 @@
+package bridge
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gom2k/internal/kafka"
+	"gom2k/internal/mapping"
+	"gom2k/internal/mqtt"
+	"gom2k/internal/sparkplug"
+	"gom2k/pkg/types"
+)
+
+// MQTTRoute describes what the MQTT→Kafka direction does with the messages of a topic
+type MQTTRoute struct {
+	KafkaTopic string // Empty for skipped messages
+	Key        string // Kafka record key
+	Rule       string // The rule deciding the route
+	Mapping    mapping.TopicMapping
+}
+
+// MQTTRouter works out the routes of MQTT topics without connecting to MQTT or Kafka. It
+// applies the ignore list, loop namespace, Sparkplug keying, topic mapping, envelope and
+// topic guard in the order the MQTT→Kafka direction does.
+type MQTTRouter struct {
+	config *types.BridgeConfig
+	mapper *mapping.TopicMapper
+	codec  *kafka.Codec
+	ignore *mqtt.IgnoreList
+	loops  *LoopDetector
+	guard  *kafka.TopicGuard
+}
+
+// NewMQTTRouter creates a router for the bridge settings
+func NewMQTTRouter(config *types.BridgeConfig) (*MQTTRouter, error) {
+	codec, err := kafka.NewCodec(&config.Envelope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid envelope config: %w", err)
+	}
+	ignore, err := mqtt.NewIgnoreList(config.Ignore.MQTTToKafka)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ignore list: %w", err)
+	}
+	guard, err := kafka.NewTopicGuard(&config.Kafka.Guard, config.DeadLetter.KafkaTopic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid topic guard: %w", err)
+	}
+
+	return &MQTTRouter{
+		config: config,
+		mapper: mapping.NewTopicMapper(&config.Mapping),
+		codec:  codec,
+		ignore: ignore,
+		loops:  NewLoopDetector(&config.LoopPrevention, false),
+		guard:  guard,
+	}, nil
+}
+
+// Route returns the route of messages on an MQTT topic
+func (r *MQTTRouter) Route(mqttTopic string) (*MQTTRoute, error) {
+	if filter, ignored := r.ignore.Match(mqttTopic); ignored {
+		return &MQTTRoute{Rule: "ignored by filter " + filter}, nil
+	}
+	if r.loops.IsEcho(mqttTopic, nil) {
+		return &MQTTRoute{Rule: "skipped, in loop prevention namespace " + r.config.LoopPrevention.Namespace}, nil
+	}
+
+	route := &MQTTRoute{}
+	if topic, ok := r.sparkplugTopic(mqttTopic); ok {
+		route.Mapping = sparkplugMapping(r.mapper, topic)
+		route.Key = topic.Key()
+		route.Rule = fmt.Sprintf("sparkplug group %s, keyed by edge node and device", topic.GroupID)
+	} else {
+		route.Mapping = r.mapper.MapTopic(mqttTopic)
+		key, err := r.key(mqttTopic, route.Mapping)
+		if err != nil {
+			return nil, err
+		}
+		route.Key = key
+		route.Rule = r.describeMapping(route.Mapping)
+	}
+	route.KafkaTopic = route.Mapping.KafkaTopic
+
+	if err := r.guard.Check(route.KafkaTopic); errors.Is(err, kafka.ErrTopicNotAllowed) {
+		switch r.guard.Policy() {
+		case kafka.DisallowedCatchAll:
+			route.KafkaTopic = r.guard.CatchAllTopic()
+			route.Rule += ", refused by topic guard, sent to catch-all topic"
+		case kafka.DisallowedDrop:
+			route.KafkaTopic = ""
+			route.Rule += ", refused by topic guard, dropped"
+		default:
+			route.KafkaTopic = ""
+			route.Rule += ", refused by topic guard, sent to dead letter queue"
+		}
+	}
+	return route, nil
+}
+
+// sparkplugTopic parses Sparkplug B topics if Sparkplug decoding is enabled
+func (r *MQTTRouter) sparkplugTopic(mqttTopic string) (sparkplug.Topic, bool) {
+	if !r.config.Sparkplug.Enabled || !sparkplug.IsSparkplugTopic(mqttTopic) {
+		return sparkplug.Topic{}, false
+	}
+	topic, err := sparkplug.ParseTopic(mqttTopic)
+	return topic, err == nil
+}
+
+// key returns the record key of a message on the topic. Schema-based envelopes aren't
+// encoded, since that may register schemas.
+func (r *MQTTRouter) key(mqttTopic string, topicMapping mapping.TopicMapping) (string, error) {
+	mqttMsg := &types.MQTTMessage{Topic: mqttTopic, Timestamp: time.Now()}
+	if r.codec.SchemaBased() {
+		return r.codec.Key(mqttMsg), nil
+	}
+	kafkaMsg, err := convertMQTTToKafka(r.codec, mqttMsg, topicMapping)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert message on %s: %w", mqttTopic, err)
+	}
+	return kafkaMsg.Key, nil
+}
+
+// describeMapping summarizes the mapping settings applied to a topic
+func (r *MQTTRouter) describeMapping(topicMapping mapping.TopicMapping) string {
+	mappingConfig := &r.config.Mapping
+	rule := fmt.Sprintf("prefix %q, max %d levels", mappingConfig.KafkaPrefix, mappingConfig.MaxTopicLevels)
+	if topicMapping.Sanitized {
+		rule += fmt.Sprintf(", sanitized (%s)", mappingConfig.Sanitize)
+	}
+	if topicMapping.Truncated {
+		rule += fmt.Sprintf(", truncated (%s)", mappingConfig.Truncation)
+	}
+	return rule
+}
+
+// sparkplugMapping maps a Sparkplug B topic to the Kafka topic of its group
+func sparkplugMapping(mapper *mapping.TopicMapper, topic sparkplug.Topic) mapping.TopicMapping {
+	return mapper.MapTopic(sparkplug.Namespace + "/" + topic.GroupID)
+}
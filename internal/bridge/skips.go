@@ -0,0 +1,54 @@
+package bridge
+
+import (
+	"log"
+	"sync"
+)
+
+// Reasons for skipped messages, used as keys of the skip counts
+const (
+	SkipIgnored = "ignored" // The MQTT topic matches an ignore filter
+	SkipLoop    = "loop"    // The message would be forwarded in circles
+)
+
+// SkipCounter counts messages skipped on purpose. Only the first skip of each reason and
+// detail, such as the matching ignore filter, is logged, later ones are only counted.
+// This type is thread-safe.
+type SkipCounter struct {
+	mutex  sync.Mutex
+	counts map[string]uint64
+	logged map[string]bool
+}
+
+// NewSkipCounter creates an empty skip counter
+func NewSkipCounter() *SkipCounter {
+	return &SkipCounter{
+		counts: make(map[string]uint64),
+		logged: make(map[string]bool),
+	}
+}
+
+// Count records a skipped message. The detail describes why and distinguishes log entries
+// of the same reason.
+func (c *SkipCounter) Count(reason string, detail string, topic string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.counts[reason]++
+	if key := reason + "|" + detail; !c.logged[key] {
+		c.logged[key] = true
+		log.Printf("Skipping message on %s: %s, further skips are only counted", topic, detail)
+	}
+}
+
+// Counts returns the number of skipped messages by reason
+func (c *SkipCounter) Counts() map[string]uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	counts := make(map[string]uint64, len(c.counts))
+	for reason, count := range c.counts {
+		counts[reason] = count
+	}
+	return counts
+}
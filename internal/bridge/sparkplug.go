@@ -0,0 +1,63 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"gom2k/internal/kafka"
+	"gom2k/internal/sparkplug"
+	"gom2k/pkg/types"
+)
+
+// handleSparkplugMessage decodes a Sparkplug B message and forwards its metrics to the
+// Kafka topic of the Sparkplug group. Decoded records depend on the alias and sequence
+// state of the edge node at the time they arrive, so failures are reported instead of
+// being retried through the dead letter queue.
+func (b *MQTTToKafkaBridge) handleSparkplugMessage(mqttMsg *types.MQTTMessage) {
+	result, err := b.sparkplugDecoder.Decode(mqttMsg.Topic, mqttMsg.Payload, mqttMsg.Timestamp)
+	if err != nil {
+		b.reportError(fmt.Errorf("failed to decode Sparkplug message from topic %s: %w", mqttMsg.Topic, err))
+		return
+	}
+
+	if result.RebirthTopic != "" {
+		// Sparkplug commands are published with QoS 0 and without retain
+		if err := b.mqttClient.Publish(result.RebirthTopic, result.RebirthPayload, 0, false); err != nil {
+			b.reportError(fmt.Errorf("failed to send Sparkplug rebirth request to %s: %w", result.RebirthTopic, err))
+		}
+	}
+
+	if len(result.Records) == 0 {
+		return
+	}
+
+	topic, _ := sparkplug.ParseTopic(mqttMsg.Topic)
+	kafkaTopic := sparkplugMapping(b.topicMapper, topic).KafkaTopic
+
+	messages := make([]*types.KafkaMessage, 0, len(result.Records))
+	for _, record := range result.Records {
+		messages = append(messages, &types.KafkaMessage{
+			Key:   record.Key,
+			Value: record.Value,
+			Topic: kafkaTopic,
+			Headers: []types.KafkaHeader{
+				{Key: kafka.HeaderEnvelope, Value: []byte(kafka.EnvelopeSparkplug)},
+				{Key: kafka.HeaderMQTTTopic, Value: []byte(mqttMsg.Topic)},
+				{Key: kafka.HeaderMessageID, Value: []byte(mqttMsg.ID)},
+			},
+		})
+	}
+
+	if err := b.kafkaProducer.WriteMessages(context.Background(), messages); errors.Is(err, kafka.ErrTopicNotAllowed) {
+		// Sparkplug records don't go to the dead letter queue, so refused records are dropped
+		log.Printf("Dropped Sparkplug records of message %s for refused topic: %s -> %s: %v", mqttMsg.ID, mqttMsg.Topic, kafkaTopic, err)
+		return
+	} else if err != nil {
+		b.reportError(fmt.Errorf("failed to send Sparkplug records of message %s to Kafka topic %s: %w", mqttMsg.ID, kafkaTopic, err))
+		return
+	}
+
+	log.Printf("✓ Forwarded Sparkplug %s %s: %s -> %s (%d records)", topic.MessageType, mqttMsg.ID, mqttMsg.Topic, kafkaTopic, len(messages))
+}
@@ -8,10 +8,17 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	"gom2k/internal/kafka"
+	"gom2k/internal/mapping"
+	"gom2k/internal/mqtt"
+	"gom2k/internal/schema"
+	"gom2k/internal/sparkplug"
 	"gom2k/pkg/types"
 	"gom2k/pkg/validation"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
@@ -54,7 +61,9 @@ func LoadFromFile(configPath string) (*types.Config, error) {
 	}
 	
 	// Fix viper boolean unmarshaling issues
-	applyViperWorkarounds(viperInstance, config)
+	if err := applyViperWorkarounds(viperInstance, config); err != nil {
+		return nil, err
+	}
 	
 	// Apply defaults and validate
 	applyDefaults(config)
@@ -102,7 +111,9 @@ func LoadForTesting(configPath string) (*types.Config, error) {
 	}
 	
 	// Fix viper boolean unmarshaling issues
-	applyViperWorkarounds(testViperInstance, config)
+	if err := applyViperWorkarounds(testViperInstance, config); err != nil {
+		return nil, err
+	}
 	
 	// Apply defaults and validate in test mode (skips SSL file validation)
 	applyDefaults(config)
@@ -137,23 +148,127 @@ func GetConfigPath() string {
 
 // applyDefaults sets default values for configuration fields
 func applyDefaults(config *types.Config) {
+	if config.Bridge.InstanceID == "" {
+		config.Bridge.InstanceID = defaultInstanceID()
+	}
 	if config.Bridge.Mapping.KafkaPrefix == "" {
 		config.Bridge.Mapping.KafkaPrefix = "gom2k"
 	}
 	if config.Bridge.Mapping.MaxTopicLevels == 0 {
 		config.Bridge.Mapping.MaxTopicLevels = 3
 	}
+	if config.Bridge.Mapping.Sanitize == "" {
+		config.Bridge.Mapping.Sanitize = mapping.SanitizeReplace
+	}
+	if config.Bridge.Mapping.Replacement == "" {
+		config.Bridge.Mapping.Replacement = "_"
+	}
+	if config.Bridge.Mapping.Truncation == "" {
+		config.Bridge.Mapping.Truncation = mapping.TruncateSlice
+	}
+	if config.Bridge.Envelope.Mode == "" {
+		config.Bridge.Envelope.Mode = kafka.EnvelopeJSON
+	}
+	if config.Bridge.Envelope.PayloadEncoding == "" {
+		config.Bridge.Envelope.PayloadEncoding = types.PayloadEncodingAuto
+	}
+	if config.Bridge.Envelope.CloudEvents.ContentMode == "" {
+		config.Bridge.Envelope.CloudEvents.ContentMode = kafka.CloudEventsStructured
+	}
+	if config.Bridge.Envelope.CloudEvents.Source == "" {
+		config.Bridge.Envelope.CloudEvents.Source = "/gom2k/" + config.Bridge.InstanceID
+	}
+	if config.Bridge.Envelope.CloudEvents.Type == "" {
+		config.Bridge.Envelope.CloudEvents.Type = kafka.DefaultCloudEventType
+	}
+	if config.Bridge.Envelope.Schema.Target == "" {
+		config.Bridge.Envelope.Schema.Target = schema.TargetEnvelope
+	}
+	if config.Bridge.Envelope.Schema.SubjectStrategy == "" {
+		config.Bridge.Envelope.Schema.SubjectStrategy = schema.SubjectTopic
+	}
+	if config.Bridge.Envelope.Schema.Timeout == 0 {
+		config.Bridge.Envelope.Schema.Timeout = 10 * time.Second
+	}
+	if config.Bridge.Sparkplug.Output == "" {
+		config.Bridge.Sparkplug.Output = sparkplug.OutputMetric
+	}
+	if config.Bridge.Sparkplug.RebirthInterval == 0 {
+		config.Bridge.Sparkplug.RebirthInterval = 30 * time.Second
+	}
+	if config.Bridge.DeadLetter.MaxRetryInterval == 0 {
+		config.Bridge.DeadLetter.MaxRetryInterval = types.DefaultMaxRetryInterval
+		if config.Bridge.DeadLetter.RetryInterval > types.DefaultMaxRetryInterval {
+			config.Bridge.DeadLetter.MaxRetryInterval = config.Bridge.DeadLetter.RetryInterval
+		}
+	}
+	if config.Bridge.DeadLetter.Store.Type == "" {
+		config.Bridge.DeadLetter.Store.Type = types.RetryStoreMemory
+	}
+	if config.Bridge.DeadLetter.Store.MaxMessages == 0 {
+		config.Bridge.DeadLetter.Store.MaxMessages = types.DefaultMaxPendingRetries
+	}
+	if config.Bridge.DeadLetter.Store.Overflow == "" {
+		config.Bridge.DeadLetter.Store.Overflow = types.OverflowDeadLetter
+	}
+	if config.Kafka.Producer.RequiredAcks == "" {
+		config.Kafka.Producer.RequiredAcks = "all"
+	}
+	if config.Kafka.Producer.MaxAttempts == 0 {
+		config.Kafka.Producer.MaxAttempts = 10
+	}
+	if config.Kafka.Producer.WriteTimeout == 0 {
+		config.Kafka.Producer.WriteTimeout = 10 * time.Second
+	}
+	if config.Kafka.Producer.BatchBytes == 0 {
+		config.Kafka.Producer.BatchBytes = 1048576
+	}
+	if config.Kafka.Producer.BatchSize == 0 {
+		config.Kafka.Producer.BatchSize = 1
+	}
+	if config.Kafka.Producer.BatchLinger == 0 {
+		config.Kafka.Producer.BatchLinger = 10 * time.Millisecond
+	}
+	if config.Kafka.Producer.Transactional && config.Kafka.Producer.TransactionalID == "" {
+		config.Kafka.Producer.TransactionalID = "gom2k-" + config.Bridge.InstanceID
+	}
+	if config.Kafka.Producer.TransactionTimeout == 0 {
+		config.Kafka.Producer.TransactionTimeout = 60 * time.Second
+	}
 	if config.Bridge.Kafka.DefaultPartitions == 0 {
 		config.Bridge.Kafka.DefaultPartitions = 3
 	}
 	if config.Bridge.Kafka.ReplicationFactor == 0 {
 		config.Bridge.Kafka.ReplicationFactor = 1
 	}
+	if config.Bridge.Kafka.CreationTimeout == 0 {
+		config.Bridge.Kafka.CreationTimeout = kafka.DefaultTopicCreationTimeout
+	}
+	if config.Bridge.Kafka.Guard.CreationWindow == 0 {
+		config.Bridge.Kafka.Guard.CreationWindow = kafka.DefaultCreationWindow
+	}
+	if config.Bridge.Kafka.Guard.DisallowedPolicy == "" {
+		config.Bridge.Kafka.Guard.DisallowedPolicy = kafka.DisallowedDLQ
+	}
+	if config.Bridge.LoopPrevention.FingerprintTTL == 0 {
+		config.Bridge.LoopPrevention.FingerprintTTL = time.Minute
+	}
+	if config.Bridge.Ignore.KafkaToMQTT == nil {
+		config.Bridge.Ignore.KafkaToMQTT = append([]string(nil), mqtt.DefaultKafkaToMQTTIgnore...)
+	}
 	// QoS defaults to 0 (no explicit setting needed)
 }
 
+// defaultInstanceID identifies the bridge by hostname when no instance_id is configured
+func defaultInstanceID() string {
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
+	}
+	return "gom2k"
+}
+
 // applyViperWorkarounds fixes viper's boolean and nested struct unmarshaling issues
-func applyViperWorkarounds(v *viper.Viper, config *types.Config) {
+func applyViperWorkarounds(v *viper.Viper, config *types.Config) error {
 	// Boolean unmarshaling fixes
 	if v.IsSet("bridge.features.mqtt_to_kafka") {
 		config.Bridge.Features.MQTTToKafka = v.GetBool("bridge.features.mqtt_to_kafka")
@@ -163,6 +278,9 @@ func applyViperWorkarounds(v *viper.Viper, config *types.Config) {
 	}
 	
 	// Nested structure unmarshaling fixes
+	if v.IsSet("bridge.instance_id") {
+		config.Bridge.InstanceID = v.GetString("bridge.instance_id")
+	}
 	if v.IsSet("kafka.consumer.group_id") {
 		config.Kafka.Consumer.GroupID = v.GetString("kafka.consumer.group_id")
 	}
@@ -175,6 +293,70 @@ func applyViperWorkarounds(v *viper.Viper, config *types.Config) {
 	if v.IsSet("bridge.kafka.replication_factor") {
 		config.Bridge.Kafka.ReplicationFactor = v.GetInt("bridge.kafka.replication_factor")
 	}
+	if v.IsSet("bridge.kafka.creation_timeout") {
+		config.Bridge.Kafka.CreationTimeout = v.GetDuration("bridge.kafka.creation_timeout")
+	}
+	
+	// Mapping settings are snake_case throughout, decode them using their yaml tags
+	if v.IsSet("bridge.mapping") {
+		if err := unmarshalYAMLKey(v, "bridge.mapping", &config.Bridge.Mapping); err != nil {
+			return fmt.Errorf("failed to unmarshal mapping config: %w", err)
+		}
+	}
+	if v.IsSet("bridge.kafka.topic_rules") {
+		if err := unmarshalYAMLKey(v, "bridge.kafka.topic_rules", &config.Bridge.Kafka.TopicRules); err != nil {
+			return fmt.Errorf("failed to unmarshal topic rules: %w", err)
+		}
+	}
+	if v.IsSet("bridge.kafka.guard") {
+		if err := unmarshalYAMLKey(v, "bridge.kafka.guard", &config.Bridge.Kafka.Guard); err != nil {
+			return fmt.Errorf("failed to unmarshal topic guard config: %w", err)
+		}
+	}
+	if v.IsSet("bridge.loop_prevention") {
+		if err := unmarshalYAMLKey(v, "bridge.loop_prevention", &config.Bridge.LoopPrevention); err != nil {
+			return fmt.Errorf("failed to unmarshal loop prevention config: %w", err)
+		}
+	}
+	if v.IsSet("bridge.ignore") {
+		if err := unmarshalYAMLKey(v, "bridge.ignore", &config.Bridge.Ignore); err != nil {
+			return fmt.Errorf("failed to unmarshal ignore config: %w", err)
+		}
+	}
+	if v.IsSet("bridge.sparkplug") {
+		if err := unmarshalYAMLKey(v, "bridge.sparkplug", &config.Bridge.Sparkplug); err != nil {
+			return fmt.Errorf("failed to unmarshal sparkplug config: %w", err)
+		}
+	}
+	if v.IsSet("bridge.dead_letter") {
+		if err := unmarshalYAMLKey(v, "bridge.dead_letter", &config.Bridge.DeadLetter); err != nil {
+			return fmt.Errorf("failed to unmarshal dead letter config: %w", err)
+		}
+	}
+	// A retry_jitter of 0 turns jitter off, so only a missing one gets the default
+	if !v.IsSet("bridge.dead_letter.retry_jitter") {
+		config.Bridge.DeadLetter.RetryJitter = types.DefaultRetryJitter
+	}
+	if v.IsSet("kafka.producer") {
+		if err := unmarshalYAMLKey(v, "kafka.producer", &config.Kafka.Producer); err != nil {
+			return fmt.Errorf("failed to unmarshal producer config: %w", err)
+		}
+	}
+	if v.IsSet("bridge.envelope") {
+		if err := unmarshalYAMLKey(v, "bridge.envelope", &config.Bridge.Envelope); err != nil {
+			return fmt.Errorf("failed to unmarshal envelope config: %w", err)
+		}
+	}
+	
+	return nil
+}
+
+// unmarshalYAMLKey decodes a config key into a struct using yaml tags instead of
+// viper's default field name matching, which doesn't understand snake_case keys
+func unmarshalYAMLKey(v *viper.Viper, key string, target interface{}) error {
+	return v.UnmarshalKey(key, target, func(decoderConfig *mapstructure.DecoderConfig) {
+		decoderConfig.TagName = "yaml"
+	})
 }
 
 // validate checks configuration for required fields and logical consistency
@@ -255,5 +437,159 @@ func validate(config *types.Config, testMode bool) error {
 		return fmt.Errorf("at least one bridge direction must be enabled")
 	}
 	
+	// Validate topic mapping and sanitization settings
+	if !mapping.IsLegalTopicName(config.Bridge.Mapping.KafkaPrefix) {
+		return fmt.Errorf("kafka_prefix %q contains characters that are illegal in Kafka topic names", config.Bridge.Mapping.KafkaPrefix)
+	}
+	switch config.Bridge.Mapping.Sanitize {
+	case "", mapping.SanitizeReplace, mapping.SanitizeEncode, mapping.SanitizeDrop:
+	default:
+		return fmt.Errorf("unknown mapping sanitize policy %q (expected replace, encode or drop)", config.Bridge.Mapping.Sanitize)
+	}
+	switch config.Bridge.Mapping.Truncation {
+	case "", mapping.TruncateSlice, mapping.TruncateHash:
+	default:
+		return fmt.Errorf("unknown mapping truncation strategy %q (expected slice or hash)", config.Bridge.Mapping.Truncation)
+	}
+	if !mapping.IsLegalTopicName(config.Bridge.Mapping.Replacement) {
+		return fmt.Errorf("mapping replacement %q contains characters that are illegal in Kafka topic names", config.Bridge.Mapping.Replacement)
+	}
+	
+	// Validate envelope settings
+	switch config.Bridge.Envelope.Mode {
+	case "", kafka.EnvelopeJSON, kafka.EnvelopeRaw, kafka.EnvelopeCloudEvents:
+	case kafka.EnvelopeAvro, kafka.EnvelopeProtobuf:
+		if config.Bridge.Envelope.Schema.RegistryURL == "" {
+			return fmt.Errorf("envelope mode %s requires bridge.envelope.schema.registry_url", config.Bridge.Envelope.Mode)
+		}
+	default:
+		return fmt.Errorf("unknown envelope mode %q (expected json, raw, cloudevents, avro or protobuf)", config.Bridge.Envelope.Mode)
+	}
+	switch config.Bridge.Envelope.Schema.Target {
+	case "", schema.TargetEnvelope, schema.TargetPayload:
+	default:
+		return fmt.Errorf("unknown schema target %q (expected envelope or payload)", config.Bridge.Envelope.Schema.Target)
+	}
+	if _, err := schema.SubjectName(config.Bridge.Envelope.Schema.SubjectStrategy, "", ""); err != nil {
+		return fmt.Errorf("%w (expected topic, record or topic_record)", err)
+	}
+	switch config.Bridge.Envelope.CloudEvents.ContentMode {
+	case "", kafka.CloudEventsStructured, kafka.CloudEventsBinary:
+	default:
+		return fmt.Errorf("unknown CloudEvents content mode %q (expected structured or binary)", config.Bridge.Envelope.CloudEvents.ContentMode)
+	}
+	switch config.Bridge.Envelope.PayloadEncoding {
+	case "", types.PayloadEncodingAuto, types.PayloadEncodingBase64:
+	default:
+		return fmt.Errorf("unknown payload encoding %q (expected auto or base64)", config.Bridge.Envelope.PayloadEncoding)
+	}
+	
+	// Validate producer delivery settings
+	if _, err := kafka.ParseRequiredAcks(config.Kafka.Producer.RequiredAcks); err != nil {
+		return fmt.Errorf("invalid kafka.producer.required_acks: %w", err)
+	}
+	if config.Kafka.Producer.MaxAttempts < 0 {
+		return fmt.Errorf("kafka.producer.max_attempts must not be negative, got %d", config.Kafka.Producer.MaxAttempts)
+	}
+	if config.Kafka.Producer.WriteTimeout < 0 {
+		return fmt.Errorf("kafka.producer.write_timeout must not be negative, got %v", config.Kafka.Producer.WriteTimeout)
+	}
+	if config.Kafka.Producer.BatchBytes < 0 {
+		return fmt.Errorf("kafka.producer.batch_bytes must not be negative, got %d", config.Kafka.Producer.BatchBytes)
+	}
+	if config.Kafka.Producer.BatchSize < 0 {
+		return fmt.Errorf("kafka.producer.batch_size must not be negative, got %d", config.Kafka.Producer.BatchSize)
+	}
+	if config.Kafka.Producer.BatchLinger < 0 {
+		return fmt.Errorf("kafka.producer.batch_linger must not be negative, got %v", config.Kafka.Producer.BatchLinger)
+	}
+	
+	if config.Kafka.Producer.Transactional {
+		if config.Kafka.Producer.RequiredAcks != "" && config.Kafka.Producer.RequiredAcks != "all" {
+			return fmt.Errorf("kafka.producer.transactional requires required_acks all, got %q", config.Kafka.Producer.RequiredAcks)
+		}
+		if config.Kafka.Producer.TransactionTimeout < 0 {
+			return fmt.Errorf("kafka.producer.transaction_timeout must not be negative, got %v", config.Kafka.Producer.TransactionTimeout)
+		}
+	}
+	
+	// Validate compression settings
+	if _, err := kafka.ParseCompression(config.Kafka.Producer.Compression); err != nil {
+		return fmt.Errorf("invalid kafka.producer.compression: %w", err)
+	}
+	if _, err := kafka.ParseCompression(config.Bridge.DeadLetter.Compression); err != nil {
+		return fmt.Errorf("invalid bridge.dead_letter.compression: %w", err)
+	}
+	
+	// Validate Sparkplug settings
+	switch config.Bridge.Sparkplug.Output {
+	case "", sparkplug.OutputMetric, sparkplug.OutputPayload:
+	default:
+		return fmt.Errorf("unknown sparkplug output %q (expected metric or payload)", config.Bridge.Sparkplug.Output)
+	}
+	
+	// Validate loop prevention settings, the namespace is a plain MQTT topic prefix
+	if strings.ContainsAny(config.Bridge.LoopPrevention.Namespace, "+#") {
+		return fmt.Errorf("bridge.loop_prevention.namespace must not contain MQTT wildcards, got %q", config.Bridge.LoopPrevention.Namespace)
+	}
+	if config.Bridge.LoopPrevention.FingerprintTTL < 0 {
+		return fmt.Errorf("bridge.loop_prevention.fingerprint_ttl must not be negative, got %v", config.Bridge.LoopPrevention.FingerprintTTL)
+	}
+	if config.Bridge.LoopPrevention.MaxFingerprints < 0 {
+		return fmt.Errorf("bridge.loop_prevention.max_fingerprints must not be negative, got %d", config.Bridge.LoopPrevention.MaxFingerprints)
+	}
+	
+	// Validate the dead letter retry backoff
+	if config.Bridge.DeadLetter.MaxRetryInterval < config.Bridge.DeadLetter.RetryInterval {
+		return fmt.Errorf("bridge.dead_letter.max_retry_interval (%v) must not be shorter than retry_interval (%v)",
+			config.Bridge.DeadLetter.MaxRetryInterval, config.Bridge.DeadLetter.RetryInterval)
+	}
+	if jitter := config.Bridge.DeadLetter.RetryJitter; jitter < 0 || jitter > 1 {
+		return fmt.Errorf("bridge.dead_letter.retry_jitter must be between 0 and 1, got %v", jitter)
+	}
+	
+	// Validate the dead letter retry store
+	switch config.Bridge.DeadLetter.Store.Type {
+	case "", types.RetryStoreMemory:
+	case types.RetryStoreFile:
+		if config.Bridge.DeadLetter.Store.Dir == "" {
+			return fmt.Errorf("bridge.dead_letter.store.dir is required for the file retry store")
+		}
+	default:
+		return fmt.Errorf("unknown bridge.dead_letter.store.type %q (expected memory or file)", config.Bridge.DeadLetter.Store.Type)
+	}
+	if config.Bridge.DeadLetter.Store.MaxMessages < 0 {
+		return fmt.Errorf("bridge.dead_letter.store.max_messages must not be negative, got %d", config.Bridge.DeadLetter.Store.MaxMessages)
+	}
+	switch config.Bridge.DeadLetter.Store.Overflow {
+	case "", types.OverflowDeadLetter, types.OverflowEvictOldest, types.OverflowDrop:
+	default:
+		return fmt.Errorf("unknown bridge.dead_letter.store.overflow %q (expected dead_letter, evict_oldest or drop)", config.Bridge.DeadLetter.Store.Overflow)
+	}
+	
+	// Validate ignore lists
+	if _, err := mqtt.NewIgnoreList(config.Bridge.Ignore.MQTTToKafka); err != nil {
+		return fmt.Errorf("invalid bridge.ignore.mqtt_to_kafka: %w", err)
+	}
+	if _, err := mqtt.NewIgnoreList(config.Bridge.Ignore.KafkaToMQTT); err != nil {
+		return fmt.Errorf("invalid bridge.ignore.kafka_to_mqtt: %w", err)
+	}
+	
+	// Validate topic creation settings
+	if config.Bridge.Kafka.CreationTimeout < 0 {
+		return fmt.Errorf("bridge.kafka.creation_timeout must not be negative, got %v", config.Bridge.Kafka.CreationTimeout)
+	}
+	if _, err := kafka.NewTopicRules(&config.Bridge.Kafka); err != nil {
+		return fmt.Errorf("invalid bridge.kafka.topic_rules: %w", err)
+	}
+	if _, err := kafka.NewTopicGuard(&config.Bridge.Kafka.Guard); err != nil {
+		return fmt.Errorf("invalid bridge.kafka.guard: %w", err)
+	}
+	
+	// Validate reverse mapping rules (patterns and topic templates)
+	if _, err := mapping.NewReverseMapper(config.Bridge.Mapping.ReverseRules); err != nil {
+		return fmt.Errorf("invalid reverse mapping rules: %w", err)
+	}
+	
 	return nil
 }
\ No newline at end of file
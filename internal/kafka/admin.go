@@ -0,0 +1,231 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DefaultTopicCreationTimeout bounds the wait for partition leaders of new topics
+const DefaultTopicCreationTimeout = 30 * time.Second
+
+// AdminClient performs topic administration. Unlike a single connection it tries every
+// configured broker, so administration keeps working while individual brokers are down.
+// Topics are created through the cluster controller, metadata is read from any broker.
+type AdminClient struct {
+	brokers []string
+	dialer  *kafka.Dialer
+}
+
+// NewAdminClient creates an admin client for the given brokers. The dialer carries the
+// same security settings as the producer and consumer connections.
+func NewAdminClient(brokers []string, dialer *kafka.Dialer) *AdminClient {
+	return &AdminClient{
+		brokers: brokers,
+		dialer:  dialer,
+	}
+}
+
+// ListTopics returns the names of all topics in the cluster
+func (a *AdminClient) ListTopics(ctx context.Context) ([]string, error) {
+	var partitions []kafka.Partition
+	err := a.withAnyBroker(ctx, func(conn *kafka.Conn) error {
+		var err error
+		partitions, err = conn.ReadPartitions()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read topic metadata: %w", err)
+	}
+
+	topicSet := make(map[string]bool)
+	for _, partition := range partitions {
+		topicSet[partition.Topic] = true
+	}
+
+	topics := make([]string, 0, len(topicSet))
+	for topic := range topicSet {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
+// CreateTopics creates topics through the cluster controller. When the controller can't
+// be reached, the request goes to any reachable broker, which forwards it on Kafka 2.8+.
+func (a *AdminClient) CreateTopics(ctx context.Context, configs ...kafka.TopicConfig) error {
+	var controller kafka.Broker
+	err := a.withAnyBroker(ctx, func(conn *kafka.Conn) error {
+		var err error
+		controller, err = conn.Controller()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find controller: %w", err)
+	}
+
+	controllerAddress := net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port))
+	conn, err := a.dialer.DialContext(ctx, "tcp", controllerAddress)
+	if err != nil {
+		log.Printf("Warning: controller %s unreachable, creating topics through another broker: %v", controllerAddress, err)
+		conn, err = a.dialAny(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	defer conn.Close()
+
+	return conn.CreateTopics(configs...)
+}
+
+// TopicExists reports whether a topic exists, including topics still being created
+func (a *AdminClient) TopicExists(ctx context.Context, topic string) (bool, error) {
+	partitions, err := a.readTopic(ctx, topic)
+	if err != nil {
+		return false, fmt.Errorf("failed to read metadata of topic %s: %w", topic, err)
+	}
+	return len(partitions) > 0, nil
+}
+
+// EnsureTopic makes sure a topic exists and every partition has a leader. Missing topics
+// are created with the given configuration. It waits at most timeout for leaders to be
+// elected and returns creation failures such as policy violations or authorization errors.
+// The result reports whether the topic was created by this call.
+func (a *AdminClient) EnsureTopic(ctx context.Context, config kafka.TopicConfig, timeout time.Duration) (bool, error) {
+	partitions, err := a.readTopic(ctx, config.Topic)
+	if err != nil {
+		return false, fmt.Errorf("failed to read metadata of topic %s: %w", config.Topic, err)
+	}
+	if leadersElected(partitions) {
+		return false, nil
+	}
+
+	created := false
+	if len(partitions) == 0 {
+		if err := a.CreateTopics(ctx, config); err != nil {
+			return false, fmt.Errorf("failed to create topic %s: %w", config.Topic, err)
+		}
+		created = true
+	}
+
+	return created, a.WaitForTopic(ctx, config.Topic, timeout)
+}
+
+// WaitForTopic polls the topic metadata until every partition has a leader
+func (a *AdminClient) WaitForTopic(ctx context.Context, topic string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	backoff := 50 * time.Millisecond
+	for {
+		partitions, err := a.readTopic(ctx, topic)
+		if err == nil && leadersElected(partitions) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("topic %s not ready after %v: %w", topic, timeout, err)
+			}
+			return fmt.Errorf("topic %s not ready after %v: %d partitions, not all with a leader", topic, timeout, len(partitions))
+		case <-time.After(backoff):
+		}
+
+		if backoff < time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// readTopic returns the partitions of a topic, or none if the topic doesn't exist
+// or is still being created
+func (a *AdminClient) readTopic(ctx context.Context, topic string) ([]kafka.Partition, error) {
+	var partitions []kafka.Partition
+	err := a.withAnyBroker(ctx, func(conn *kafka.Conn) error {
+		var err error
+		partitions, err = conn.ReadPartitions(topic)
+		if errors.Is(err, kafka.UnknownTopicOrPartition) || errors.Is(err, kafka.LeaderNotAvailable) {
+			partitions = nil
+			return nil
+		}
+		return err
+	})
+	return partitions, err
+}
+
+// leadersElected reports whether there are partitions and all of them have a leader
+func leadersElected(partitions []kafka.Partition) bool {
+	if len(partitions) == 0 {
+		return false
+	}
+	for _, partition := range partitions {
+		if partition.Leader.Host == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// withAnyBroker runs fn on a connection to each broker in turn until it succeeds
+func (a *AdminClient) withAnyBroker(ctx context.Context, fn func(conn *kafka.Conn) error) error {
+	if len(a.brokers) == 0 {
+		return fmt.Errorf("no Kafka brokers configured")
+	}
+
+	var errs []error
+	for _, broker := range a.brokers {
+		conn, err := a.dial(ctx, broker)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		err = fn(conn)
+		conn.Close()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("broker %s: %w", broker, err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// dialAny connects to the first reachable broker
+func (a *AdminClient) dialAny(ctx context.Context) (*kafka.Conn, error) {
+	if len(a.brokers) == 0 {
+		return nil, fmt.Errorf("no Kafka brokers configured")
+	}
+
+	var errs []error
+	for _, broker := range a.brokers {
+		conn, err := a.dial(ctx, broker)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// dial connects to a single broker
+func (a *AdminClient) dial(ctx context.Context, broker string) (*kafka.Conn, error) {
+	if _, _, err := net.SplitHostPort(broker); err != nil {
+		return nil, fmt.Errorf("invalid broker address %s: %w", broker, err)
+	}
+
+	conn, err := a.dialer.DialContext(ctx, "tcp", broker)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Kafka broker %s: %w", broker, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,292 @@
+package kafka
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gom2k/pkg/types"
+)
+
+// CloudEvents content modes (Kafka protocol binding)
+const (
+	CloudEventsStructured = "structured" // Whole event is a JSON document in the record value
+	CloudEventsBinary     = "binary"     // Record value is the payload, attributes are ce_ headers
+)
+
+// CloudEvents constants
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+
+	// DefaultCloudEventType is the event type used when none is configured
+	DefaultCloudEventType = "io.gom2k.mqtt.message"
+
+	headerContentType       = "content-type"
+	cloudEventsHeaderPrefix = "ce_"
+
+	// Extension attributes carrying MQTT metadata that has no CloudEvents equivalent
+	extensionMQTTQoS      = "mqttqos"
+	extensionMQTTRetained = "mqttretained"
+)
+
+// Data content types chosen for MQTT payloads
+const (
+	contentTypeJSON   = "application/json"
+	contentTypeText   = "text/plain; charset=utf-8"
+	contentTypeBinary = "application/octet-stream"
+)
+
+// convertMQTTMessageCloudEvents converts an MQTT message to a CloudEvent. The MQTT topic
+// becomes the subject, the configured source identifies the bridge and the receive time
+// becomes the event time. The message ID becomes the event id.
+func convertMQTTMessageCloudEvents(mqttMsg *types.MQTTMessage, kafkaTopic string, config *types.CloudEventsConfig) (*types.KafkaMessage, error) {
+	eventID := mqttMsg.ID
+	if eventID == "" {
+		var err error
+		if eventID, err = newEventID(); err != nil {
+			return nil, fmt.Errorf("failed to generate CloudEvent id: %w", err)
+		}
+	}
+
+	eventType := config.Type
+	if eventType == "" {
+		eventType = DefaultCloudEventType
+	}
+
+	attributes := map[string]string{
+		"specversion":         cloudEventsSpecVersion,
+		"id":                  eventID,
+		"source":              config.Source,
+		"type":                eventType,
+		"subject":             mqttMsg.Topic,
+		"time":                mqttMsg.Timestamp.UTC().Format(time.RFC3339Nano),
+		"datacontenttype":     payloadContentType(mqttMsg.Payload),
+		extensionMQTTQoS:      strconv.Itoa(int(mqttMsg.QoS)),
+		extensionMQTTRetained: strconv.FormatBool(mqttMsg.Retained),
+	}
+
+	if config.ContentMode == CloudEventsBinary {
+		return cloudEventBinaryMessage(mqttMsg, kafkaTopic, attributes), nil
+	}
+	return cloudEventStructuredMessage(mqttMsg, kafkaTopic, attributes)
+}
+
+// cloudEventBinaryMessage keeps the payload as the record value and maps attributes to headers
+func cloudEventBinaryMessage(mqttMsg *types.MQTTMessage, kafkaTopic string, attributes map[string]string) *types.KafkaMessage {
+	kafkaMsg := &types.KafkaMessage{
+		Key:   mqttMsg.Topic, // Use MQTT topic as Kafka key for partitioning
+		Value: mqttMsg.Payload,
+		Topic: kafkaTopic,
+	}
+
+	// In binary mode datacontenttype maps to the content-type header
+	kafkaMsg.Headers = append(kafkaMsg.Headers, types.KafkaHeader{Key: headerContentType, Value: []byte(attributes["datacontenttype"])})
+	for _, name := range []string{"specversion", "id", "source", "type", "subject", "time", extensionMQTTQoS, extensionMQTTRetained} {
+		kafkaMsg.Headers = append(kafkaMsg.Headers, types.KafkaHeader{Key: cloudEventsHeaderPrefix + name, Value: []byte(attributes[name])})
+	}
+	kafkaMsg.Headers = append(kafkaMsg.Headers, messageIDHeaders(mqttMsg)...)
+
+	return kafkaMsg
+}
+
+// cloudEventStructuredMessage encodes the whole event as a JSON document. JSON payloads are
+// embedded as data, text payloads as a data string and binary payloads as data_base64.
+func cloudEventStructuredMessage(mqttMsg *types.MQTTMessage, kafkaTopic string, attributes map[string]string) (*types.KafkaMessage, error) {
+	// Embedded data loses whitespace around the JSON value, so such payloads are sent as text
+	if attributes["datacontenttype"] == contentTypeJSON && len(bytes.TrimSpace(mqttMsg.Payload)) != len(mqttMsg.Payload) {
+		attributes["datacontenttype"] = contentTypeText
+	}
+
+	event := make(map[string]interface{}, len(attributes)+1)
+	for name, value := range attributes {
+		event[name] = value
+	}
+
+	var data json.RawMessage
+	switch attributes["datacontenttype"] {
+	case contentTypeJSON:
+		data = mqttMsg.Payload
+	case contentTypeText:
+		event["data"] = string(mqttMsg.Payload)
+	default:
+		event["data_base64"] = base64.StdEncoding.EncodeToString(mqttMsg.Payload)
+	}
+
+	eventJSON, err := marshalCloudEvent(event, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal CloudEvent: %w", err)
+	}
+
+	return &types.KafkaMessage{
+		Key:     mqttMsg.Topic, // Use MQTT topic as Kafka key for partitioning
+		Value:   eventJSON,
+		Topic:   kafkaTopic,
+		Headers: append([]types.KafkaHeader{{Key: headerContentType, Value: []byte(cloudEventsContentType)}}, messageIDHeaders(mqttMsg)...),
+	}, nil
+}
+
+// marshalCloudEvent writes a structured event without HTML escaping and with JSON data
+// appended verbatim. json.Marshal would compact the data and escape <, > and &, so the
+// payload wouldn't be restored byte for byte.
+func marshalCloudEvent(event map[string]interface{}, data json.RawMessage) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(event); err != nil {
+		return nil, err
+	}
+	eventJSON := bytes.TrimRight(buffer.Bytes(), "\n")
+	if data == nil {
+		return eventJSON, nil
+	}
+
+	// The event always has attributes, so data follows a comma before the closing brace
+	spliced := make([]byte, 0, len(eventJSON)+len(data)+9)
+	spliced = append(spliced, eventJSON[:len(eventJSON)-1]...)
+	spliced = append(spliced, `,"data":`...)
+	spliced = append(spliced, data...)
+	return append(spliced, '}'), nil
+}
+
+// payloadContentType picks the data content type describing an MQTT payload
+func payloadContentType(payload []byte) string {
+	switch {
+	case len(payload) > 0 && json.Valid(payload):
+		return contentTypeJSON
+	case utf8.Valid(payload):
+		return contentTypeText
+	default:
+		return contentTypeBinary
+	}
+}
+
+// newEventID returns a random identifier for a CloudEvent of a message without ID
+func newEventID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// isCloudEventsBinary reports whether a Kafka record is a binary mode CloudEvent
+func isCloudEventsBinary(kafkaMsg *types.KafkaMessage) bool {
+	_, ok := kafkaMsg.Header(cloudEventsHeaderPrefix + "specversion")
+	return ok
+}
+
+// convertBinaryCloudEvent restores an MQTT message from a binary mode CloudEvent
+func convertBinaryCloudEvent(kafkaMsg *types.KafkaMessage) (*types.MQTTMessage, error) {
+	attributes := make(map[string]string)
+	for _, header := range kafkaMsg.Headers {
+		if strings.HasPrefix(header.Key, cloudEventsHeaderPrefix) {
+			attributes[strings.TrimPrefix(header.Key, cloudEventsHeaderPrefix)] = string(header.Value)
+		}
+	}
+
+	return cloudEventToMQTT(attributes, kafkaMsg.Value)
+}
+
+// convertStructuredCloudEvent restores an MQTT message from a structured mode CloudEvent
+func convertStructuredCloudEvent(fields map[string]json.RawMessage) (*types.MQTTMessage, error) {
+	attributes := make(map[string]string)
+	for name, raw := range fields {
+		if name == "data" || name == "data_base64" {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			attributes[name] = v
+		case nil:
+		default:
+			// Extension attributes may be numbers or booleans in JSON
+			attributes[name] = string(raw)
+		}
+	}
+
+	var payload []byte
+	if rawBase64, ok := fields["data_base64"]; ok {
+		var encoded string
+		if err := json.Unmarshal(rawBase64, &encoded); err != nil {
+			return nil, fmt.Errorf("invalid data_base64 in CloudEvent: %w", err)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data_base64 in CloudEvent: %w", err)
+		}
+		payload = decoded
+	} else if rawData, ok := fields["data"]; ok {
+		payload = rawData
+		// Data of a non-JSON content type is carried as a JSON string
+		if !isJSONContentType(attributes["datacontenttype"]) {
+			var text string
+			if err := json.Unmarshal(rawData, &text); err == nil {
+				payload = []byte(text)
+			}
+		}
+	}
+
+	return cloudEventToMQTT(attributes, payload)
+}
+
+// cloudEventToMQTT builds an MQTT message from CloudEvent attributes. The subject is the
+// MQTT topic, the gom2k extension attributes restore QoS and retain flag.
+func cloudEventToMQTT(attributes map[string]string, payload []byte) (*types.MQTTMessage, error) {
+	if attributes["specversion"] != cloudEventsSpecVersion {
+		return nil, fmt.Errorf("unsupported CloudEvents specversion: %q", attributes["specversion"])
+	}
+
+	subject := attributes["subject"]
+	if subject == "" {
+		return nil, fmt.Errorf("missing subject in CloudEvent, cannot determine MQTT topic")
+	}
+
+	mqttMsg := &types.MQTTMessage{
+		Topic:     subject,
+		Payload:   payload,
+		Timestamp: time.Now(),
+	}
+
+	if qosVal, ok := attributes[extensionMQTTQoS]; ok {
+		qos, err := strconv.Atoi(qosVal)
+		if err != nil || qos < 0 || qos > 2 {
+			return nil, fmt.Errorf("invalid %s attribute: %q", extensionMQTTQoS, qosVal)
+		}
+		mqttMsg.QoS = byte(qos)
+	}
+
+	if retainedVal, ok := attributes[extensionMQTTRetained]; ok {
+		retained, err := strconv.ParseBool(retainedVal)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s attribute: %q", extensionMQTTRetained, retainedVal)
+		}
+		mqttMsg.Retained = retained
+	}
+
+	if timeVal, ok := attributes["time"]; ok {
+		if parsedTime, err := time.Parse(time.RFC3339Nano, timeVal); err == nil {
+			mqttMsg.Timestamp = parsedTime
+		}
+	}
+
+	return mqttMsg, nil
+}
+
+// isJSONContentType reports whether a data content type is JSON (or absent, which
+// CloudEvents treats as JSON in structured mode)
+func isJSONContentType(contentType string) bool {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	return mediaType == "" || mediaType == contentTypeJSON || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,138 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gom2k/internal/schema"
+	"gom2k/pkg/types"
+)
+
+// Envelope modes backed by a schema registry
+const (
+	EnvelopeAvro     = "avro"
+	EnvelopeProtobuf = "protobuf"
+)
+
+// defaultRegistryTimeout bounds schema registry requests when no timeout is configured
+const defaultRegistryTimeout = 10 * time.Second
+
+// Codec converts between MQTT messages and Kafka records using the configured envelope.
+// On top of the stateless conversion functions it handles the schema registry backed
+// Avro and Protobuf formats. A nil Codec uses the default JSON envelope.
+type Codec struct {
+	envelope   *types.EnvelopeConfig
+	registry   *schema.RegistryClient // nil without a configured registry
+	serializer *schema.Serializer     // Set for the "avro" and "protobuf" modes
+	timeout    time.Duration
+}
+
+// NewCodec creates a codec for the given envelope settings
+func NewCodec(envelope *types.EnvelopeConfig) (*Codec, error) {
+	codec := &Codec{envelope: envelope, timeout: envelope.Schema.Timeout}
+	if codec.timeout <= 0 {
+		codec.timeout = defaultRegistryTimeout
+	}
+
+	if envelope.Schema.RegistryURL != "" {
+		codec.registry = schema.NewRegistryClient(envelope.Schema.RegistryURL,
+			envelope.Schema.Username, envelope.Schema.Password, codec.timeout)
+	}
+
+	var schemaType string
+	switch envelope.Mode {
+	case EnvelopeAvro:
+		schemaType = schema.TypeAvro
+	case EnvelopeProtobuf:
+		schemaType = schema.TypeProtobuf
+	default:
+		return codec, nil
+	}
+
+	if codec.registry == nil {
+		return nil, fmt.Errorf("envelope mode %s requires a schema registry_url", envelope.Mode)
+	}
+	serializer, err := schema.NewSerializer(codec.registry, schemaType, &envelope.Schema)
+	if err != nil {
+		return nil, err
+	}
+	codec.serializer = serializer
+
+	return codec, nil
+}
+
+// SchemaBased reports whether records are serialized with the schema registry, so encoding
+// them may look up or register schemas
+func (c *Codec) SchemaBased() bool {
+	return c != nil && c.serializer != nil
+}
+
+// Key returns the Kafka record key of an MQTT message. Every envelope mode keys records by
+// MQTT topic, so the messages of a topic stay in order on one partition.
+func (c *Codec) Key(mqttMsg *types.MQTTMessage) string {
+	return mqttMsg.Topic
+}
+
+// Encode converts an MQTT message to a Kafka record for the given topic
+func (c *Codec) Encode(mqttMsg *types.MQTTMessage, kafkaTopic string) (*types.KafkaMessage, error) {
+	if c == nil {
+		return ConvertMQTTMessage(mqttMsg, kafkaTopic)
+	}
+	if c.serializer == nil {
+		return ConvertMQTTMessageWithEnvelope(mqttMsg, kafkaTopic, c.envelope)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	value, err := c.serializer.Serialize(ctx, kafkaTopic, mqttMsg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize MQTT message as %s: %w", c.envelope.Mode, err)
+	}
+
+	// Payload only records carry the MQTT metadata in the same headers as raw mode
+	if c.serializer.PayloadOnly() {
+		return &types.KafkaMessage{
+			Key:     c.Key(mqttMsg),
+			Value:   value,
+			Topic:   kafkaTopic,
+			Headers: metadataHeaders(mqttMsg, c.envelope.Mode),
+		}, nil
+	}
+
+	return &types.KafkaMessage{
+		Key:     c.Key(mqttMsg),
+		Value:   value,
+		Topic:   kafkaTopic,
+		Headers: messageIDHeaders(mqttMsg),
+	}, nil
+}
+
+// Decode converts a Kafka record back to an MQTT message. Records in the schema registry
+// wire format are decoded when a registry is configured, all others as ConvertKafkaMessage does.
+func (c *Codec) Decode(kafkaMsg *types.KafkaMessage) (*types.MQTTMessage, error) {
+	if c == nil || c.registry == nil || isRawEnvelope(kafkaMsg) || isCloudEventsBinary(kafkaMsg) ||
+		!schema.IsWireFormat(kafkaMsg.Value) {
+		return ConvertKafkaMessage(kafkaMsg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	mqttMsg, payloadOnly, err := schema.Deserialize(ctx, c.registry, kafkaMsg.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize Kafka message: %w", err)
+	}
+
+	if payloadOnly {
+		// Restore the metadata from the headers written alongside the payload
+		withPayload := *kafkaMsg
+		withPayload.Value = mqttMsg.Payload
+		return convertRawKafkaMessage(&withPayload)
+	}
+	if mqttMsg.Topic == "" {
+		return nil, fmt.Errorf("missing mqtt_topic in Kafka message")
+	}
+	return mqttMsg, nil
+}
@@ -0,0 +1,71 @@
+package kafka
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/segmentio/kafka-go/compress"
+)
+
+// HeaderContentEncoding names the compression applied to a record value by the bridge
+// itself (as opposed to Kafka's transparent batch compression)
+const HeaderContentEncoding = "gom2k_content_encoding"
+
+// ParseCompression parses a compression name: none, gzip, snappy, lz4 or zstd.
+// An empty name means no compression.
+func ParseCompression(name string) (compress.Compression, error) {
+	if name == "" {
+		return compress.None, nil
+	}
+	var compression compress.Compression
+	if err := compression.UnmarshalText([]byte(name)); err != nil {
+		return compress.None, err
+	}
+	return compression, nil
+}
+
+// CompressPayload compresses data with the named codec. Data is returned unchanged
+// when no compression is configured.
+func CompressPayload(data []byte, name string) ([]byte, error) {
+	compression, err := ParseCompression(name)
+	if err != nil {
+		return nil, err
+	}
+	codec := compression.Codec()
+	if codec == nil {
+		return data, nil
+	}
+
+	var buffer bytes.Buffer
+	writer := codec.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("failed to compress with %s: %w", name, err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress with %s: %w", name, err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// DecompressPayload reverses CompressPayload
+func DecompressPayload(data []byte, name string) ([]byte, error) {
+	compression, err := ParseCompression(name)
+	if err != nil {
+		return nil, err
+	}
+	codec := compression.Codec()
+	if codec == nil {
+		return data, nil
+	}
+
+	reader := codec.NewReader(bytes.NewReader(data))
+	defer reader.Close()
+
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s data: %w", name, err)
+	}
+	return decompressed, nil
+}
@@ -2,35 +2,41 @@ package kafka
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"log"
-	"net"
-	"os"
-	"software.sslmate.com/src/go-pkcs12"
 	"strings"
 	"time"
 
 	"github.com/segmentio/kafka-go"
+	"gom2k/internal/mapping"
+	"gom2k/internal/msgid"
 	"gom2k/pkg/types"
 )
 
 // Consumer handles Kafka message consumption with SSL support
 type Consumer struct {
-	reader       *kafka.Reader
-	config       *types.KafkaConfig
-	bridgeConfig *types.BridgeConfig
-	topics       []string
+	reader        *kafka.Reader
+	config        *types.KafkaConfig
+	bridgeConfig  *types.BridgeConfig
+	topics        []string
+	reverseMapper *mapping.ReverseMapper // Selects extra topics matched by reverse mapping rules
+	admin         *AdminClient           // Discovers topics from any reachable broker
 }
 
 // NewConsumer creates a new Kafka consumer with SSL configuration
 func NewConsumer(kafkaConfig *types.KafkaConfig, bridgeConfig *types.BridgeConfig) *Consumer {
+	// Rules are validated at config load, an invalid rule set simply selects no extra topics
+	reverseMapper, err := mapping.NewReverseMapper(bridgeConfig.Mapping.ReverseRules)
+	if err != nil {
+		log.Printf("Warning: ignoring invalid reverse mapping rules for topic discovery: %v", err)
+	}
+	
 	return &Consumer{
-		config:       kafkaConfig,
-		bridgeConfig: bridgeConfig,
-		topics:       generateKafkaTopics(bridgeConfig),
+		config:        kafkaConfig,
+		bridgeConfig:  bridgeConfig,
+		topics:        generateKafkaTopics(bridgeConfig),
+		reverseMapper: reverseMapper,
 	}
 }
 
@@ -46,11 +52,12 @@ func generateKafkaTopics(bridgeConfig *types.BridgeConfig) []string {
 func (c *Consumer) Connect() error {
 	log.Printf("Connecting to Kafka consumer with brokers: %v", c.config.Brokers)
 	
-	// Load PKCS#12 certificate
-	tlsConfig, err := c.loadTLSConfig()
+	// Data and admin connections share the dialer with the TLS settings
+	dialer, err := newDialer(c.config)
 	if err != nil {
-		return fmt.Errorf("failed to load TLS config: %w", err)
+		return err
 	}
+	c.admin = NewAdminClient(c.config.Brokers, dialer)
 
 	// Configure Kafka reader
 	// Note: kafka-go Reader can only consume from one topic at a time
@@ -73,78 +80,38 @@ func (c *Consumer) Connect() error {
 		log.Printf("Using default topic: %s", defaultTopic)
 	}
 	
-	// Use the first discovered topic for single-topic reader
-	// TODO: Implement proper multi-topic consumption
-	topicToConsume := discoveredTopics[0]
 	c.topics = discoveredTopics // Update our topic list
 	
-	log.Printf("Discovered %d Kafka topics with prefix, consuming from: %s", len(discoveredTopics), topicToConsume)
-	
-	c.reader = kafka.NewReader(kafka.ReaderConfig{
+	readerConfig := kafka.ReaderConfig{
 		Brokers: c.config.Brokers,
 		GroupID: c.config.Consumer.GroupID,
-		Topic:   topicToConsume,
 		
 		// SSL configuration
-		Dialer: &kafka.Dialer{
-			Timeout:   10 * time.Second,
-			DualStack: true,
-			TLS:       tlsConfig,
-		},
+		Dialer: dialer,
 		
 		// Consumer configuration
 		MinBytes:    1,    // Wait for at least 1 byte
 		MaxBytes:    10e6, // Max 10MB per batch
 		MaxWait:     1 * time.Second,
 		StartOffset: kafka.LastOffset, // Start from latest messages
-	})
-
-	log.Println("✓ Kafka consumer connected successfully")
-	return nil
-}
-
-// loadTLSConfig loads TLS configuration from PKCS#12 files
-func (c *Consumer) loadTLSConfig() (*tls.Config, error) {
-	if c.config.Security.Protocol != "SSL" {
-		return nil, nil
+		
+		// Records of aborted or still open transactions aren't bridged
+		IsolationLevel: kafka.ReadCommitted,
 	}
-
-	ssl := c.config.Security.SSL
 	
-	// Load keystore (client certificate)
-	keystoreData, err := os.ReadFile(ssl.Keystore.Location)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read keystore: %w", err)
-	}
-
-	privateKey, cert, err := pkcs12.Decode(keystoreData, ssl.Keystore.Password)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode keystore: %w", err)
-	}
-
-	// Load truststore (CA certificates)
-	truststoreData, err := os.ReadFile(ssl.Truststore.Location)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read truststore: %w", err)
-	}
-
-	_, caCert, err := pkcs12.Decode(truststoreData, ssl.Truststore.Password)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode truststore: %w", err)
-	}
-
-	// Create TLS config
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{
-			{
-				Certificate: [][]byte{cert.Raw},
-				PrivateKey:  privateKey,
-			},
-		},
-		RootCAs: createCertPoolFromCerts([]*x509.Certificate{caCert}),
+	// Consumer groups can read all discovered topics, a group-less reader is limited to one
+	if c.config.Consumer.GroupID != "" {
+		readerConfig.GroupTopics = discoveredTopics
+		log.Printf("Discovered %d Kafka topics, consuming from all of them", len(discoveredTopics))
+	} else {
+		readerConfig.Topic = discoveredTopics[0]
+		log.Printf("Discovered %d Kafka topics, no consumer group configured so consuming from: %s", len(discoveredTopics), readerConfig.Topic)
 	}
+	
+	c.reader = kafka.NewReader(readerConfig)
 
-	return tlsConfig, nil
+	log.Println("✓ Kafka consumer connected successfully")
+	return nil
 }
 
 // ReadMessage reads the next message from Kafka
@@ -154,12 +121,9 @@ func (c *Consumer) ReadMessage(ctx context.Context) (*types.KafkaMessage, error)
 		return nil, fmt.Errorf("failed to read message: %w", err)
 	}
 
-	// Convert to our internal message format
-	msg := &types.KafkaMessage{
-		Topic: kafkaMsg.Topic,
-		Key:   string(kafkaMsg.Key),
-		Value: kafkaMsg.Value,
-	}
+	// Convert to our internal message format, with an ID for tracking it through the bridge
+	msg := toMessage(kafkaMsg)
+	msg.ID = msgid.New()
 
 	return msg, nil
 }
@@ -180,48 +144,80 @@ func (c *Consumer) GetTopics() []string {
 
 // ConvertKafkaMessage converts a Kafka message back to MQTT format
 func ConvertKafkaMessage(kafkaMsg *types.KafkaMessage) (*types.MQTTMessage, error) {
+	// Raw mode records carry the MQTT metadata in headers instead of a JSON envelope
+	if isRawEnvelope(kafkaMsg) {
+		return convertRawKafkaMessage(kafkaMsg)
+	}
+	if mode, _ := kafkaMsg.Header(HeaderEnvelope); mode == EnvelopeSparkplug {
+		return nil, fmt.Errorf("decoded Sparkplug B records can't be forwarded to MQTT")
+	}
+	if isCloudEventsBinary(kafkaMsg) {
+		return convertBinaryCloudEvent(kafkaMsg)
+	}
+	
 	// Parse JSON payload to extract original MQTT message
-	var payload map[string]interface{}
-	if err := json.Unmarshal(kafkaMsg.Value, &payload); err != nil {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(kafkaMsg.Value, &fields); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal Kafka message: %w", err)
 	}
 
+	// Structured mode CloudEvents carry the MQTT topic as subject
+	if _, ok := fields["specversion"]; ok {
+		return convertStructuredCloudEvent(fields)
+	}
+
 	// Extract original MQTT topic from JSON payload (source of truth)
 	// This ensures perfect reconstruction regardless of Kafka topic mapping strategy
-	mqttTopic := ""
-	if topic, ok := payload["mqtt_topic"].(string); ok {
-		mqttTopic = topic
-	} else {
+	var mqttTopic string
+	if !envelopeField(fields, "mqtt_topic", &mqttTopic) {
 		// This should never happen if the message was created by our bridge
 		return nil, fmt.Errorf("missing mqtt_topic in Kafka message payload")
 	}
 
-	// Extract payload
-	payloadStr, ok := payload["payload"].(string)
-	if !ok {
-		return nil, fmt.Errorf("invalid payload format in Kafka message")
+	// Extract payload: embedded JSON is used verbatim, strings are decoded
+	// (records without payload_type or payload_encoding carry UTF-8 text)
+	var payloadType string
+	envelopeField(fields, "payload_type", &payloadType)
+
+	var payloadBytes []byte
+	switch payloadType {
+	case PayloadTypeJSON:
+		rawPayload, ok := fields["payload"]
+		if !ok {
+			return nil, fmt.Errorf("invalid payload format in Kafka message")
+		}
+		payloadBytes = rawPayload
+	case "", PayloadTypeString:
+		var payloadStr string
+		if !envelopeField(fields, "payload", &payloadStr) {
+			return nil, fmt.Errorf("invalid payload format in Kafka message")
+		}
+
+		var encoding string
+		envelopeField(fields, "payload_encoding", &encoding)
+		var err error
+		if payloadBytes, err = types.DecodePayload(payloadStr, encoding); err != nil {
+			return nil, fmt.Errorf("invalid payload in Kafka message: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown payload_type in Kafka message: %s", payloadType)
 	}
 
-	// Extract QoS (handle both int and float64 from JSON)
+	// Extract QoS (JSON numbers decode as float64)
 	var qos byte = 0
-	if qosVal, ok := payload["qos"]; ok {
-		switch qosValue := qosVal.(type) {
-		case float64:
-			qos = byte(qosValue)
-		case int:
-			qos = byte(qosValue)
-		}
+	var qosValue float64
+	if envelopeField(fields, "qos", &qosValue) {
+		qos = byte(qosValue)
 	}
 
 	// Extract retained flag
 	retained := false
-	if retainedVal, ok := payload["retained"].(bool); ok {
-		retained = retainedVal
-	}
+	envelopeField(fields, "retained", &retained)
 
 	// Extract timestamp
 	timestamp := time.Now()
-	if timestampVal, ok := payload["timestamp"].(string); ok {
+	var timestampVal string
+	if envelopeField(fields, "timestamp", &timestampVal) {
 		if parsedTime, err := time.Parse(time.RFC3339, timestampVal); err == nil {
 			timestamp = parsedTime
 		}
@@ -230,7 +226,7 @@ func ConvertKafkaMessage(kafkaMsg *types.KafkaMessage) (*types.MQTTMessage, erro
 	// Create MQTT message
 	mqttMsg := &types.MQTTMessage{
 		Topic:     mqttTopic,
-		Payload:   []byte(payloadStr),
+		Payload:   payloadBytes,
 		QoS:       qos,
 		Retained:  retained,
 		Timestamp: timestamp,
@@ -241,36 +237,15 @@ func ConvertKafkaMessage(kafkaMsg *types.KafkaMessage) (*types.MQTTMessage, erro
 
 // discoverKafkaTopics dynamically discovers existing Kafka topics matching our prefix
 func (c *Consumer) discoverKafkaTopics() ([]string, error) {
-	// Create connection for topic discovery
-	conn, err := c.createKafkaConn()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Kafka connection for discovery: %w", err)
-	}
-	defer conn.Close()
-	
-	// Get all topics from Kafka cluster
-	partitions, err := conn.ReadPartitions()
+	// Get all topics from any reachable broker
+	topics, err := c.admin.ListTopics(context.Background())
 	if err != nil {
-		return nil, fmt.Errorf("failed to read Kafka partitions: %w", err)
+		return nil, err
 	}
 	
-	// Extract unique topic names and filter by our prefix
-	topicSet := make(map[string]bool)
+	// Filter topic names by our prefix
 	prefix := c.getBridgePrefix()
-	
-	for _, partition := range partitions {
-		topicName := partition.Topic
-		// Only include topics that start with our bridge prefix
-		if strings.HasPrefix(topicName, prefix) {
-			topicSet[topicName] = true
-		}
-	}
-	
-	// Convert set to slice
-	var discoveredTopics []string
-	for topic := range topicSet {
-		discoveredTopics = append(discoveredTopics, topic)
-	}
+	discoveredTopics := SelectBridgeTopics(topics, prefix, c.bridgeConfig, c.reverseMapper)
 	
 	log.Printf("Topic discovery: found %d topics with prefix '%s'", len(discoveredTopics), prefix)
 	for _, topic := range discoveredTopics {
@@ -280,46 +255,20 @@ func (c *Consumer) discoverKafkaTopics() ([]string, error) {
 	return discoveredTopics, nil
 }
 
-// createKafkaConn creates a connection to Kafka for admin operations
-func (c *Consumer) createKafkaConn() (*kafka.Conn, error) {
-	var dialer *kafka.Dialer
-	
-	// Configure SSL/TLS if specified
-	if strings.ToUpper(c.config.Security.Protocol) == "SSL" {
-		tlsConfig, err := c.loadTLSConfig()
-		if err != nil {
-			return nil, fmt.Errorf("failed to create TLS config: %w", err)
-		}
-		
-		dialer = &kafka.Dialer{
-			Timeout:   10 * time.Second,
-			DualStack: true,
-			TLS:       tlsConfig,
+// SelectBridgeTopics returns the topics the Kafka→MQTT direction consumes: topics below the
+// prefix or matched by a reverse mapping rule. The dead letter and catch-all topics are left
+// out, since bridging their records back to MQTT would send failed messages in circles.
+func SelectBridgeTopics(topics []string, prefix string, bridgeConfig *types.BridgeConfig, reverseMapper *mapping.ReverseMapper) []string {
+	var selected []string
+	for _, topicName := range topics {
+		if bridgeConfig != nil && (topicName == bridgeConfig.DeadLetter.KafkaTopic || topicName == bridgeConfig.Kafka.Guard.CatchAllTopic) {
+			continue
 		}
-	} else {
-		dialer = &kafka.Dialer{
-			Timeout:   10 * time.Second,
-			DualStack: true,
+		if strings.HasPrefix(topicName, prefix+".") || reverseMapper.MatchesTopic(topicName) {
+			selected = append(selected, topicName)
 		}
 	}
-	
-	// Connect to the first broker
-	if len(c.config.Brokers) == 0 {
-		return nil, fmt.Errorf("no Kafka brokers configured")
-	}
-	
-	broker := c.config.Brokers[0]
-	host, port, err := net.SplitHostPort(broker)
-	if err != nil {
-		return nil, fmt.Errorf("invalid broker address %s: %w", broker, err)
-	}
-	
-	conn, err := dialer.DialContext(context.Background(), "tcp", net.JoinHostPort(host, port))
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Kafka broker %s: %w", broker, err)
-	}
-	
-	return conn, nil
+	return selected
 }
 
 // getBridgePrefix returns the Kafka topic prefix for this bridge instance
@@ -343,12 +292,3 @@ func (c *Consumer) getBridgePrefix() string {
 	
 	return "gom2k" // Default fallback
 }
-
-// createCertPoolFromCerts creates a certificate pool from x509 certificates
-func createCertPoolFromCerts(certs []*x509.Certificate) *x509.CertPool {
-	pool := x509.NewCertPool()
-	for _, cert := range certs {
-		pool.AddCert(cert)
-	}
-	return pool
-}
\ No newline at end of file
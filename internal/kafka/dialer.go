@@ -0,0 +1,144 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"gom2k/pkg/types"
+
+	"github.com/segmentio/kafka-go"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// newDialer creates the dialer shared by the producer, the consumer and the admin client,
+// so data and admin connections are secured the same way
+func newDialer(config *types.KafkaConfig) (*kafka.Dialer, error) {
+	dialer := &kafka.Dialer{
+		Timeout:   10 * time.Second,
+		DualStack: true,
+	}
+
+	// Configure SSL/TLS if specified
+	if strings.ToUpper(config.Security.Protocol) == "SSL" {
+		tlsConfig, err := createTLSConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create TLS config: %w", err)
+		}
+		dialer.TLS = tlsConfig
+	}
+
+	return dialer, nil
+}
+
+// createTLSConfig creates the TLS configuration from the PKCS#12 truststore and keystore.
+// The keystore is only needed when brokers require client certificates (mutual TLS).
+func createTLSConfig(config *types.KafkaConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	// Load truststore (CA certificates)
+	if config.Security.SSL.Truststore.Location != "" {
+		if _, err := os.Stat(config.Security.SSL.Truststore.Location); os.IsNotExist(err) {
+			return nil, fmt.Errorf("truststore file not found: %s", config.Security.SSL.Truststore.Location)
+		}
+
+		log.Printf("Loading truststore: %s", config.Security.SSL.Truststore.Location)
+
+		caCerts, err := loadTruststorePKCS12(config.Security.SSL.Truststore.Location, config.Security.SSL.Truststore.Password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load truststore: %w", err)
+		}
+
+		tlsConfig.RootCAs = caCerts
+		log.Printf("Loaded CA certificates from truststore")
+	}
+
+	// Load client keystore (client certificate for mutual TLS)
+	if config.Security.SSL.Keystore.Location != "" {
+		if _, err := os.Stat(config.Security.SSL.Keystore.Location); os.IsNotExist(err) {
+			return nil, fmt.Errorf("keystore file not found: %s", config.Security.SSL.Keystore.Location)
+		}
+
+		log.Printf("Loading keystore: %s", config.Security.SSL.Keystore.Location)
+
+		clientCert, err := loadKeystorePKCS12(
+			config.Security.SSL.Keystore.Location,
+			config.Security.SSL.Keystore.Password,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load keystore: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+		log.Println("Loaded client certificate from keystore")
+	}
+
+	return tlsConfig, nil
+}
+
+// loadTruststorePKCS12 loads CA certificates from a PKCS#12 truststore
+func loadTruststorePKCS12(filename, password string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Attempting to load PKCS#12 with password length: %d", len(password))
+
+	// Parse PKCS#12 truststore data
+	certs, err := pkcs12.DecodeTrustStore(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode PKCS#12 truststore (check password): %w", err)
+	}
+
+	certPool := x509.NewCertPool()
+
+	// Add all certificates from truststore
+	for _, cert := range certs {
+		certPool.AddCert(cert)
+		log.Printf("Added CA certificate: %s", cert.Subject.CommonName)
+	}
+
+	if len(certs) == 0 {
+		log.Println("Warning: no certificates found in truststore")
+	}
+
+	return certPool, nil
+}
+
+// loadKeystorePKCS12 loads client certificate and private key from a PKCS#12 keystore
+func loadKeystorePKCS12(filename, password string) (tls.Certificate, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	log.Printf("Attempting to load PKCS#12 keystore with password length: %d", len(password))
+
+	// Parse PKCS#12 data
+	privateKey, cert, err := pkcs12.Decode(data, password)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to decode PKCS#12 keystore (check password): %w", err)
+	}
+
+	if privateKey == nil || cert == nil {
+		return tls.Certificate{}, fmt.Errorf("no private key or certificate found in keystore")
+	}
+
+	// Create certificate chain
+	var certChain [][]byte
+	certChain = append(certChain, cert.Raw)
+
+	// Create TLS certificate
+	tlsCert := tls.Certificate{
+		Certificate: certChain,
+		PrivateKey:  privateKey,
+	}
+
+	log.Printf("Loaded client certificate: %s", cert.Subject.CommonName)
+	return tlsCert, nil
+}
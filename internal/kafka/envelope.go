@@ -0,0 +1,167 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gom2k/pkg/types"
+)
+
+// Envelope modes for MQTT→Kafka conversion
+const (
+	EnvelopeJSON        = "json"
+	EnvelopeRaw         = "raw"
+	EnvelopeCloudEvents = "cloudevents"
+)
+
+// EnvelopeSparkplug marks records decoded from Sparkplug B messages in the HeaderEnvelope
+// header. They describe metrics, not MQTT messages, and aren't forwarded back to MQTT.
+const EnvelopeSparkplug = "sparkplug"
+
+// Payload types of the JSON envelope, recorded in its payload_type field
+const (
+	PayloadTypeString = "string" // Payload is a (possibly base64 encoded) JSON string
+	PayloadTypeJSON   = "json"   // Payload is a JSON value embedded in the envelope
+)
+
+// Kafka record headers carrying MQTT metadata
+const (
+	HeaderMQTTTopic  = "gom2k_mqtt_topic"  // Original MQTT topic
+	HeaderEnvelope   = "gom2k_envelope"    // Envelope mode of records that aren't JSON envelopes
+	HeaderQoS        = "gom2k_qos"         // MQTT QoS level (raw mode)
+	HeaderRetained   = "gom2k_retained"    // MQTT retain flag (raw mode)
+	HeaderTimestamp  = "gom2k_timestamp"   // Receive time in RFC 3339 format (raw mode)
+	HeaderKafkaTopic = "gom2k_kafka_topic" // Mapped Kafka topic of records redirected to the catch-all topic
+	HeaderMessageID  = "gom2k_message_id"  // ID the bridge assigned to the MQTT message on receipt
+)
+
+// ConvertMQTTMessageWithEnvelope converts an MQTT message to Kafka format using the configured envelope mode
+func ConvertMQTTMessageWithEnvelope(mqttMsg *types.MQTTMessage, kafkaTopic string, envelope *types.EnvelopeConfig) (*types.KafkaMessage, error) {
+	switch envelope.Mode {
+	case "", EnvelopeJSON:
+		return convertMQTTMessageJSON(mqttMsg, kafkaTopic, envelope)
+	case EnvelopeRaw:
+		return convertMQTTMessageRaw(mqttMsg, kafkaTopic), nil
+	case EnvelopeCloudEvents:
+		return convertMQTTMessageCloudEvents(mqttMsg, kafkaTopic, &envelope.CloudEvents)
+	case EnvelopeAvro, EnvelopeProtobuf:
+		return nil, fmt.Errorf("envelope mode %s needs a schema registry, use a Codec", envelope.Mode)
+	default:
+		return nil, fmt.Errorf("unknown envelope mode: %s", envelope.Mode)
+	}
+}
+
+// convertMQTTMessageRaw passes the MQTT payload through byte-for-byte as the Kafka value,
+// with the MQTT metadata moved into record headers
+func convertMQTTMessageRaw(mqttMsg *types.MQTTMessage, kafkaTopic string) *types.KafkaMessage {
+	return &types.KafkaMessage{
+		Key:     mqttMsg.Topic, // Use MQTT topic as Kafka key for partitioning
+		Value:   mqttMsg.Payload,
+		Topic:   kafkaTopic,
+		Headers: metadataHeaders(mqttMsg, EnvelopeRaw),
+	}
+}
+
+// messageIDHeaders returns the header carrying the message ID, which every record
+// converted from an MQTT message gets regardless of the envelope mode
+func messageIDHeaders(mqttMsg *types.MQTTMessage) []types.KafkaHeader {
+	if mqttMsg.ID == "" {
+		return nil
+	}
+	return []types.KafkaHeader{{Key: HeaderMessageID, Value: []byte(mqttMsg.ID)}}
+}
+
+// metadataHeaders returns the headers carrying MQTT metadata for records whose value
+// is only the payload
+func metadataHeaders(mqttMsg *types.MQTTMessage, envelopeMode string) []types.KafkaHeader {
+	return append([]types.KafkaHeader{
+		{Key: HeaderEnvelope, Value: []byte(envelopeMode)},
+		{Key: HeaderMQTTTopic, Value: []byte(mqttMsg.Topic)},
+		{Key: HeaderQoS, Value: []byte(strconv.Itoa(int(mqttMsg.QoS)))},
+		{Key: HeaderRetained, Value: []byte(strconv.FormatBool(mqttMsg.Retained))},
+		{Key: HeaderTimestamp, Value: []byte(mqttMsg.Timestamp.Format(time.RFC3339Nano))},
+	}, messageIDHeaders(mqttMsg)...)
+}
+
+// isRawEnvelope reports whether a Kafka record was produced in raw envelope mode
+func isRawEnvelope(kafkaMsg *types.KafkaMessage) bool {
+	mode, ok := kafkaMsg.Header(HeaderEnvelope)
+	return ok && mode == EnvelopeRaw
+}
+
+// convertRawKafkaMessage restores an MQTT message from a payload only record and its headers
+func convertRawKafkaMessage(kafkaMsg *types.KafkaMessage) (*types.MQTTMessage, error) {
+	mqttTopic, ok := kafkaMsg.Header(HeaderMQTTTopic)
+	if !ok || mqttTopic == "" {
+		return nil, fmt.Errorf("missing %s header in raw Kafka message", HeaderMQTTTopic)
+	}
+
+	mqttMsg := &types.MQTTMessage{
+		Topic:     mqttTopic,
+		Payload:   kafkaMsg.Value,
+		Timestamp: time.Now(),
+	}
+
+	if qosVal, ok := kafkaMsg.Header(HeaderQoS); ok {
+		qos, err := strconv.Atoi(qosVal)
+		if err != nil || qos < 0 || qos > 2 {
+			return nil, fmt.Errorf("invalid %s header: %q", HeaderQoS, qosVal)
+		}
+		mqttMsg.QoS = byte(qos)
+	}
+
+	if retainedVal, ok := kafkaMsg.Header(HeaderRetained); ok {
+		retained, err := strconv.ParseBool(retainedVal)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s header: %q", HeaderRetained, retainedVal)
+		}
+		mqttMsg.Retained = retained
+	}
+
+	if timestampVal, ok := kafkaMsg.Header(HeaderTimestamp); ok {
+		if parsedTime, err := time.Parse(time.RFC3339Nano, timestampVal); err == nil {
+			mqttMsg.Timestamp = parsedTime
+		}
+	}
+
+	return mqttMsg, nil
+}
+
+// jsonEnvelope holds the metadata fields of the JSON envelope. The payload is written
+// separately by marshalJSONEnvelope so embedded JSON payloads keep their formatting.
+type jsonEnvelope struct {
+	MessageID       string    `json:"message_id,omitempty"`
+	PayloadType     string    `json:"payload_type"`
+	PayloadEncoding string    `json:"payload_encoding,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+	QoS             byte      `json:"qos"`
+	Retained        bool      `json:"retained"`
+	MQTTTopic       string    `json:"mqtt_topic"`
+}
+
+// marshalJSONEnvelope writes the envelope with payloadJSON verbatim as its payload field.
+// json.Marshal would compact embedded payloads, which loses their original bytes.
+func marshalJSONEnvelope(payloadJSON []byte, metadata *jsonEnvelope) ([]byte, error) {
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	
+	envelope := make([]byte, 0, len(payloadJSON)+len(metadataJSON)+12)
+	envelope = append(envelope, `{"payload":`...)
+	envelope = append(envelope, payloadJSON...)
+	envelope = append(envelope, ',')
+	return append(envelope, metadataJSON[1:]...), nil
+}
+
+// envelopeField decodes a JSON envelope field into target. It reports false when the
+// field is missing, null or of the wrong type.
+func envelopeField(fields map[string]json.RawMessage, key string, target interface{}) bool {
+	raw, ok := fields[key]
+	if !ok || string(raw) == "null" {
+		return false
+	}
+	return json.Unmarshal(raw, target) == nil
+}
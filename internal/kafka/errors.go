@@ -0,0 +1,69 @@
+package kafka
+
+import (
+	"errors"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// permanentErrors are the Kafka error codes writing the same record again can't fix:
+// invalid or refused records and topics, and missing authorization
+var permanentErrors = map[kafka.Error]bool{
+	kafka.MessageSizeTooLarge:                true,
+	kafka.InvalidTopic:                       true,
+	kafka.RecordListTooLarge:                 true,
+	kafka.InvalidRequiredAcks:                true,
+	kafka.TopicAuthorizationFailed:           true,
+	kafka.GroupAuthorizationFailed:           true,
+	kafka.ClusterAuthorizationFailed:         true,
+	kafka.UnsupportedSASLMechanism:           true,
+	kafka.IllegalSASLState:                   true,
+	kafka.UnsupportedForMessageFormat:        true,
+	kafka.PolicyViolation:                    true,
+	kafka.TransactionalIDAuthorizationFailed: true,
+	kafka.SASLAuthenticationFailed:           true,
+	kafka.InvalidRecord:                      true,
+}
+
+// IsPermanentError reports whether a write failed for a reason retrying can't fix, such
+// as a refused topic or missing authorization. Network errors, unavailable leaders and
+// unknown errors are treated as transient. A batch failed permanently if all its failed
+// records did.
+func IsPermanentError(err error) bool {
+	if errors.Is(err, ErrTopicNotAllowed) {
+		return true
+	}
+
+	var writeErrors kafka.WriteErrors
+	if errors.As(err, &writeErrors) && writeErrors.Count() > 0 {
+		for _, writeErr := range writeErrors {
+			if writeErr != nil && !IsPermanentError(writeErr) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var kafkaErr kafka.Error
+	return errors.As(err, &kafkaErr) && permanentErrors[kafkaErr]
+}
+
+// FailedWrites returns the indexes of the count messages a write didn't store. A partial
+// write of the non-transactional writer lists the failed messages, any other error means
+// none were written.
+func FailedWrites(err error, count int) []int {
+	if err == nil {
+		return nil
+	}
+
+	var writeErrors kafka.WriteErrors
+	partial := errors.As(err, &writeErrors) && len(writeErrors) == count
+
+	var failed []int
+	for i := 0; i < count; i++ {
+		if !partial || writeErrors[i] != nil {
+			failed = append(failed, i)
+		}
+	}
+	return failed
+}
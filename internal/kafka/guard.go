@@ -0,0 +1,167 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"gom2k/pkg/types"
+)
+
+// Policies for messages whose Kafka topic the topic guard refuses
+const (
+	DisallowedDLQ      = "dlq"       // Send the message straight to the dead letter queue
+	DisallowedDrop     = "drop"      // Drop the message with a log entry
+	DisallowedCatchAll = "catch_all" // Write the message to the catch-all topic instead
+)
+
+// DefaultCreationWindow is the window of the topic creation quota if none is configured
+const DefaultCreationWindow = time.Hour
+
+// ErrTopicNotAllowed is returned for writes to topics the topic guard refuses,
+// either because of the allow and deny lists or because the creation quota is used up
+var ErrTopicNotAllowed = errors.New("topic not allowed")
+
+// TopicGuard decides which Kafka topics the bridge may write and limits how many
+// topics it creates within a sliding time window. This type is thread-safe.
+type TopicGuard struct {
+	allow      []*regexp.Regexp
+	deny       []*regexp.Regexp
+	exempt     map[string]bool // Topics of the bridge itself, never refused
+	maxCreated int
+	window     time.Duration
+	policy     string
+	catchAll   string
+
+	mutex   sync.Mutex
+	created []time.Time // Creation times within the current window, oldest first
+}
+
+// NewTopicGuard compiles the topic guard settings. Exempt topics, such as the dead letter
+// topic, are always allowed and don't count towards the creation quota. The catch-all
+// topic is exempt as well. It returns an error if a pattern or setting is invalid.
+func NewTopicGuard(config *types.TopicGuardConfig, exempt ...string) (*TopicGuard, error) {
+	guard := &TopicGuard{
+		exempt:     make(map[string]bool),
+		maxCreated: config.MaxCreatedTopics,
+		window:     config.CreationWindow,
+		policy:     config.DisallowedPolicy,
+		catchAll:   config.CatchAllTopic,
+	}
+
+	var err error
+	if guard.allow, err = compileTopicPatterns("allow", config.Allow); err != nil {
+		return nil, err
+	}
+	if guard.deny, err = compileTopicPatterns("deny", config.Deny); err != nil {
+		return nil, err
+	}
+
+	if guard.maxCreated < 0 {
+		return nil, fmt.Errorf("max_created_topics must be positive, got %d", guard.maxCreated)
+	}
+	if guard.window < 0 {
+		return nil, fmt.Errorf("creation_window must be positive, got %v", guard.window)
+	}
+	if guard.window == 0 {
+		guard.window = DefaultCreationWindow
+	}
+
+	switch guard.policy {
+	case "":
+		guard.policy = DisallowedDLQ
+	case DisallowedDLQ, DisallowedDrop:
+	case DisallowedCatchAll:
+		if guard.catchAll == "" {
+			return nil, fmt.Errorf("disallowed_policy catch_all requires catch_all_topic")
+		}
+	default:
+		return nil, fmt.Errorf("unknown disallowed_policy %q (expected dlq, drop or catch_all)", guard.policy)
+	}
+
+	for _, topic := range append(exempt, guard.catchAll) {
+		if topic != "" {
+			guard.exempt[topic] = true
+		}
+	}
+
+	return guard, nil
+}
+
+// compileTopicPatterns compiles topic patterns anchored to the whole topic name
+func compileTopicPatterns(list string, patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for i, pattern := range patterns {
+		if pattern == "" {
+			return nil, fmt.Errorf("%s pattern %d is empty", list, i)
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %d: %w", list, i, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// Policy returns how messages for refused topics are handled: dlq, drop or catch_all
+func (g *TopicGuard) Policy() string {
+	return g.policy
+}
+
+// CatchAllTopic returns the topic receiving refused messages with the catch_all policy
+func (g *TopicGuard) CatchAllTopic() string {
+	return g.catchAll
+}
+
+// Check returns an error wrapping ErrTopicNotAllowed if the bridge must not write the topic.
+// Deny patterns win over allow patterns, an empty allow list allows every topic.
+func (g *TopicGuard) Check(topic string) error {
+	if g.exempt[topic] {
+		return nil
+	}
+
+	for _, pattern := range g.deny {
+		if pattern.MatchString(topic) {
+			return fmt.Errorf("%w: %s matches deny pattern %s", ErrTopicNotAllowed, topic, pattern)
+		}
+	}
+
+	if len(g.allow) == 0 {
+		return nil
+	}
+	for _, pattern := range g.allow {
+		if pattern.MatchString(topic) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s matches no allow pattern", ErrTopicNotAllowed, topic)
+}
+
+// ReserveCreation takes a slot of the creation quota for a topic about to be created.
+// Failed creations keep their slot, so a broker rejecting topics doesn't get flooded
+// with requests either. It returns an error wrapping ErrTopicNotAllowed if the quota
+// of the current window is used up.
+func (g *TopicGuard) ReserveCreation(topic string, now time.Time) error {
+	if g.maxCreated == 0 || g.exempt[topic] {
+		return nil
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// Drop creations that left the window
+	expired := 0
+	for expired < len(g.created) && now.Sub(g.created[expired]) >= g.window {
+		expired++
+	}
+	g.created = g.created[expired:]
+
+	if len(g.created) >= g.maxCreated {
+		return fmt.Errorf("%w: creating %s would exceed %d topics per %v", ErrTopicNotAllowed, topic, g.maxCreated, g.window)
+	}
+	g.created = append(g.created, now)
+	return nil
+}
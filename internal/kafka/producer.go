@@ -5,33 +5,38 @@
 package kafka
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net"
-	"os"
 	"strings"
 	"sync"
 	"time"
 
 	"gom2k/pkg/types"
 
-	"software.sslmate.com/src/go-pkcs12"
 	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/compress"
 )
 
 // Producer handles sending messages to Kafka topics with SSL support and automatic topic creation.
-// It maintains a connection pool, tracks created topics to avoid duplicate creation attempts,
+// It maintains a connection pool, tracks verified topics to avoid repeated metadata lookups,
 // and provides thread-safe operations for concurrent message publishing.
 type Producer struct {
-	config        *types.KafkaConfig     // Kafka connection and security configuration
-	bridgeConfig  *types.BridgeConfig    // Bridge-specific settings like topic creation parameters
-	writer        *kafka.Writer          // Underlying Kafka writer for message production
-	createdTopics map[string]bool        // Cache of topics already created by this producer
-	topicMutex    sync.RWMutex          // Protects the createdTopics map from concurrent access
+	config         *types.KafkaConfig    // Kafka connection and security configuration
+	bridgeConfig   *types.BridgeConfig   // Bridge-specific settings like topic creation parameters
+	writer         *kafka.Writer         // Underlying Kafka writer for message production
+	verifiedTopics map[string]bool       // Cache of topics verified to exist with partition leaders
+	topicMutex     sync.RWMutex          // Protects the verifiedTopics and topicLocks maps from concurrent access
+	topicLocks     map[string]*sync.Mutex // Serializes the verification of each topic
+	topicRules     *TopicRules           // Partitions, replication and configs of auto-created topics
+	guard          *TopicGuard           // Refuses disallowed topics and limits topic creation
+	admin          *AdminClient          // Creates topics through the cluster controller
+	transactions   *transactionalWriter  // Writes in Kafka transactions, nil unless transactional
+	transport      *kafka.Transport      // Connections used by the transactional writer
 }
 
 // NewProducer creates a new Kafka producer with the provided configuration.
@@ -39,9 +44,44 @@ type Producer struct {
 // create topics based on the bridge configuration settings.
 func NewProducer(config *types.KafkaConfig, bridgeConfig *types.BridgeConfig) *Producer {
 	return &Producer{
-		config:        config,
-		bridgeConfig:  bridgeConfig,
-		createdTopics: make(map[string]bool),
+		config:         config,
+		bridgeConfig:   bridgeConfig,
+		verifiedTopics: make(map[string]bool),
+		topicLocks:     make(map[string]*sync.Mutex),
+	}
+}
+
+// Roles of the producers of a bridge instance, appended to the transactional ID
+const (
+	ProducerRoleMQTTToKafka = "mqtt-to-kafka" // Forwards MQTT messages
+	ProducerRoleDeadLetter  = "dlq"           // Writes dead letters of the Kafka→MQTT direction
+	ProducerRoleReplay      = "dlq-replay"    // Replays dead letters from the CLI
+	ProducerRoleTest        = "test"          // Connectivity tests of the CLI
+)
+
+// ProducerConfig returns a copy of the Kafka settings for a producer with the given role.
+// A transactional ID can only be used by one producer at a time, the broker fences the
+// others, so each producer of a bridge instance gets its role appended.
+func ProducerConfig(config *types.KafkaConfig, role string) *types.KafkaConfig {
+	producerConfig := *config
+	if producerConfig.Producer.TransactionalID != "" {
+		producerConfig.Producer.TransactionalID += "-" + role
+	}
+	return &producerConfig
+}
+
+// ParseRequiredAcks parses a required acknowledgements setting: all, one or none.
+// An empty setting means all, so writes wait for the full in-sync replica set.
+func ParseRequiredAcks(name string) (kafka.RequiredAcks, error) {
+	switch name {
+	case "", "all":
+		return kafka.RequireAll, nil
+	case "one":
+		return kafka.RequireOne, nil
+	case "none":
+		return kafka.RequireNone, nil
+	default:
+		return kafka.RequireAll, fmt.Errorf("unknown required acks %q (expected all, one or none)", name)
 	}
 }
 
@@ -49,83 +89,147 @@ func NewProducer(config *types.KafkaConfig, bridgeConfig *types.BridgeConfig) *P
 // It configures SSL/TLS settings if specified in the configuration and sets up
 // hash-based partitioning for consistent message distribution based on message keys.
 func (p *Producer) Connect() error {
-	// Create writer configuration
+	requiredAcks, err := ParseRequiredAcks(p.config.Producer.RequiredAcks)
+	if err != nil {
+		return fmt.Errorf("invalid producer required acks: %w", err)
+	}
+	
+	topicRules, err := NewTopicRules(&p.bridgeConfig.Kafka)
+	if err != nil {
+		return fmt.Errorf("invalid topic rules: %w", err)
+	}
+	p.topicRules = topicRules
+	
+	// The dead letter topic must stay writable whatever the guard patterns say
+	guard, err := NewTopicGuard(&p.bridgeConfig.Kafka.Guard, p.bridgeConfig.DeadLetter.KafkaTopic)
+	if err != nil {
+		return fmt.Errorf("invalid topic guard: %w", err)
+	}
+	p.guard = guard
+	
+	// Create writer configuration, zero values fall back to kafka-go defaults
 	writerConfig := kafka.WriterConfig{
-		Brokers: p.config.Brokers,
-		Balancer: &kafka.Hash{}, // Use hash balancer for key-based partitioning
+		Brokers:      p.config.Brokers,
+		Balancer:     &kafka.Hash{}, // Use hash balancer for key-based partitioning
+		MaxAttempts:  p.config.Producer.MaxAttempts,
+		WriteTimeout: p.config.Producer.WriteTimeout,
+		BatchBytes:   int(p.config.Producer.BatchBytes),
 	}
 	
-	// Configure SSL/TLS if specified
-	if strings.ToUpper(p.config.Security.Protocol) == "SSL" {
-		tlsConfig, err := p.createTLSConfig()
-		if err != nil {
-			return fmt.Errorf("failed to create TLS config: %w", err)
-		}
-		
-		// Create dialer with TLS
-		dialer := &kafka.Dialer{
-			TLS: tlsConfig,
+	// Configure record batch compression
+	compression, err := ParseCompression(p.config.Producer.Compression)
+	if err != nil {
+		return fmt.Errorf("invalid producer compression: %w", err)
+	}
+	writerConfig.CompressionCodec = compression.Codec()
+	
+	// Data and admin connections share the dialer with the TLS settings
+	dialer, err := newDialer(p.config)
+	if err != nil {
+		return err
+	}
+	writerConfig.Dialer = dialer
+	p.admin = NewAdminClient(p.config.Brokers, dialer)
+	
+	if p.config.Producer.Transactional {
+		if requiredAcks != kafka.RequireAll {
+			return fmt.Errorf("transactional producer requires acks from all replicas, got %s", requiredAcks)
 		}
-		writerConfig.Dialer = dialer
+		p.connectTransactional(dialer.TLS, compression)
 	}
 	
 	p.writer = kafka.NewWriter(writerConfig)
+	// WriterConfig treats 0 (none) as unset and requires all, so acks are set on the writer
+	p.writer.RequiredAcks = requiredAcks
 	
 	log.Printf("Kafka producer initialized with brokers: %v", p.config.Brokers)
+	log.Printf("Kafka producer delivery: acks=%s, max_attempts=%d, write_timeout=%v, batch_bytes=%d, compression=%s",
+		requiredAcks, p.writer.MaxAttempts, p.writer.WriteTimeout, p.writer.BatchBytes, compression)
 	return nil
 }
 
-// WriteMessage sends a message to Kafka
-func (p *Producer) WriteMessage(ctx context.Context, msg *types.KafkaMessage) error {
-	kafkaMsg := kafka.Message{
-		Topic: msg.Topic,
-		Key:   []byte(msg.Key),
-		Value: msg.Value,
+// connectTransactional sets up the transactional writer. Connections are established
+// lazily, the producer session is initialized on the first write.
+func (p *Producer) connectTransactional(tlsConfig *tls.Config, compression compress.Compression) {
+	p.transport = &kafka.Transport{TLS: tlsConfig}
+	client := &kafka.Client{
+		Addr:      kafka.TCP(p.config.Brokers...),
+		Timeout:   p.config.Producer.WriteTimeout,
+		Transport: p.transport,
 	}
 	
-	err := p.writer.WriteMessages(ctx, kafkaMsg)
-	if err != nil {
-		// If auto-creation is enabled, try to create the topic and retry once
-		if p.bridgeConfig.Kafka.AutoCreateTopics {
-			if createErr := p.createTopicIfNeeded(ctx, msg.Topic); createErr != nil {
-				return fmt.Errorf("failed to create topic %s: %w", msg.Topic, createErr)
-			}
-			
-			// Single retry after topic creation with brief delay
-			time.Sleep(500 * time.Millisecond)
-			if retryErr := p.writer.WriteMessages(ctx, kafkaMsg); retryErr == nil {
-				return nil
-			}
-		}
-		// Return original error - Kafka client gives clear error messages
-		return fmt.Errorf("failed to write message to Kafka: %w", err)
+	p.transactions = newTransactionalWriter(client, p.config.Producer.TransactionalID, p.config.Producer.TransactionTimeout, compression)
+	if p.bridgeConfig.Kafka.AutoCreateTopics {
+		// Topics are verified before writes, the client may just not have seen new ones yet
+		p.transactions.topicTimeout = p.topicCreationTimeout()
 	}
 	
-	return nil
+	log.Printf("Kafka producer is transactional (transactional ID: %s, timeout: %v)",
+		p.config.Producer.TransactionalID, p.config.Producer.TransactionTimeout)
 }
 
-// WriteMessages sends multiple messages to Kafka
+// WriteMessage sends a message to Kafka. With auto_create_topics, a topic new to
+// this producer is verified (and created if needed) before the write.
+func (p *Producer) WriteMessage(ctx context.Context, msg *types.KafkaMessage) error {
+	return p.WriteMessages(ctx, []*types.KafkaMessage{msg})
+}
+
+// WriteMessages sends multiple messages to Kafka. A transactional producer commits
+// them in a single transaction. Writes to topics refused by the topic guard fail with
+// an error wrapping ErrTopicNotAllowed, unless the guard redirects them to its catch-all topic.
 func (p *Producer) WriteMessages(ctx context.Context, messages []*types.KafkaMessage) error {
+	messages, err := p.prepareTopics(ctx, messages)
+	if err != nil {
+		return err
+	}
+	
+	topics := messageTopics(messages)
+	if p.transactions != nil {
+		if err := p.transactions.write(ctx, messages); err != nil {
+			p.forgetTopics(topics...)
+			return err
+		}
+		return nil
+	}
+	
 	kafkaMessages := make([]kafka.Message, len(messages))
 	
 	for i, msg := range messages {
 		kafkaMessages[i] = kafka.Message{
-			Topic: msg.Topic,
-			Key:   []byte(msg.Key),
-			Value: msg.Value,
+			Topic:   msg.Topic,
+			Key:     []byte(msg.Key),
+			Value:   msg.Value,
+			Headers: toKafkaHeaders(msg.Headers),
 		}
 	}
 	
-	err := p.writer.WriteMessages(ctx, kafkaMessages...)
+	err = p.writer.WriteMessages(ctx, kafkaMessages...)
 	if err != nil {
+		p.forgetTopics(topics...)
 		return fmt.Errorf("failed to write messages to Kafka: %w", err)
 	}
 	
 	return nil
 }
 
+// toKafkaHeaders converts internal message headers to kafka-go record headers
+func toKafkaHeaders(headers []types.KafkaHeader) []kafka.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+	
+	kafkaHeaders := make([]kafka.Header, len(headers))
+	for i, header := range headers {
+		kafkaHeaders[i] = kafka.Header{Key: header.Key, Value: header.Value}
+	}
+	return kafkaHeaders
+}
+
 // Close closes the producer
 func (p *Producer) Close() error {
+	if p.transport != nil {
+		p.transport.CloseIdleConnections()
+	}
 	if p.writer != nil {
 		log.Println("Closing Kafka producer")
 		return p.writer.Close()
@@ -133,248 +237,230 @@ func (p *Producer) Close() error {
 	return nil
 }
 
-// Helper function to create TLS configuration for SSL
-func (p *Producer) createTLSConfig() (*tls.Config, error) {
-	tlsConfig := &tls.Config{}
-	
-	// Load truststore (CA certificates)
-	if p.config.Security.SSL.Truststore.Location != "" {
-		if _, err := os.Stat(p.config.Security.SSL.Truststore.Location); os.IsNotExist(err) {
-			return nil, fmt.Errorf("truststore file not found: %s", p.config.Security.SSL.Truststore.Location)
+// prepareTopics applies the topic guard to the topics of messages and, with auto_create_topics,
+// makes sure they exist. With the catch_all policy, messages for refused topics are redirected
+// to the catch-all topic, with any other policy the refusal is returned.
+func (p *Producer) prepareTopics(ctx context.Context, messages []*types.KafkaMessage) ([]*types.KafkaMessage, error) {
+	refused := make(map[string]bool)
+	for _, topic := range messageTopics(messages) {
+		var err error
+		if p.guard != nil {
+			err = p.guard.Check(topic)
 		}
-		
-		log.Printf("Loading truststore: %s", p.config.Security.SSL.Truststore.Location)
-		
-		caCerts, err := p.loadTruststorePKCS12(p.config.Security.SSL.Truststore.Location, p.config.Security.SSL.Truststore.Password)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load truststore: %w", err)
+		if err == nil && p.bridgeConfig.Kafka.AutoCreateTopics {
+			err = p.ensureTopics(ctx, topic)
 		}
-		
-		tlsConfig.RootCAs = caCerts
-		log.Printf("Loaded CA certificates from truststore")
-	}
-	
-	// Load client keystore (client certificate for mutual TLS)
-	if p.config.Security.SSL.Keystore.Location != "" {
-		if _, err := os.Stat(p.config.Security.SSL.Keystore.Location); os.IsNotExist(err) {
-			return nil, fmt.Errorf("keystore file not found: %s", p.config.Security.SSL.Keystore.Location)
+		if err == nil {
+			continue
 		}
 		
-		log.Printf("Loading keystore: %s", p.config.Security.SSL.Keystore.Location)
-		
-		clientCert, err := p.loadKeystorePKCS12(
-			p.config.Security.SSL.Keystore.Location,
-			p.config.Security.SSL.Keystore.Password,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load keystore: %w", err)
+		if !errors.Is(err, ErrTopicNotAllowed) || p.guard.Policy() != DisallowedCatchAll {
+			return nil, err
 		}
-		
-		tlsConfig.Certificates = []tls.Certificate{clientCert}
-		log.Println("Loaded client certificate from keystore")
+		refused[topic] = true
 	}
-	
-	return tlsConfig, nil
-}
-
-// loadTruststorePKCS12 loads CA certificates from a PKCS#12 truststore
-func (p *Producer) loadTruststorePKCS12(filename, password string) (*x509.CertPool, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, err
+	if len(refused) == 0 {
+		return messages, nil
 	}
 	
-	log.Printf("Attempting to load PKCS#12 with password length: %d", len(password))
-	
-	// Parse PKCS#12 truststore data
-	certs, err := pkcs12.DecodeTrustStore(data, password)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode PKCS#12 truststore (check password): %w", err)
+	catchAll := p.guard.CatchAllTopic()
+	if p.bridgeConfig.Kafka.AutoCreateTopics {
+		if err := p.ensureTopics(ctx, catchAll); err != nil {
+			return nil, err
+		}
 	}
 	
-	certPool := x509.NewCertPool()
-	
-	// Add all certificates from truststore
-	for _, cert := range certs {
-		certPool.AddCert(cert)
-		log.Printf("Added CA certificate: %s", cert.Subject.CommonName)
+	redirected := make([]*types.KafkaMessage, len(messages))
+	for i, msg := range messages {
+		redirected[i] = msg
+		if refused[msg.Topic] {
+			redirected[i] = redirectMessage(msg, catchAll)
+		}
 	}
-	
-	if len(certs) == 0 {
-		log.Println("Warning: no certificates found in truststore")
+	return redirected, nil
+}
+
+// redirectMessage returns a copy of a message for another topic. The topic it was mapped
+// to is recorded in a header, so consumers of the catch-all topic can tell messages apart.
+func redirectMessage(msg *types.KafkaMessage, topic string) *types.KafkaMessage {
+	redirected := *msg
+	redirected.Topic = topic
+	redirected.Headers = append(make([]types.KafkaHeader, 0, len(msg.Headers)+1), msg.Headers...)
+	redirected.Headers = append(redirected.Headers, types.KafkaHeader{Key: HeaderKafkaTopic, Value: []byte(msg.Topic)})
+	return &redirected
+}
+
+// ensureTopics verifies that topics exist before they are written, creating them when needed.
+// Verified topics are cached so metadata is only read for topics new to this producer.
+func (p *Producer) ensureTopics(ctx context.Context, topics ...string) error {
+	for _, topic := range topics {
+		p.topicMutex.RLock()
+		verified := p.verifiedTopics[topic]
+		p.topicMutex.RUnlock()
+		if verified {
+			continue
+		}
+		
+		if err := p.ensureTopic(ctx, topic); err != nil {
+			return err
+		}
 	}
-	
-	return certPool, nil
+	return nil
 }
 
-// loadKeystorePKCS12 loads client certificate and private key from a PKCS#12 keystore
-func (p *Producer) loadKeystorePKCS12(filename, password string) (tls.Certificate, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return tls.Certificate{}, err
+// ensureTopic checks a topic's metadata, creates it if it's missing and waits until every
+// partition has a leader. This function is thread-safe, concurrent writers to a new topic
+// wait for the first one to finish while writes to other topics go on.
+func (p *Producer) ensureTopic(ctx context.Context, topicName string) error {
+	lock := p.topicLock(topicName)
+	lock.Lock()
+	defer lock.Unlock()
+	
+	p.topicMutex.RLock()
+	verified := p.verifiedTopics[topicName]
+	p.topicMutex.RUnlock()
+	if verified {
+		return nil
 	}
 	
-	log.Printf("Attempting to load PKCS#12 keystore with password length: %d", len(password))
+	// Only topics that have to be created count towards the creation quota
+	if p.guard != nil && p.bridgeConfig.Kafka.Guard.MaxCreatedTopics > 0 {
+		exists, err := p.admin.TopicExists(ctx, topicName)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if err := p.guard.ReserveCreation(topicName, time.Now()); err != nil {
+				return err
+			}
+		}
+	}
 	
-	// Parse PKCS#12 data
-	privateKey, cert, err := pkcs12.Decode(data, password)
+	config := p.buildTopicConfig(topicName)
+	created, err := p.admin.EnsureTopic(ctx, config, p.topicCreationTimeout())
 	if err != nil {
-		return tls.Certificate{}, fmt.Errorf("failed to decode PKCS#12 keystore (check password): %w", err)
+		return err
 	}
-	
-	if privateKey == nil || cert == nil {
-		return tls.Certificate{}, fmt.Errorf("no private key or certificate found in keystore")
+	if created {
+		log.Printf("✓ Created Kafka topic: %s (partitions: %d, replication: %d%s)", 
+			topicName, config.NumPartitions, config.ReplicationFactor, formatConfigEntries(config.ConfigEntries))
 	}
 	
-	// Create certificate chain
-	var certChain [][]byte
-	certChain = append(certChain, cert.Raw)
-	
-	// Create TLS certificate
-	tlsCert := tls.Certificate{
-		Certificate: certChain,
-		PrivateKey:  privateKey,
-	}
-	
-	log.Printf("Loaded client certificate: %s", cert.Subject.CommonName)
-	return tlsCert, nil
+	p.topicMutex.Lock()
+	p.verifiedTopics[topicName] = true
+	p.topicMutex.Unlock()
+	return nil
 }
 
-// createTopicIfNeeded creates a Kafka topic if it doesn't exist and hasn't been created by this producer.
-// This function is thread-safe and caches created topics to avoid duplicate operations.
-func (p *Producer) createTopicIfNeeded(ctx context.Context, topicName string) error {
+// topicLock returns the lock serializing the verification of a topic
+func (p *Producer) topicLock(topicName string) *sync.Mutex {
 	p.topicMutex.Lock()
 	defer p.topicMutex.Unlock()
 	
-	if p.isTopicAlreadyCreated(topicName) {
-		return nil
-	}
-	
-	conn, err := p.createKafkaConn()
-	if err != nil {
-		return fmt.Errorf("failed to create Kafka connection: %w", err)
-	}
-	defer conn.Close()
-	
-	if err := p.createTopicWithConfig(conn, topicName); err != nil {
-		return err
+	lock, exists := p.topicLocks[topicName]
+	if !exists {
+		lock = &sync.Mutex{}
+		p.topicLocks[topicName] = lock
 	}
-	
-	p.markTopicAsCreated(topicName)
-	p.waitForTopicPropagation()
-	
-	return nil
+	return lock
 }
 
-// isTopicAlreadyCreated checks if we've already attempted to create this topic locally.
-func (p *Producer) isTopicAlreadyCreated(topicName string) bool {
-	return p.createdTopics[topicName]
+// topicCreationTimeout returns how long to wait for new topics to become writable
+func (p *Producer) topicCreationTimeout() time.Duration {
+	if p.bridgeConfig.Kafka.CreationTimeout > 0 {
+		return p.bridgeConfig.Kafka.CreationTimeout
+	}
+	return DefaultTopicCreationTimeout
 }
 
-// createTopicWithConfig handles the actual topic creation with proper configuration.
-func (p *Producer) createTopicWithConfig(conn *kafka.Conn, topicName string) error {
-	config := p.buildTopicConfig(topicName)
-	
-	log.Printf("Creating Kafka topic: %s (partitions: %d, replication: %d)", 
-		topicName, config.NumPartitions, config.ReplicationFactor)
+// forgetTopics drops topics from the verified cache after failed writes, so the next
+// write checks again whether they still exist
+func (p *Producer) forgetTopics(topics ...string) {
+	p.topicMutex.Lock()
+	defer p.topicMutex.Unlock()
 	
-	err := conn.CreateTopics(config)
-	return p.handleTopicCreationResult(err, topicName)
+	for _, topic := range topics {
+		delete(p.verifiedTopics, topic)
+	}
 }
 
-// buildTopicConfig constructs the topic configuration based on bridge settings.
-func (p *Producer) buildTopicConfig(topicName string) kafka.TopicConfig {
-	return kafka.TopicConfig{
-		Topic:             topicName,
-		NumPartitions:     p.bridgeConfig.Kafka.DefaultPartitions,
-		ReplicationFactor: p.bridgeConfig.Kafka.ReplicationFactor,
+// messageTopics returns the distinct topics of messages
+func messageTopics(messages []*types.KafkaMessage) []string {
+	seen := make(map[string]bool)
+	var topics []string
+	for _, msg := range messages {
+		if !seen[msg.Topic] {
+			seen[msg.Topic] = true
+			topics = append(topics, msg.Topic)
+		}
 	}
+	return topics
 }
 
-// handleTopicCreationResult processes the result of topic creation.
-func (p *Producer) handleTopicCreationResult(err error, topicName string) error {
-	if err != nil {
-		// Just log the error and continue - topic might already exist or have other issues
-		// The original write error will be returned to user if the topic truly doesn't work
-		log.Printf("Topic creation attempted for %s: %v", topicName, err)
-		return nil
+// buildTopicConfig constructs the topic configuration based on bridge settings
+// and the first matching topic rule.
+func (p *Producer) buildTopicConfig(topicName string) kafka.TopicConfig {
+	if p.topicRules == nil {
+		return kafka.TopicConfig{
+			Topic:             topicName,
+			NumPartitions:     p.bridgeConfig.Kafka.DefaultPartitions,
+			ReplicationFactor: p.bridgeConfig.Kafka.ReplicationFactor,
+		}
 	}
-	
-	log.Printf("✓ Successfully created Kafka topic: %s", topicName)
-	return nil
+	return p.topicRules.TopicConfig(topicName)
 }
 
-// markTopicAsCreated updates the local cache to indicate this topic has been processed.
-func (p *Producer) markTopicAsCreated(topicName string) {
-	p.createdTopics[topicName] = true
+// formatConfigEntries formats topic config entries for log messages
+func formatConfigEntries(entries []kafka.ConfigEntry) string {
+	var formatted strings.Builder
+	for _, entry := range entries {
+		fmt.Fprintf(&formatted, ", %s: %s", entry.ConfigName, entry.ConfigValue)
+	}
+	return formatted.String()
 }
 
-// waitForTopicPropagation allows time for the topic to propagate across the Kafka cluster.
-func (p *Producer) waitForTopicPropagation() {
-	time.Sleep(500 * time.Millisecond)
+// ConvertMQTTMessage converts an MQTT message to Kafka format
+func ConvertMQTTMessage(mqttMsg *types.MQTTMessage, kafkaTopic string) (*types.KafkaMessage, error) {
+	return convertMQTTMessageJSON(mqttMsg, kafkaTopic, &types.EnvelopeConfig{})
 }
 
-// createKafkaConn creates a connection to Kafka for admin operations
-func (p *Producer) createKafkaConn() (*kafka.Conn, error) {
-	var dialer *kafka.Dialer
+// convertMQTTMessageJSON wraps the MQTT payload in a JSON envelope with its metadata.
+// With embed_json, payloads that are valid JSON are embedded as-is. Other payloads are
+// stored as strings, base64 encoded when binary or when configured.
+func convertMQTTMessageJSON(mqttMsg *types.MQTTMessage, kafkaTopic string, envelope *types.EnvelopeConfig) (*types.KafkaMessage, error) {
+	// Create JSON payload with metadata
+	metadata := jsonEnvelope{
+		MessageID: mqttMsg.ID,
+		Timestamp: mqttMsg.Timestamp,
+		QoS:       mqttMsg.QoS,
+		Retained:  mqttMsg.Retained,
+		MQTTTopic: mqttMsg.Topic,
+	}
 	
-	// Configure SSL/TLS if specified
-	if strings.ToUpper(p.config.Security.Protocol) == "SSL" {
-		tlsConfig, err := p.createTLSConfig()
-		if err != nil {
-			return nil, fmt.Errorf("failed to create TLS config: %w", err)
-		}
-		
-		dialer = &kafka.Dialer{
-			Timeout:   10 * time.Second,
-			DualStack: true,
-			TLS:       tlsConfig,
-		}
+	var payloadJSON []byte
+	if envelope.EmbedJSON && json.Valid(mqttMsg.Payload) {
+		metadata.PayloadType = PayloadTypeJSON
+		payloadJSON = bytes.TrimSpace(mqttMsg.Payload)
 	} else {
-		dialer = &kafka.Dialer{
-			Timeout:   10 * time.Second,
-			DualStack: true,
+		payloadStr, encoding := types.EncodePayload(mqttMsg.Payload, envelope.PayloadEncoding == types.PayloadEncodingBase64)
+		metadata.PayloadType = PayloadTypeString
+		metadata.PayloadEncoding = encoding
+		
+		var err error
+		if payloadJSON, err = json.Marshal(payloadStr); err != nil {
+			return nil, fmt.Errorf("failed to marshal MQTT payload to JSON: %w", err)
 		}
 	}
 	
-	// Connect to the first broker
-	if len(p.config.Brokers) == 0 {
-		return nil, fmt.Errorf("no Kafka brokers configured")
-	}
-	
-	broker := p.config.Brokers[0]
-	host, port, err := net.SplitHostPort(broker)
-	if err != nil {
-		return nil, fmt.Errorf("invalid broker address %s: %w", broker, err)
-	}
-	
-	conn, err := dialer.DialContext(context.Background(), "tcp", net.JoinHostPort(host, port))
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Kafka broker %s: %w", broker, err)
-	}
-	
-	return conn, nil
-}
-
-// ConvertMQTTMessage converts an MQTT message to Kafka format
-func ConvertMQTTMessage(mqttMsg *types.MQTTMessage, kafkaTopic string) (*types.KafkaMessage, error) {
-	// Create JSON payload with metadata
-	payload := map[string]interface{}{
-		"payload":    string(mqttMsg.Payload),
-		"timestamp":  mqttMsg.Timestamp,
-		"qos":        mqttMsg.QoS,
-		"retained":   mqttMsg.Retained,
-		"mqtt_topic": mqttMsg.Topic,
-	}
-	
-	jsonPayload, err := json.Marshal(payload)
+	jsonPayload, err := marshalJSONEnvelope(payloadJSON, &metadata)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal MQTT message to JSON: %w", err)
 	}
 	
 	return &types.KafkaMessage{
-		Key:   mqttMsg.Topic, // Use MQTT topic as Kafka key for partitioning
-		Value: jsonPayload,
-		Topic: kafkaTopic,
+		Key:     mqttMsg.Topic, // Use MQTT topic as Kafka key for partitioning
+		Value:   jsonPayload,
+		Topic:   kafkaTopic,
+		Headers: messageIDHeaders(mqttMsg),
 	}, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,177 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"gom2k/pkg/types"
+)
+
+// Limits of the fetch requests of ReadTopic
+const (
+	topicReadMaxBytes        = 10e6
+	topicReadMaxWait         = time.Second
+	topicReadMaxEmptyFetches = 5 // Fetches in a row returning nothing before the end offset
+)
+
+// TopicRecord is a record read by ReadTopic with its position in the topic
+type TopicRecord struct {
+	Message   *types.KafkaMessage
+	Partition int
+	Offset    int64
+	Time      time.Time
+}
+
+// ReadTopic reads the records of a topic from the first offset up to the last stable offsets
+// at the time of the call and passes them to fn, partition by partition. Only committed
+// records of transactional producers are read. It reads without a consumer group, so no
+// offsets are committed and reading again returns the same records. An error returned by fn
+// stops reading.
+func ReadTopic(ctx context.Context, config *types.KafkaConfig, topic string, fn func(*TopicRecord) error) error {
+	dialer, err := newDialer(config)
+	if err != nil {
+		return err
+	}
+
+	partitions, err := NewAdminClient(config.Brokers, dialer).readTopic(ctx, topic)
+	if err != nil {
+		return fmt.Errorf("failed to read partitions of topic %s: %w", topic, err)
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf("topic %s not found", topic)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].ID < partitions[j].ID })
+
+	client := &kafka.Client{
+		Addr:      kafka.TCP(config.Brokers...),
+		Timeout:   dialer.Timeout,
+		Transport: &kafka.Transport{TLS: dialer.TLS},
+	}
+	ends, err := lastStableOffsets(ctx, client, topic, partitions)
+	if err != nil {
+		return err
+	}
+
+	for _, partition := range partitions {
+		if err := readPartition(ctx, dialer, partition, ends[partition.ID], fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lastStableOffsets returns the last stable offset of each partition: the end of the
+// records whose transactions are decided, or the end offset if there are no open ones
+func lastStableOffsets(ctx context.Context, client *kafka.Client, topic string, partitions []kafka.Partition) (map[int]int64, error) {
+	requests := make([]kafka.OffsetRequest, 0, len(partitions))
+	for _, partition := range partitions {
+		requests = append(requests, kafka.LastOffsetOf(partition.ID))
+	}
+
+	response, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics:         map[string][]kafka.OffsetRequest{topic: requests},
+		IsolationLevel: kafka.ReadCommitted,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read end offsets of topic %s: %w", topic, err)
+	}
+
+	ends := make(map[int]int64, len(partitions))
+	for _, offsets := range response.Topics[topic] {
+		if offsets.Error != nil {
+			return nil, fmt.Errorf("failed to read end offset of %s/%d: %w", topic, offsets.Partition, offsets.Error)
+		}
+		ends[offsets.Partition] = offsets.LastOffset
+	}
+	for _, partition := range partitions {
+		if _, ok := ends[partition.ID]; !ok {
+			return nil, fmt.Errorf("no end offset returned for %s/%d", topic, partition.ID)
+		}
+	}
+	return ends, nil
+}
+
+// readPartition reads the committed records of a partition from the leader up to the end
+// offset. Fetches return nothing for offsets holding only transaction markers or aborted
+// records; reading continues past them until the end offset is reached.
+func readPartition(ctx context.Context, dialer *kafka.Dialer, partition kafka.Partition, end int64, fn func(*TopicRecord) error) error {
+	conn, err := dialer.DialPartition(ctx, "tcp", "", partition)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the leader of %s/%d: %w", partition.Topic, partition.ID, err)
+	}
+	defer conn.Close()
+
+	first, err := conn.ReadFirstOffset()
+	if err != nil {
+		return fmt.Errorf("failed to read offsets of %s/%d: %w", partition.Topic, partition.ID, err)
+	}
+	if _, err := conn.Seek(first, kafka.SeekAbsolute); err != nil {
+		return fmt.Errorf("failed to seek %s/%d: %w", partition.Topic, partition.ID, err)
+	}
+
+	emptyFetches := 0
+	for offset := first; offset < end; {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		conn.SetReadDeadline(time.Now().Add(2 * topicReadMaxWait))
+		batch := conn.ReadBatchWith(kafka.ReadBatchConfig{
+			MinBytes:       1,
+			MaxBytes:       topicReadMaxBytes,
+			MaxWait:        topicReadMaxWait,
+			IsolationLevel: kafka.ReadCommitted,
+		})
+		start := offset
+		for offset < end {
+			msg, err := batch.ReadMessage()
+			if err != nil {
+				break
+			}
+			offset = msg.Offset + 1
+
+			record := &TopicRecord{Message: toMessage(msg), Partition: msg.Partition, Offset: msg.Offset, Time: msg.Time}
+			if err := fn(record); err != nil {
+				batch.Close()
+				return err
+			}
+		}
+		if err := batch.Close(); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read %s/%d at offset %d: %w", partition.Topic, partition.ID, offset, err)
+		}
+
+		// The batch moves past records it doesn't return, such as transaction markers, and
+		// the connection continues from there
+		if next := batch.Offset(); next > offset {
+			offset = next
+		}
+
+		// An empty fetch below the end offset is retried, it doesn't mean the end was reached
+		if offset > start {
+			emptyFetches = 0
+		} else if emptyFetches++; emptyFetches >= topicReadMaxEmptyFetches {
+			return fmt.Errorf("no records returned for %s/%d at offset %d before end offset %d", partition.Topic, partition.ID, offset, end)
+		}
+	}
+	return nil
+}
+
+// toMessage converts a kafka-go message to the internal message format
+func toMessage(kafkaMsg kafka.Message) *types.KafkaMessage {
+	msg := &types.KafkaMessage{
+		Topic:     kafkaMsg.Topic,
+		Partition: kafkaMsg.Partition,
+		Offset:    kafkaMsg.Offset,
+		Key:       string(kafkaMsg.Key),
+		Value:     kafkaMsg.Value,
+	}
+	for _, header := range kafkaMsg.Headers {
+		msg.Headers = append(msg.Headers, types.KafkaHeader{Key: header.Key, Value: header.Value})
+	}
+	return msg
+}
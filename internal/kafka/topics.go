@@ -0,0 +1,119 @@
+package kafka
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"gom2k/pkg/types"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// TopicRules resolves the configuration of topics created by the bridge from the
+// defaults and the per-topic rules. Rules are evaluated in order and the first rule
+// whose pattern matches the topic name wins.
+type TopicRules struct {
+	partitions        int
+	replicationFactor int
+	rules             []compiledTopicRule
+}
+
+// compiledTopicRule holds a topic rule with its pre-compiled pattern
+type compiledTopicRule struct {
+	rule    types.TopicRule
+	pattern *regexp.Regexp
+}
+
+// NewTopicRules compiles the topic rules of the given topic creation settings.
+// It returns an error if a rule has an invalid pattern or topic settings Kafka would reject.
+func NewTopicRules(config *types.TopicCreationConfig) (*TopicRules, error) {
+	rules := &TopicRules{
+		partitions:        config.DefaultPartitions,
+		replicationFactor: config.ReplicationFactor,
+	}
+
+	for i, rule := range config.TopicRules {
+		if rule.Match == "" {
+			return nil, fmt.Errorf("topic rule %d: match pattern is required", i)
+		}
+
+		// Anchor the pattern so it has to match the whole topic name
+		pattern, err := regexp.Compile("^(?:" + rule.Match + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("topic rule %d: invalid match pattern: %w", i, err)
+		}
+
+		if rule.Partitions < 0 {
+			return nil, fmt.Errorf("topic rule %d: partitions must be positive, got %d", i, rule.Partitions)
+		}
+		if rule.ReplicationFactor < 0 {
+			return nil, fmt.Errorf("topic rule %d: replication_factor must be positive, got %d", i, rule.ReplicationFactor)
+		}
+		if rule.RetentionMs < -1 {
+			return nil, fmt.Errorf("topic rule %d: retention_ms must be -1 (unlimited) or positive, got %d", i, rule.RetentionMs)
+		}
+		switch rule.CleanupPolicy {
+		case "", "delete", "compact", "compact,delete", "delete,compact":
+		default:
+			return nil, fmt.Errorf("topic rule %d: unknown cleanup_policy %q (expected delete, compact or compact,delete)", i, rule.CleanupPolicy)
+		}
+		if rule.MinInsyncReplicas < 0 {
+			return nil, fmt.Errorf("topic rule %d: min_insync_replicas must be positive, got %d", i, rule.MinInsyncReplicas)
+		}
+		if rule.SegmentBytes < 0 {
+			return nil, fmt.Errorf("topic rule %d: segment_bytes must be positive, got %d", i, rule.SegmentBytes)
+		}
+
+		// A topic whose writes need more in-sync replicas than it has can never be written with acks=all
+		replicationFactor := rule.ReplicationFactor
+		if replicationFactor == 0 {
+			replicationFactor = config.ReplicationFactor
+		}
+		if rule.MinInsyncReplicas > 0 && replicationFactor > 0 && rule.MinInsyncReplicas > replicationFactor {
+			return nil, fmt.Errorf("topic rule %d: min_insync_replicas %d exceeds the replication factor %d", i, rule.MinInsyncReplicas, replicationFactor)
+		}
+
+		rules.rules = append(rules.rules, compiledTopicRule{rule: rule, pattern: pattern})
+	}
+
+	return rules, nil
+}
+
+// TopicConfig returns the configuration for creating a topic
+func (r *TopicRules) TopicConfig(topic string) kafka.TopicConfig {
+	config := kafka.TopicConfig{
+		Topic:             topic,
+		NumPartitions:     r.partitions,
+		ReplicationFactor: r.replicationFactor,
+	}
+
+	for _, compiled := range r.rules {
+		if !compiled.pattern.MatchString(topic) {
+			continue
+		}
+
+		rule := compiled.rule
+		if rule.Partitions > 0 {
+			config.NumPartitions = rule.Partitions
+		}
+		if rule.ReplicationFactor > 0 {
+			config.ReplicationFactor = rule.ReplicationFactor
+		}
+		if rule.RetentionMs != 0 {
+			config.ConfigEntries = append(config.ConfigEntries, kafka.ConfigEntry{ConfigName: "retention.ms", ConfigValue: strconv.FormatInt(rule.RetentionMs, 10)})
+		}
+		if rule.CleanupPolicy != "" {
+			config.ConfigEntries = append(config.ConfigEntries, kafka.ConfigEntry{ConfigName: "cleanup.policy", ConfigValue: rule.CleanupPolicy})
+		}
+		if rule.MinInsyncReplicas > 0 {
+			config.ConfigEntries = append(config.ConfigEntries, kafka.ConfigEntry{ConfigName: "min.insync.replicas", ConfigValue: strconv.Itoa(rule.MinInsyncReplicas)})
+		}
+		if rule.SegmentBytes > 0 {
+			config.ConfigEntries = append(config.ConfigEntries, kafka.ConfigEntry{ConfigName: "segment.bytes", ConfigValue: strconv.FormatInt(rule.SegmentBytes, 10)})
+		}
+		break
+	}
+
+	return config
+}
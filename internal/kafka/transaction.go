@@ -0,0 +1,332 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"gom2k/pkg/types"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/compress"
+	"github.com/segmentio/kafka-go/protocol"
+)
+
+// transactionalAttribute marks a record batch as part of a transaction
+const transactionalAttribute = 1 << 4
+
+// castagnoliTable computes record batch checksums (CRC-32C)
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// RecordBatchHeader holds the idempotent producer fields of a record batch
+type RecordBatchHeader struct {
+	ProducerID    int64
+	ProducerEpoch int16
+	BaseSequence  int32 // Sequence number of the first record in the partition
+	Transactional bool
+	Compression   compress.Compression
+}
+
+// transactionalWriter produces records inside Kafka transactions. kafka-go's Writer can't
+// take part in transactions, so record batches are encoded here with the producer ID,
+// epoch and sequence numbers and sent with raw produce requests. Every write is one
+// transaction; read_committed consumers see all of its records or none of them.
+type transactionalWriter struct {
+	client          *kafka.Client
+	transactionalID string
+	timeout         time.Duration        // Transaction timeout enforced by the coordinator
+	compression     compress.Compression // Record batch compression
+	balancer        kafka.Balancer       // Same key based partitioning as the non-transactional writer
+	topicTimeout    time.Duration        // How long to wait for topics the client hasn't seen yet
+
+	mutex     sync.Mutex
+	session   *kafka.ProducerSession   // Producer ID and epoch, nil until initialized
+	sequences map[topicPartition]int32 // Next sequence number per partition
+}
+
+// topicPartition identifies a partition written by a transaction
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// newTransactionalWriter creates a writer using the given client
+func newTransactionalWriter(client *kafka.Client, transactionalID string, timeout time.Duration, compression compress.Compression) *transactionalWriter {
+	return &transactionalWriter{
+		client:          client,
+		transactionalID: transactionalID,
+		timeout:         timeout,
+		compression:     compression,
+		balancer:        &kafka.Hash{},
+	}
+}
+
+// write produces messages in a single transaction. When any step fails the transaction
+// is aborted and the producer session is initialized again for the next write, which
+// bumps the epoch and fences off anything left of the failed attempt.
+func (w *transactionalWriter) write(ctx context.Context, messages []*types.KafkaMessage) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.session == nil {
+		if err := w.initSession(ctx); err != nil {
+			return err
+		}
+	}
+
+	batches, err := w.partition(ctx, messages)
+	if err != nil {
+		return err
+	}
+
+	if err := w.commit(ctx, batches); err != nil {
+		w.abort(ctx)
+		return err
+	}
+	return nil
+}
+
+// initSession obtains a producer ID and epoch for the transactional ID. This also aborts
+// any transaction a previous instance with the same transactional ID left open.
+func (w *transactionalWriter) initSession(ctx context.Context) error {
+	res, err := w.client.InitProducerID(ctx, &kafka.InitProducerIDRequest{
+		TransactionalID:      w.transactionalID,
+		TransactionTimeoutMs: int(w.timeout / time.Millisecond),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize transactional producer %s: %w", w.transactionalID, err)
+	}
+	if res.Error != nil {
+		return fmt.Errorf("failed to initialize transactional producer %s: %w", w.transactionalID, res.Error)
+	}
+
+	w.session = res.Producer
+	w.sequences = make(map[topicPartition]int32)
+	log.Printf("Transactional producer %s initialized (producer ID: %d, epoch: %d)",
+		w.transactionalID, w.session.ProducerID, w.session.ProducerEpoch)
+	return nil
+}
+
+// partition groups messages by topic partition using the message keys. The client
+// serves metadata from a periodically refreshed cache, so topics that were just created
+// are waited for up to topicTimeout.
+func (w *transactionalWriter) partition(ctx context.Context, messages []*types.KafkaMessage) (map[topicPartition][]*types.KafkaMessage, error) {
+	partitions := make(map[string][]int)
+	for _, msg := range messages {
+		partitions[msg.Topic] = nil
+	}
+
+	topics := make([]string, 0, len(partitions))
+	for topic := range partitions {
+		topics = append(topics, topic)
+	}
+
+	deadline := time.Now().Add(w.topicTimeout)
+	for {
+		metadata, err := w.client.Metadata(ctx, &kafka.MetadataRequest{Topics: topics})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch topic metadata: %w", err)
+		}
+
+		var missing []string
+		for _, topic := range metadata.Topics {
+			if topic.Error != nil || len(topic.Partitions) == 0 {
+				missing = append(missing, topic.Name)
+				continue
+			}
+			ids := make([]int, len(topic.Partitions))
+			for i, partition := range topic.Partitions {
+				ids[i] = partition.ID
+			}
+			sort.Ints(ids)
+			partitions[topic.Name] = ids
+		}
+
+		if len(missing) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("topics not found: %v", missing)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+
+	batches := make(map[topicPartition][]*types.KafkaMessage)
+	for _, msg := range messages {
+		partition := w.balancer.Balance(kafka.Message{Key: []byte(msg.Key)}, partitions[msg.Topic]...)
+		tp := topicPartition{topic: msg.Topic, partition: partition}
+		batches[tp] = append(batches[tp], msg)
+	}
+	return batches, nil
+}
+
+// commit adds the partitions to the transaction, produces the batches and commits
+func (w *transactionalWriter) commit(ctx context.Context, batches map[topicPartition][]*types.KafkaMessage) error {
+	topics := make(map[string][]kafka.AddPartitionToTxn)
+	for tp := range batches {
+		topics[tp.topic] = append(topics[tp.topic], kafka.AddPartitionToTxn{Partition: tp.partition})
+	}
+
+	added, err := w.client.AddPartitionsToTxn(ctx, &kafka.AddPartitionsToTxnRequest{
+		TransactionalID: w.transactionalID,
+		ProducerID:      w.session.ProducerID,
+		ProducerEpoch:   w.session.ProducerEpoch,
+		Topics:          topics,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add partitions to transaction: %w", err)
+	}
+	for topic, partitions := range added.Topics {
+		for _, partition := range partitions {
+			if partition.Error != nil {
+				return fmt.Errorf("failed to add partition %s[%d] to transaction: %w", topic, partition.Partition, partition.Error)
+			}
+		}
+	}
+
+	for tp, messages := range batches {
+		recordSet, err := EncodeRecordBatch(messages, RecordBatchHeader{
+			ProducerID:    int64(w.session.ProducerID),
+			ProducerEpoch: int16(w.session.ProducerEpoch),
+			BaseSequence:  w.sequences[tp],
+			Transactional: true,
+			Compression:   w.compression,
+		}, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to encode record batch: %w", err)
+		}
+
+		res, err := w.client.RawProduce(ctx, &kafka.RawProduceRequest{
+			Topic:           tp.topic,
+			Partition:       tp.partition,
+			RequiredAcks:    kafka.RequireAll,
+			TransactionalID: w.transactionalID,
+			RawRecords:      protocol.RawRecordSet{Reader: bytes.NewReader(recordSet)},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write to %s[%d]: %w", tp.topic, tp.partition, err)
+		}
+		if res.Error != nil {
+			return fmt.Errorf("failed to write to %s[%d]: %w", tp.topic, tp.partition, res.Error)
+		}
+		w.sequences[tp] += int32(len(messages))
+	}
+
+	res, err := w.client.EndTxn(ctx, &kafka.EndTxnRequest{
+		TransactionalID: w.transactionalID,
+		ProducerID:      w.session.ProducerID,
+		ProducerEpoch:   w.session.ProducerEpoch,
+		Committed:       true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if res.Error != nil {
+		return fmt.Errorf("failed to commit transaction: %w", res.Error)
+	}
+	return nil
+}
+
+// abort aborts the current transaction on a best effort basis and drops the session
+func (w *transactionalWriter) abort(ctx context.Context) {
+	res, err := w.client.EndTxn(ctx, &kafka.EndTxnRequest{
+		TransactionalID: w.transactionalID,
+		ProducerID:      w.session.ProducerID,
+		ProducerEpoch:   w.session.ProducerEpoch,
+		Committed:       false,
+	})
+	if err == nil {
+		err = res.Error
+	}
+	if err != nil {
+		log.Printf("Failed to abort transaction, it is aborted when the producer reinitializes: %v", err)
+	}
+	w.session = nil
+}
+
+// EncodeRecordBatch encodes messages as a single v2 record batch, prefixed with its size
+// as a record set in a produce request
+func EncodeRecordBatch(messages []*types.KafkaMessage, header RecordBatchHeader, now time.Time) ([]byte, error) {
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("record batch must contain at least one record")
+	}
+
+	timestamp := now.UnixMilli()
+
+	var records bytes.Buffer
+	for i, msg := range messages {
+		var record []byte
+		record = append(record, 0)                     // attributes
+		record = binary.AppendVarint(record, 0)        // timestamp delta
+		record = binary.AppendVarint(record, int64(i)) // offset delta
+		record = appendVarintBytes(record, []byte(msg.Key))
+		record = appendVarintBytes(record, msg.Value)
+		record = binary.AppendVarint(record, int64(len(msg.Headers)))
+		for _, h := range msg.Headers {
+			record = appendVarintBytes(record, []byte(h.Key))
+			record = appendVarintBytes(record, h.Value)
+		}
+		records.Write(binary.AppendVarint(nil, int64(len(record))))
+		records.Write(record)
+	}
+
+	recordData := records.Bytes()
+	if codec := header.Compression.Codec(); codec != nil {
+		var compressed bytes.Buffer
+		writer := codec.NewWriter(&compressed)
+		if _, err := writer.Write(recordData); err != nil {
+			writer.Close()
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		recordData = compressed.Bytes()
+	}
+
+	attributes := int16(header.Compression) & 0x7
+	if header.Transactional {
+		attributes |= transactionalAttribute
+	}
+
+	// Fields covered by the CRC, from the attributes to the end of the batch
+	var body []byte
+	body = binary.BigEndian.AppendUint16(body, uint16(attributes))
+	body = binary.BigEndian.AppendUint32(body, uint32(len(messages)-1)) // last offset delta
+	body = binary.BigEndian.AppendUint64(body, uint64(timestamp))       // first timestamp
+	body = binary.BigEndian.AppendUint64(body, uint64(timestamp))       // max timestamp
+	body = binary.BigEndian.AppendUint64(body, uint64(header.ProducerID))
+	body = binary.BigEndian.AppendUint16(body, uint16(header.ProducerEpoch))
+	body = binary.BigEndian.AppendUint32(body, uint32(header.BaseSequence))
+	body = binary.BigEndian.AppendUint32(body, uint32(len(messages)))
+	body = append(body, recordData...)
+
+	// Partition leader epoch, magic byte and CRC precede the body
+	batchLength := 4 + 1 + 4 + len(body)
+
+	var batch []byte
+	batch = binary.BigEndian.AppendUint32(batch, uint32(8+4+batchLength)) // record set size
+	batch = binary.BigEndian.AppendUint64(batch, 0)                       // base offset
+	batch = binary.BigEndian.AppendUint32(batch, uint32(batchLength))
+	batch = binary.BigEndian.AppendUint32(batch, 0xFFFFFFFF) // partition leader epoch (-1)
+	batch = append(batch, 2)                                 // magic byte
+	batch = binary.BigEndian.AppendUint32(batch, crc32.Checksum(body, castagnoliTable))
+	return append(batch, body...), nil
+}
+
+// appendVarintBytes appends a length prefixed byte string as used in v2 records
+func appendVarintBytes(b []byte, data []byte) []byte {
+	b = binary.AppendVarint(b, int64(len(data)))
+	return append(b, data...)
+}
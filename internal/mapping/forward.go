@@ -0,0 +1,255 @@
+package mapping
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"gom2k/pkg/types"
+)
+
+// Sanitization policies for characters that are illegal in Kafka topic names
+const (
+	SanitizeReplace = "replace"
+	SanitizeEncode  = "encode"
+	SanitizeDrop    = "drop"
+)
+
+// Truncation strategies for mapped names longer than MaxKafkaTopicLength
+const (
+	TruncateSlice = "slice"
+	TruncateHash  = "hash"
+)
+
+// MaxKafkaTopicLength is the longest topic name Kafka accepts
+const MaxKafkaTopicLength = 249
+
+// hashSuffixLength is the number of hex characters of the name hash appended by TruncateHash
+const hashSuffixLength = 8
+
+// maxTrackedTopics bounds the memory used for collision detection
+const maxTrackedTopics = 10000
+
+// TopicMapping describes how an MQTT topic was mapped to a Kafka topic
+type TopicMapping struct {
+	KafkaTopic string // Resulting Kafka topic name
+	FullTopic  string // Mapped name before truncation
+	Sanitized  bool   // Illegal characters were replaced, encoded or dropped
+	Truncated  bool   // Name was shortened to fit Kafka's length limit
+}
+
+// TopicMapper maps MQTT topics to Kafka topic names using the configured prefix, level
+// limit and sanitization policy. It remembers mapped names so it can warn when two
+// different MQTT topic names end up on the same Kafka topic only because of sanitization,
+// or when two Kafka topics would clash in Kafka's metric names ('.' and '_' are equivalent).
+type TopicMapper struct {
+	config *types.MappingConfig
+
+	trackMutex  sync.Mutex
+	sources     map[string]topicSource // Kafka topic -> names that produced it
+	metricNames map[string]string      // Metric name ('.' replaced by '_') -> Kafka topic
+	warned      map[string]bool        // Collisions already reported
+}
+
+// topicSource records the names a Kafka topic was derived from
+type topicSource struct {
+	unsanitized string // Mapped name before sanitization and truncation
+	full        string // Mapped name before truncation
+}
+
+// NewTopicMapper creates a topic mapper for the given mapping configuration
+func NewTopicMapper(config *types.MappingConfig) *TopicMapper {
+	return &TopicMapper{
+		config:      config,
+		sources:     make(map[string]topicSource),
+		metricNames: make(map[string]string),
+		warned:      make(map[string]bool),
+	}
+}
+
+// Map returns the Kafka topic name for an MQTT topic
+func (m *TopicMapper) Map(mqttTopic string) string {
+	return m.MapTopic(mqttTopic).KafkaTopic
+}
+
+// MapTopic maps an MQTT topic to a Kafka topic and reports which transformations were applied.
+// The prefix is followed by at most MaxTopicLevels topic levels joined with '.', each level
+// sanitized according to the configured policy.
+func (m *TopicMapper) MapTopic(mqttTopic string) TopicMapping {
+	// Use strings.Builder for efficient string concatenation
+	var builder, unsanitized strings.Builder
+
+	// Pre-allocate capacity (estimate: prefix + topic + separators)
+	builder.Grow(len(m.config.KafkaPrefix) + len(mqttTopic) + 10)
+	unsanitized.Grow(len(m.config.KafkaPrefix) + len(mqttTopic) + 10)
+
+	// Add prefix
+	builder.WriteString(m.config.KafkaPrefix)
+	unsanitized.WriteString(m.config.KafkaPrefix)
+
+	// Process topic levels directly without creating intermediate slices
+	result := TopicMapping{}
+	maxLevels := m.config.MaxTopicLevels
+	levelCount := 0
+	startIdx := 0
+
+	for i := 0; i <= len(mqttTopic) && levelCount < maxLevels; i++ {
+		// The last segment (including empty segment from trailing slash) ends the topic
+		if i < len(mqttTopic) && mqttTopic[i] != '/' {
+			continue
+		}
+
+		level := mqttTopic[startIdx:i]
+		sanitized := m.sanitizeLevel(level)
+		if sanitized != level {
+			result.Sanitized = true
+		}
+
+		builder.WriteByte('.')
+		builder.WriteString(sanitized)
+		unsanitized.WriteByte('.')
+		unsanitized.WriteString(level)
+		levelCount++
+		startIdx = i + 1
+	}
+
+	kafkaTopic := builder.String()
+	result.FullTopic = kafkaTopic
+
+	// Ensure Kafka topic doesn't exceed maximum length (249 chars)
+	if len(kafkaTopic) > MaxKafkaTopicLength {
+		kafkaTopic = m.truncate(kafkaTopic)
+		result.Truncated = true
+	}
+
+	result.KafkaTopic = kafkaTopic
+	m.checkCollisions(kafkaTopic, topicSource{unsanitized: unsanitized.String(), full: result.FullTopic})
+
+	return result
+}
+
+// truncate shortens a name to MaxKafkaTopicLength. With the hash strategy the name is cut
+// shorter and a hash of the full name is appended, so distinct long names stay distinct.
+func (m *TopicMapper) truncate(name string) string {
+	if m.config.Truncation == TruncateHash {
+		sum := sha256.Sum256([]byte(name))
+		suffix := "-" + hex.EncodeToString(sum[:])[:hashSuffixLength]
+		return trimTrailingDot(name[:MaxKafkaTopicLength-len(suffix)]) + suffix
+	}
+
+	return trimTrailingDot(name[:MaxKafkaTopicLength])
+}
+
+// trimTrailingDot removes a trailing level separator left behind by truncation
+func trimTrailingDot(name string) string {
+	if len(name) > 0 && name[len(name)-1] == '.' {
+		return name[:len(name)-1]
+	}
+	return name
+}
+
+// sanitizeLevel applies the configured sanitization policy to a single MQTT topic level
+func (m *TopicMapper) sanitizeLevel(level string) string {
+	policy := m.config.Sanitize
+
+	// Fast path: nothing to do for levels that are already legal
+	if policy != SanitizeEncode && IsLegalTopicName(level) {
+		return level
+	}
+
+	var builder strings.Builder
+	builder.Grow(len(level))
+
+	for i := 0; i < len(level); i++ {
+		c := level[i]
+		switch policy {
+		case SanitizeEncode:
+			// '_' is the escape character and '.' separates levels, so both are encoded too.
+			// This keeps the encoding reversible and free of collisions.
+			if isLegalTopicByte(c) && c != '_' && c != '.' {
+				builder.WriteByte(c)
+			} else {
+				fmt.Fprintf(&builder, "_%02X", c)
+			}
+		case SanitizeDrop:
+			if isLegalTopicByte(c) {
+				builder.WriteByte(c)
+			}
+		default:
+			if isLegalTopicByte(c) {
+				builder.WriteByte(c)
+				continue
+			}
+			builder.WriteString(m.config.Replacement)
+			// Replace a multi-byte UTF-8 character only once
+			for i+1 < len(level) && level[i+1]&0xC0 == 0x80 {
+				i++
+			}
+		}
+	}
+
+	return builder.String()
+}
+
+// checkCollisions warns when sanitization or truncation merges distinct topic names, or when
+// the Kafka topic clashes with another one in Kafka's metric names
+func (m *TopicMapper) checkCollisions(kafkaTopic string, source topicSource) {
+	m.trackMutex.Lock()
+	defer m.trackMutex.Unlock()
+
+	if previous, exists := m.sources[kafkaTopic]; exists {
+		switch {
+		case previous.full != source.full:
+			m.warnOnce("truncate:"+previous.full+"|"+source.full,
+				"Warning: topic names %q and %q both map to Kafka topic %q after truncation",
+				previous.full, source.full, kafkaTopic)
+		case previous.unsanitized != source.unsanitized:
+			m.warnOnce("sanitize:"+previous.unsanitized+"|"+source.unsanitized,
+				"Warning: topic names %q and %q both map to Kafka topic %q after sanitization",
+				previous.unsanitized, source.unsanitized, kafkaTopic)
+		}
+		return
+	}
+
+	if len(m.sources) >= maxTrackedTopics {
+		return
+	}
+	m.sources[kafkaTopic] = source
+
+	metricName := strings.ReplaceAll(kafkaTopic, ".", "_")
+	if other, exists := m.metricNames[metricName]; exists && other != kafkaTopic {
+		m.warnOnce("metric:"+other+"|"+kafkaTopic,
+			"Warning: Kafka topics %q and %q collide in metric names because '.' and '_' are equivalent",
+			other, kafkaTopic)
+		return
+	}
+	m.metricNames[metricName] = kafkaTopic
+}
+
+// warnOnce logs a collision warning the first time it is seen. Caller must hold trackMutex.
+func (m *TopicMapper) warnOnce(key string, format string, args ...interface{}) {
+	if m.warned[key] {
+		return
+	}
+	m.warned[key] = true
+	log.Printf(format, args...)
+}
+
+// IsLegalTopicName reports whether a string only contains characters Kafka allows in topic names
+func IsLegalTopicName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if !isLegalTopicByte(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isLegalTopicByte reports whether a byte is in Kafka's legal topic character set [a-zA-Z0-9._-]
+func isLegalTopicByte(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+		c == '.' || c == '_' || c == '-'
+}
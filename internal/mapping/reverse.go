@@ -0,0 +1,216 @@
+// Package mapping provides topic mapping between MQTT and Kafka naming schemes.
+// It includes rule-based reverse mapping that derives MQTT topics from Kafka record
+// metadata, so records produced by Kafka-native applications can be routed to devices.
+package mapping
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gom2k/pkg/types"
+)
+
+// Reverse mapping rule sources
+const (
+	SourceTopic  = "topic"
+	SourceKey    = "key"
+	SourceHeader = "header"
+)
+
+// ReverseMapper derives MQTT topics for Kafka records from the configured reverse mapping rules.
+// Rules are evaluated in order and the first rule whose pattern matches wins.
+type ReverseMapper struct {
+	rules []compiledRule
+}
+
+// compiledRule holds a reverse mapping rule with its pre-compiled pattern
+type compiledRule struct {
+	rule    types.ReverseMappingRule
+	pattern *regexp.Regexp
+}
+
+// ReverseMatch describes the MQTT destination produced by a matching reverse mapping rule
+type ReverseMatch struct {
+	Topic     string // Expanded MQTT topic
+	QoS       byte   // QoS configured on the rule
+	Retained  bool   // Retain flag configured on the rule
+	RuleIndex int    // Index of the rule that matched
+}
+
+// NewReverseMapper compiles the given reverse mapping rules.
+// It returns an error if a rule has an unknown source, an invalid pattern, or a
+// topic template that references capture groups the pattern doesn't define.
+func NewReverseMapper(rules []types.ReverseMappingRule) (*ReverseMapper, error) {
+	mapper := &ReverseMapper{}
+
+	for i, rule := range rules {
+		switch rule.Source {
+		case SourceTopic, SourceKey:
+		case SourceHeader:
+			if rule.Header == "" {
+				return nil, fmt.Errorf("rule %d: header name is required for source %q", i, SourceHeader)
+			}
+		default:
+			return nil, fmt.Errorf("rule %d: unknown source %q (expected topic, key or header)", i, rule.Source)
+		}
+
+		if rule.Match == "" {
+			return nil, fmt.Errorf("rule %d: match pattern is required", i)
+		}
+		if rule.MQTTTopic == "" {
+			return nil, fmt.Errorf("rule %d: mqtt_topic template is required", i)
+		}
+		if rule.QoS > 2 {
+			return nil, fmt.Errorf("rule %d: qos must be 0, 1 or 2, got %d", i, rule.QoS)
+		}
+
+		// Anchor the pattern so it has to match the whole value
+		pattern, err := regexp.Compile("^(?:" + rule.Match + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid match pattern: %w", i, err)
+		}
+
+		if err := checkTemplate(rule.MQTTTopic, pattern); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+
+		mapper.rules = append(mapper.rules, compiledRule{rule: rule, pattern: pattern})
+	}
+
+	return mapper, nil
+}
+
+// HasRules reports whether any reverse mapping rules are configured
+func (m *ReverseMapper) HasRules() bool {
+	return m != nil && len(m.rules) > 0
+}
+
+// MatchesTopic reports whether a Kafka topic name is matched by any topic-based rule.
+// The consumer uses this to subscribe to topics outside the bridge prefix.
+func (m *ReverseMapper) MatchesTopic(kafkaTopic string) bool {
+	if m == nil {
+		return false
+	}
+
+	for _, compiled := range m.rules {
+		if compiled.rule.Source == SourceTopic && compiled.pattern.MatchString(kafkaTopic) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Map returns the MQTT destination for a Kafka record, or nil if no rule matches.
+// An error is returned when a rule matches but expands to an invalid MQTT topic.
+func (m *ReverseMapper) Map(kafkaMsg *types.KafkaMessage) (*ReverseMatch, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	for i, compiled := range m.rules {
+		value, ok := sourceValue(compiled.rule, kafkaMsg)
+		if !ok {
+			continue
+		}
+
+		groups := compiled.pattern.FindStringSubmatch(value)
+		if groups == nil {
+			continue
+		}
+
+		topic := expandTemplate(compiled.rule.MQTTTopic, compiled.pattern, groups)
+		if topic == "" || strings.ContainsAny(topic, "+#") {
+			return nil, fmt.Errorf("reverse mapping rule %d produced invalid MQTT topic %q", i, topic)
+		}
+
+		return &ReverseMatch{
+			Topic:     topic,
+			QoS:       compiled.rule.QoS,
+			Retained:  compiled.rule.Retained,
+			RuleIndex: i,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// sourceValue extracts the value a rule matches against from a Kafka record
+func sourceValue(rule types.ReverseMappingRule, kafkaMsg *types.KafkaMessage) (string, bool) {
+	switch rule.Source {
+	case SourceTopic:
+		return kafkaMsg.Topic, true
+	case SourceKey:
+		return kafkaMsg.Key, true
+	case SourceHeader:
+		return kafkaMsg.Header(rule.Header)
+	default:
+		return "", false
+	}
+}
+
+// checkTemplate verifies that every {placeholder} in a template refers to a capture group
+func checkTemplate(template string, pattern *regexp.Regexp) error {
+	for _, name := range placeholders(template) {
+		if _, ok := groupIndex(name, pattern); !ok {
+			return fmt.Errorf("mqtt_topic template references unknown capture group {%s}", name)
+		}
+	}
+	return nil
+}
+
+// expandTemplate replaces {N} and {name} placeholders with the matching capture groups
+func expandTemplate(template string, pattern *regexp.Regexp, groups []string) string {
+	var builder strings.Builder
+	builder.Grow(len(template))
+
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		builder.WriteString(template[:start])
+		if idx, ok := groupIndex(template[start+1:end], pattern); ok {
+			builder.WriteString(groups[idx])
+		}
+		template = template[end+1:]
+	}
+
+	builder.WriteString(template)
+	return builder.String()
+}
+
+// placeholders returns the names of all {placeholder} references in a template
+func placeholders(template string) []string {
+	var names []string
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			return names
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return names
+		}
+		names = append(names, template[start+1:start+end])
+		template = template[start+end+1:]
+	}
+}
+
+// groupIndex resolves a placeholder to a capture group index by number or name
+func groupIndex(name string, pattern *regexp.Regexp) (int, bool) {
+	if idx, err := strconv.Atoi(name); err == nil {
+		return idx, idx >= 0 && idx <= pattern.NumSubexp()
+	}
+
+	idx := pattern.SubexpIndex(name)
+	return idx, idx > 0
+}
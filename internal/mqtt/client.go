@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"gom2k/internal/msgid"
 	"gom2k/pkg/types"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -130,6 +131,10 @@ func (c *Client) Subscribe() error {
 
 // Publish publishes a message to MQTT
 func (c *Client) Publish(topic string, payload []byte, qos byte, retained bool) error {
+	if err := ValidateTopicName(topic); err != nil {
+		return err
+	}
+	
 	token := c.client.Publish(topic, qos, retained, payload)
 	token.Wait()
 	
@@ -165,6 +170,7 @@ func (c *Client) onMessage(client mqtt.Client, msg mqtt.Message) {
 	}
 	
 	mqttMsg := &types.MQTTMessage{
+		ID:        msgid.New(),
 		Topic:     msg.Topic(),
 		Payload:   msg.Payload(),
 		QoS:       msg.Qos(),
@@ -0,0 +1,65 @@
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ValidateTopicFilter checks that a topic filter is valid: '+' and '#' must occupy a whole
+// topic level and '#' must be the last level
+func ValidateTopicFilter(filter string) error {
+	if filter == "" {
+		return fmt.Errorf("topic filter is empty")
+	}
+
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		switch {
+		case level == "#" && i != len(levels)-1:
+			return fmt.Errorf("topic filter %q: '#' must be the last level", filter)
+		case level != "#" && level != "+" && strings.ContainsAny(level, "+#"):
+			return fmt.Errorf("topic filter %q: wildcards must occupy a whole level", filter)
+		}
+	}
+	return nil
+}
+
+// TopicMatches reports whether a topic matches a topic filter. As in MQTT subscriptions,
+// filters starting with a wildcard don't match topics starting with '$' such as $SYS.
+func TopicMatches(filter string, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			// '#' also matches the parent level, "a/#" matches "a"
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+// ErrInvalidTopic is returned for messages published to invalid topic names
+var ErrInvalidTopic = errors.New("invalid topic")
+
+// ValidateTopicName checks that a topic name can be published to: it must not be empty
+// or contain wildcards
+func ValidateTopicName(topic string) error {
+	if topic == "" {
+		return fmt.Errorf("%w: topic name is empty", ErrInvalidTopic)
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("%w: topic name %q contains wildcards", ErrInvalidTopic, topic)
+	}
+	return nil
+}
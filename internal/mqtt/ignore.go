@@ -0,0 +1,31 @@
+package mqtt
+
+import "fmt"
+
+// DefaultKafkaToMQTTIgnore keeps records from being published to broker and bridge topics
+var DefaultKafkaToMQTTIgnore = []string{"$SYS/#", "gom2k/#"}
+
+// IgnoreList holds the MQTT topic filters of messages a direction doesn't forward
+type IgnoreList struct {
+	filters []string
+}
+
+// NewIgnoreList validates the topic filters of an ignore list
+func NewIgnoreList(filters []string) (*IgnoreList, error) {
+	for i, filter := range filters {
+		if err := ValidateTopicFilter(filter); err != nil {
+			return nil, fmt.Errorf("ignore filter %d: %w", i, err)
+		}
+	}
+	return &IgnoreList{filters: filters}, nil
+}
+
+// Match returns the first filter matching the topic, if any
+func (l *IgnoreList) Match(topic string) (string, bool) {
+	for _, filter := range l.filters {
+		if TopicMatches(filter, topic) {
+			return filter, true
+		}
+	}
+	return "", false
+}
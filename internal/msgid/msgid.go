@@ -0,0 +1,113 @@
+// Package msgid generates the IDs the bridge assigns to messages when it receives them.
+// IDs are ULIDs: a 48-bit millisecond timestamp followed by 80 random bits, written as 26
+// characters of Crockford's base32. They sort by receive time, and IDs generated within
+// the same millisecond increment the random part, so they stay ordered and unique.
+package msgid
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Length is the number of characters of an ID
+const Length = 26
+
+// encoding is Crockford's base32 alphabet, which leaves out I, L, O and U
+const encoding = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// maxTime is the largest timestamp that fits into 48 bits
+const maxTime = 1<<48 - 1
+
+var (
+	mutex      sync.Mutex
+	lastTime   uint64
+	lastRandom [10]byte
+)
+
+// New returns a new ID for the current time
+func New() string {
+	return NewAt(time.Now())
+}
+
+// NewAt returns a new ID for the given time. IDs generated for the same millisecond are
+// ordered by the order of the calls.
+func NewAt(t time.Time) string {
+	ms := uint64(t.UnixMilli())
+	if ms > maxTime {
+		ms = maxTime
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if ms != lastTime || !increment(&lastRandom) {
+		if _, err := rand.Read(lastRandom[:]); err != nil {
+			// crypto/rand doesn't fail on supported platforms
+			panic(fmt.Sprintf("msgid: failed to read random bytes: %v", err))
+		}
+		lastTime = ms
+	}
+
+	var id [16]byte
+	for i := 0; i < 6; i++ {
+		id[i] = byte(ms >> (40 - 8*i))
+	}
+	copy(id[6:], lastRandom[:])
+	return encode(id)
+}
+
+// increment adds one to the random part. It reports false when the random part
+// overflows, after 2^80 IDs in one millisecond.
+func increment(random *[10]byte) bool {
+	for i := len(random) - 1; i >= 0; i-- {
+		random[i]++
+		if random[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encode writes the 128 bits of an ID as 26 base32 characters, the first one holding
+// only the top 3 bits
+func encode(id [16]byte) string {
+	var hi, lo uint64
+	for i := 0; i < 8; i++ {
+		hi = hi<<8 | uint64(id[i])
+		lo = lo<<8 | uint64(id[i+8])
+	}
+
+	var text [Length]byte
+	for i := Length - 1; i >= 0; i-- {
+		text[i] = encoding[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(text[:])
+}
+
+// Time returns the time encoded in an ID, with millisecond precision
+func Time(id string) (time.Time, error) {
+	if len(id) != Length {
+		return time.Time{}, fmt.Errorf("invalid message ID %q: expected %d characters", id, Length)
+	}
+
+	// The first 10 characters hold the 48 bits of the timestamp, plus 2 leading zero bits
+	var ms uint64
+	for i, char := range strings.ToUpper(id) {
+		value := strings.IndexRune(encoding, char)
+		if value < 0 {
+			return time.Time{}, fmt.Errorf("invalid message ID %q: unexpected character %q", id, char)
+		}
+		if i == 0 && value > 7 {
+			return time.Time{}, fmt.Errorf("invalid message ID %q: value out of range", id)
+		}
+		if i < 10 {
+			ms = ms<<5 | uint64(value)
+		}
+	}
+	return time.UnixMilli(int64(ms)), nil
+}
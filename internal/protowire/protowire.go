@@ -0,0 +1,98 @@
+// Package protowire reads and writes the Protobuf wire format for the few fixed message
+// types the bridge handles (its own schema registry records and Sparkplug B payloads),
+// without generated code.
+package protowire
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Wire types
+const (
+	WireVarint  = 0
+	WireFixed64 = 1
+	WireBytes   = 2
+	WireFixed32 = 5
+)
+
+// Field is a single decoded field. Varint holds the value of varint and fixed-width
+// fields, Bytes the value of length-delimited fields.
+type Field struct {
+	Number   uint64
+	WireType uint64
+	Varint   uint64
+	Bytes    []byte
+}
+
+// Decode walks the fields of a message in order, passing each to handle
+func Decode(data []byte, handle func(field Field) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("invalid field key")
+		}
+		data = data[n:]
+		field := Field{Number: key >> 3, WireType: key & 7}
+
+		switch field.WireType {
+		case WireVarint:
+			field.Varint, n = binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("invalid varint in field %d", field.Number)
+			}
+			data = data[n:]
+		case WireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return fmt.Errorf("invalid length in field %d", field.Number)
+			}
+			field.Bytes = data[n : n+int(length)]
+			data = data[n+int(length):]
+		case WireFixed64:
+			if len(data) < 8 {
+				return fmt.Errorf("truncated field %d", field.Number)
+			}
+			field.Varint = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case WireFixed32:
+			if len(data) < 4 {
+				return fmt.Errorf("truncated field %d", field.Number)
+			}
+			field.Varint = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d in field %d", field.WireType, field.Number)
+		}
+
+		if err := handle(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AppendVarint appends a varint field
+func AppendVarint(data []byte, number uint64, value uint64) []byte {
+	data = binary.AppendUvarint(data, number<<3|WireVarint)
+	return binary.AppendUvarint(data, value)
+}
+
+// AppendBytes appends a length-delimited field (bytes, string or embedded message)
+func AppendBytes(data []byte, number uint64, value []byte) []byte {
+	data = binary.AppendUvarint(data, number<<3|WireBytes)
+	data = binary.AppendUvarint(data, uint64(len(value)))
+	return append(data, value...)
+}
+
+// AppendFixed64 appends a fixed 64-bit field (double, fixed64)
+func AppendFixed64(data []byte, number uint64, value uint64) []byte {
+	data = binary.AppendUvarint(data, number<<3|WireFixed64)
+	return binary.LittleEndian.AppendUint64(data, value)
+}
+
+// AppendFixed32 appends a fixed 32-bit field (float, fixed32)
+func AppendFixed32(data []byte, number uint64, value uint32) []byte {
+	data = binary.AppendUvarint(data, number<<3|WireFixed32)
+	return binary.LittleEndian.AppendUint32(data, value)
+}
@@ -0,0 +1,134 @@
+package schema
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"gom2k/pkg/types"
+)
+
+// Avro schemas of the gom2k records
+const (
+	AvroEnvelopeSchema = `{"type":"record","name":"MQTTMessage","namespace":"io.gom2k","fields":[` +
+		`{"name":"mqtt_topic","type":"string"},` +
+		`{"name":"payload","type":"bytes"},` +
+		`{"name":"qos","type":"int"},` +
+		`{"name":"retained","type":"boolean"},` +
+		`{"name":"timestamp","type":{"type":"long","logicalType":"timestamp-millis"}}]}`
+
+	AvroPayloadSchema = `{"type":"record","name":"MQTTPayload","namespace":"io.gom2k","fields":[` +
+		`{"name":"payload","type":"bytes"}]}`
+)
+
+// EncodeAvroEnvelope encodes an MQTT message with its metadata using AvroEnvelopeSchema
+func EncodeAvroEnvelope(mqttMsg *types.MQTTMessage) []byte {
+	data := make([]byte, 0, len(mqttMsg.Topic)+len(mqttMsg.Payload)+16)
+	data = appendAvroBytes(data, []byte(mqttMsg.Topic))
+	data = appendAvroBytes(data, mqttMsg.Payload)
+	data = binary.AppendVarint(data, int64(mqttMsg.QoS))
+	data = appendAvroBoolean(data, mqttMsg.Retained)
+	return binary.AppendVarint(data, mqttMsg.Timestamp.UnixMilli())
+}
+
+// DecodeAvroEnvelope decodes a record written with AvroEnvelopeSchema
+func DecodeAvroEnvelope(data []byte) (*types.MQTTMessage, error) {
+	decoder := avroDecoder{data: data}
+	topic := decoder.bytes()
+	payload := decoder.bytes()
+	qos := decoder.long()
+	retained := decoder.boolean()
+	timestamp := decoder.long()
+	if decoder.err != nil {
+		return nil, fmt.Errorf("invalid Avro MQTT message: %w", decoder.err)
+	}
+	if qos < 0 || qos > 2 {
+		return nil, fmt.Errorf("invalid Avro MQTT message: qos %d out of range", qos)
+	}
+
+	return &types.MQTTMessage{
+		Topic:     string(topic),
+		Payload:   payload,
+		QoS:       byte(qos),
+		Retained:  retained,
+		Timestamp: time.UnixMilli(timestamp),
+	}, nil
+}
+
+// EncodeAvroPayload encodes a bare payload using AvroPayloadSchema
+func EncodeAvroPayload(payload []byte) []byte {
+	return appendAvroBytes(nil, payload)
+}
+
+// DecodeAvroPayload decodes a record written with AvroPayloadSchema
+func DecodeAvroPayload(data []byte) ([]byte, error) {
+	decoder := avroDecoder{data: data}
+	payload := decoder.bytes()
+	if decoder.err != nil {
+		return nil, fmt.Errorf("invalid Avro MQTT payload: %w", decoder.err)
+	}
+	return payload, nil
+}
+
+// appendAvroBytes appends Avro bytes or string data: a zigzag varint length and the data
+func appendAvroBytes(data []byte, value []byte) []byte {
+	data = binary.AppendVarint(data, int64(len(value)))
+	return append(data, value...)
+}
+
+// appendAvroBoolean appends an Avro boolean as a single byte
+func appendAvroBoolean(data []byte, value bool) []byte {
+	if value {
+		return append(data, 1)
+	}
+	return append(data, 0)
+}
+
+// avroDecoder reads Avro primitives, remembering the first error
+type avroDecoder struct {
+	data []byte
+	err  error
+}
+
+// long reads a zigzag varint encoded int or long
+func (d *avroDecoder) long() int64 {
+	if d.err != nil {
+		return 0
+	}
+	value, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = fmt.Errorf("truncated or overlong varint")
+		return 0
+	}
+	d.data = d.data[n:]
+	return value
+}
+
+// bytes reads length-prefixed bytes or string data
+func (d *avroDecoder) bytes() []byte {
+	length := d.long()
+	if d.err != nil {
+		return nil
+	}
+	if length < 0 || length > int64(len(d.data)) {
+		d.err = fmt.Errorf("invalid length %d", length)
+		return nil
+	}
+	value := d.data[:length]
+	d.data = d.data[length:]
+	return value
+}
+
+// boolean reads a single byte boolean
+func (d *avroDecoder) boolean() bool {
+	if d.err != nil {
+		return false
+	}
+	if len(d.data) == 0 {
+		d.err = fmt.Errorf("truncated boolean")
+		return false
+	}
+	value := d.data[0]
+	d.data = d.data[1:]
+	return value != 0
+}
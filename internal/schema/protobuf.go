@@ -0,0 +1,106 @@
+package schema
+
+import (
+	"fmt"
+	"time"
+
+	"gom2k/internal/protowire"
+	"gom2k/pkg/types"
+)
+
+// Protobuf schemas of the gom2k records. Each schema holds a single message type,
+// so records always use message index 0.
+const (
+	ProtobufEnvelopeSchema = `syntax = "proto3";
+package io.gom2k;
+
+message MQTTMessage {
+  string mqtt_topic = 1;
+  bytes payload = 2;
+  uint32 qos = 3;
+  bool retained = 4;
+  int64 timestamp_millis = 5;
+}
+`
+
+	ProtobufPayloadSchema = `syntax = "proto3";
+package io.gom2k;
+
+message MQTTPayload {
+  bytes payload = 1;
+}
+`
+)
+
+// EncodeProtobufEnvelope encodes an MQTT message with its metadata using ProtobufEnvelopeSchema.
+// Fields with default values are omitted as in proto3.
+func EncodeProtobufEnvelope(mqttMsg *types.MQTTMessage) []byte {
+	data := make([]byte, 0, len(mqttMsg.Topic)+len(mqttMsg.Payload)+24)
+	if mqttMsg.Topic != "" {
+		data = protowire.AppendBytes(data, 1, []byte(mqttMsg.Topic))
+	}
+	if len(mqttMsg.Payload) > 0 {
+		data = protowire.AppendBytes(data, 2, mqttMsg.Payload)
+	}
+	if mqttMsg.QoS != 0 {
+		data = protowire.AppendVarint(data, 3, uint64(mqttMsg.QoS))
+	}
+	if mqttMsg.Retained {
+		data = protowire.AppendVarint(data, 4, 1)
+	}
+	if millis := mqttMsg.Timestamp.UnixMilli(); millis != 0 {
+		data = protowire.AppendVarint(data, 5, uint64(millis))
+	}
+	return data
+}
+
+// DecodeProtobufEnvelope decodes a message written with ProtobufEnvelopeSchema
+func DecodeProtobufEnvelope(data []byte) (*types.MQTTMessage, error) {
+	mqttMsg := &types.MQTTMessage{Timestamp: time.UnixMilli(0)}
+
+	err := protowire.Decode(data, func(field protowire.Field) error {
+		switch field.Number {
+		case 1:
+			mqttMsg.Topic = string(field.Bytes)
+		case 2:
+			mqttMsg.Payload = field.Bytes
+		case 3:
+			if field.Varint > 2 {
+				return fmt.Errorf("qos %d out of range", field.Varint)
+			}
+			mqttMsg.QoS = byte(field.Varint)
+		case 4:
+			mqttMsg.Retained = field.Varint != 0
+		case 5:
+			mqttMsg.Timestamp = time.UnixMilli(int64(field.Varint))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid Protobuf MQTT message: %w", err)
+	}
+	return mqttMsg, nil
+}
+
+// EncodeProtobufPayload encodes a bare payload using ProtobufPayloadSchema
+func EncodeProtobufPayload(payload []byte) []byte {
+	if len(payload) == 0 {
+		return []byte{}
+	}
+	return protowire.AppendBytes(nil, 1, payload)
+}
+
+// DecodeProtobufPayload decodes a message written with ProtobufPayloadSchema
+func DecodeProtobufPayload(data []byte) ([]byte, error) {
+	payload := []byte{}
+	err := protowire.Decode(data, func(field protowire.Field) error {
+		if field.Number == 1 {
+			payload = field.Bytes
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid Protobuf MQTT payload: %w", err)
+	}
+	return payload, nil
+}
@@ -0,0 +1,161 @@
+// Package schema implements Confluent schema registry support for the bridge: a caching
+// registry client, subject naming strategies, the Confluent wire format and the Avro and
+// Protobuf encodings of the gom2k message schemas.
+package schema
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schema types as named by the schema registry
+const (
+	TypeAvro     = "AVRO"
+	TypeProtobuf = "PROTOBUF"
+)
+
+// registryContentType is the media type of schema registry requests
+const registryContentType = "application/vnd.schemaregistry.v1+json"
+
+// RegisteredSchema is a schema as stored in the registry
+type RegisteredSchema struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"` // Empty means AVRO
+}
+
+// RegistryClient talks to a Confluent compatible schema registry. Schema IDs are cached
+// per subject and schema, and schemas are cached per ID, so each is fetched only once.
+type RegistryClient struct {
+	baseURL    string
+	username   string
+	password   string
+	httpClient *http.Client
+
+	cacheMutex sync.RWMutex
+	ids        map[string]int           // subject + schema -> schema ID
+	schemas    map[int]RegisteredSchema // schema ID -> schema
+}
+
+// NewRegistryClient creates a registry client for the given base URL
+func NewRegistryClient(baseURL, username, password string, timeout time.Duration) *RegistryClient {
+	return &RegistryClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		username:   username,
+		password:   password,
+		httpClient: &http.Client{Timeout: timeout},
+		ids:        make(map[string]int),
+		schemas:    make(map[int]RegisteredSchema),
+	}
+}
+
+// Register registers a schema under a subject and returns its ID. Registering a schema
+// that already exists returns the existing ID.
+func (c *RegistryClient) Register(ctx context.Context, subject string, schema RegisteredSchema) (int, error) {
+	return c.resolve(ctx, "/subjects/"+url.PathEscape(subject)+"/versions", subject, schema)
+}
+
+// Lookup returns the ID of a schema that is already registered under a subject
+func (c *RegistryClient) Lookup(ctx context.Context, subject string, schema RegisteredSchema) (int, error) {
+	return c.resolve(ctx, "/subjects/"+url.PathEscape(subject), subject, schema)
+}
+
+// resolve posts a schema to a registry endpoint that answers with its ID, using the cache first
+func (c *RegistryClient) resolve(ctx context.Context, path string, subject string, schema RegisteredSchema) (int, error) {
+	cacheKey := subject + "\x00" + schema.SchemaType + "\x00" + schema.Schema
+
+	c.cacheMutex.RLock()
+	id, cached := c.ids[cacheKey]
+	c.cacheMutex.RUnlock()
+	if cached {
+		return id, nil
+	}
+
+	body, err := json.Marshal(schema)
+	if err != nil {
+		return 0, err
+	}
+
+	var response struct {
+		ID int `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, path, body, &response); err != nil {
+		return 0, fmt.Errorf("subject %s: %w", subject, err)
+	}
+
+	c.cacheMutex.Lock()
+	c.ids[cacheKey] = response.ID
+	c.schemas[response.ID] = schema
+	c.cacheMutex.Unlock()
+
+	return response.ID, nil
+}
+
+// SchemaByID returns the schema registered with the given ID
+func (c *RegistryClient) SchemaByID(ctx context.Context, id int) (RegisteredSchema, error) {
+	c.cacheMutex.RLock()
+	schema, cached := c.schemas[id]
+	c.cacheMutex.RUnlock()
+	if cached {
+		return schema, nil
+	}
+
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &schema); err != nil {
+		return RegisteredSchema{}, fmt.Errorf("schema ID %d: %w", id, err)
+	}
+
+	c.cacheMutex.Lock()
+	c.schemas[id] = schema
+	c.cacheMutex.Unlock()
+
+	return schema, nil
+}
+
+// do performs a registry request and decodes the JSON response into result
+func (c *RegistryClient) do(ctx context.Context, method string, path string, body []byte, result interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", registryContentType)
+	if body != nil {
+		request.Header.Set("Content-Type", registryContentType)
+	}
+	if c.username != "" {
+		request.SetBasicAuth(c.username, c.password)
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("schema registry request failed: %w", err)
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read schema registry response: %w", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var registryError struct {
+			ErrorCode int    `json:"error_code"`
+			Message   string `json:"message"`
+		}
+		if json.Unmarshal(data, &registryError) == nil && registryError.Message != "" {
+			return fmt.Errorf("schema registry error %d: %s", registryError.ErrorCode, registryError.Message)
+		}
+		return fmt.Errorf("schema registry returned HTTP %d", response.StatusCode)
+	}
+
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("invalid schema registry response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"gom2k/pkg/types"
+)
+
+// Serialization targets
+const (
+	TargetEnvelope = "envelope" // Payload and MQTT metadata in one record
+	TargetPayload  = "payload"  // Payload only, MQTT metadata is carried elsewhere
+)
+
+// Record names used by the record based subject naming strategies
+const (
+	envelopeRecordName = "io.gom2k.MQTTMessage"
+	payloadRecordName  = "io.gom2k.MQTTPayload"
+)
+
+// Serializer encodes MQTT messages as Avro or Protobuf records in the Confluent wire
+// format, registering (or looking up) the gom2k schemas as needed
+type Serializer struct {
+	registry   *RegistryClient
+	schemaType string // TypeAvro or TypeProtobuf
+	target     string // TargetEnvelope or TargetPayload
+	strategy   string // Subject naming strategy
+	lookupOnly bool   // Never register schemas, only look them up
+}
+
+// NewSerializer creates a serializer writing the given schema type
+func NewSerializer(registry *RegistryClient, schemaType string, config *types.SchemaConfig) (*Serializer, error) {
+	if schemaType != TypeAvro && schemaType != TypeProtobuf {
+		return nil, fmt.Errorf("unsupported schema type: %s", schemaType)
+	}
+	switch config.Target {
+	case "", TargetEnvelope, TargetPayload:
+	default:
+		return nil, fmt.Errorf("unknown schema target: %s", config.Target)
+	}
+	if _, err := SubjectName(config.SubjectStrategy, "", ""); err != nil {
+		return nil, err
+	}
+
+	target := config.Target
+	if target == "" {
+		target = TargetEnvelope
+	}
+
+	return &Serializer{
+		registry:   registry,
+		schemaType: schemaType,
+		target:     target,
+		strategy:   config.SubjectStrategy,
+		lookupOnly: config.LookupOnly,
+	}, nil
+}
+
+// PayloadOnly reports whether records only contain the payload
+func (s *Serializer) PayloadOnly() bool {
+	return s.target == TargetPayload
+}
+
+// Serialize encodes an MQTT message for a Kafka topic
+func (s *Serializer) Serialize(ctx context.Context, kafkaTopic string, mqttMsg *types.MQTTMessage) ([]byte, error) {
+	schema, recordName := s.schema()
+
+	subject, err := SubjectName(s.strategy, kafkaTopic, recordName)
+	if err != nil {
+		return nil, err
+	}
+
+	var schemaID int
+	if s.lookupOnly {
+		schemaID, err = s.registry.Lookup(ctx, subject, schema)
+	} else {
+		schemaID, err = s.registry.Register(ctx, subject, schema)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.schemaType == TypeProtobuf {
+		var data []byte
+		if s.PayloadOnly() {
+			data = EncodeProtobufPayload(mqttMsg.Payload)
+		} else {
+			data = EncodeProtobufEnvelope(mqttMsg)
+		}
+		return EncodeWireFormat(schemaID, []int{0}, data), nil
+	}
+
+	var data []byte
+	if s.PayloadOnly() {
+		data = EncodeAvroPayload(mqttMsg.Payload)
+	} else {
+		data = EncodeAvroEnvelope(mqttMsg)
+	}
+	return EncodeWireFormat(schemaID, nil, data), nil
+}
+
+// schema returns the registry schema and record name written by this serializer
+func (s *Serializer) schema() (RegisteredSchema, string) {
+	switch {
+	case s.schemaType == TypeProtobuf && s.PayloadOnly():
+		return RegisteredSchema{Schema: ProtobufPayloadSchema, SchemaType: TypeProtobuf}, payloadRecordName
+	case s.schemaType == TypeProtobuf:
+		return RegisteredSchema{Schema: ProtobufEnvelopeSchema, SchemaType: TypeProtobuf}, envelopeRecordName
+	case s.PayloadOnly():
+		return RegisteredSchema{Schema: AvroPayloadSchema}, payloadRecordName
+	default:
+		return RegisteredSchema{Schema: AvroEnvelopeSchema}, envelopeRecordName
+	}
+}
+
+// Deserialize decodes a wire format record written with one of the gom2k schemas, in
+// either format and target. For payload only records, payloadOnly is true and only the
+// payload of the returned message is set.
+func Deserialize(ctx context.Context, registry *RegistryClient, value []byte) (mqttMsg *types.MQTTMessage, payloadOnly bool, err error) {
+	schemaID, data, err := DecodeWireFormat(value)
+	if err != nil {
+		return nil, false, err
+	}
+
+	schema, err := registry.SchemaByID(ctx, schemaID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if schema.SchemaType == TypeProtobuf {
+		indexes, data, err := DecodeMessageIndexes(data)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(indexes) != 1 || indexes[0] != 0 {
+			return nil, false, fmt.Errorf("unexpected protobuf message indexes %v for schema ID %d", indexes, schemaID)
+		}
+
+		switch recordName(schema) {
+		case envelopeRecordName:
+			mqttMsg, err := DecodeProtobufEnvelope(data)
+			return mqttMsg, false, err
+		case payloadRecordName:
+			payload, err := DecodeProtobufPayload(data)
+			return &types.MQTTMessage{Payload: payload}, true, err
+		}
+	} else if schema.SchemaType == "" || schema.SchemaType == TypeAvro {
+		switch recordName(schema) {
+		case envelopeRecordName:
+			mqttMsg, err := DecodeAvroEnvelope(data)
+			return mqttMsg, false, err
+		case payloadRecordName:
+			payload, err := DecodeAvroPayload(data)
+			return &types.MQTTMessage{Payload: payload}, true, err
+		}
+	}
+
+	return nil, false, fmt.Errorf("schema ID %d is not a gom2k MQTT message schema", schemaID)
+}
+
+// recordName identifies the gom2k record a registered schema describes. Registries may
+// reformat schemas, so the full name is extracted rather than comparing schema text.
+func recordName(schema RegisteredSchema) string {
+	if schema.SchemaType == TypeProtobuf {
+		if !protobufPackagePattern.MatchString(schema.Schema) {
+			return ""
+		}
+		if match := protobufMessagePattern.FindStringSubmatch(schema.Schema); match != nil {
+			return "io.gom2k." + match[1]
+		}
+		return ""
+	}
+
+	var avroSchema struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	}
+	if err := json.Unmarshal([]byte(schema.Schema), &avroSchema); err != nil {
+		return ""
+	}
+	if avroSchema.Namespace == "" {
+		return avroSchema.Name
+	}
+	return avroSchema.Namespace + "." + avroSchema.Name
+}
+
+// Patterns identifying the gom2k Protobuf schemas
+var (
+	protobufPackagePattern = regexp.MustCompile(`(?m)^\s*package\s+io\.gom2k\s*;`)
+	protobufMessagePattern = regexp.MustCompile(`(?m)^\s*message\s+(MQTTMessage|MQTTPayload)\s*\{`)
+)
@@ -0,0 +1,24 @@
+package schema
+
+import "fmt"
+
+// Subject naming strategies
+const (
+	SubjectTopic       = "topic"        // <topic>-value (TopicNameStrategy)
+	SubjectRecord      = "record"       // <record name> (RecordNameStrategy)
+	SubjectTopicRecord = "topic_record" // <topic>-<record name> (TopicRecordNameStrategy)
+)
+
+// SubjectName returns the registry subject for a record value written to a Kafka topic
+func SubjectName(strategy string, kafkaTopic string, recordName string) (string, error) {
+	switch strategy {
+	case "", SubjectTopic:
+		return kafkaTopic + "-value", nil
+	case SubjectRecord:
+		return recordName, nil
+	case SubjectTopicRecord:
+		return kafkaTopic + "-" + recordName, nil
+	default:
+		return "", fmt.Errorf("unknown subject naming strategy: %s", strategy)
+	}
+}
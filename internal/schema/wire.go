@@ -0,0 +1,74 @@
+package schema
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// magicByte starts every record in the Confluent wire format
+const magicByte = 0
+
+// wireHeaderLength is the magic byte followed by the 4 byte big-endian schema ID
+const wireHeaderLength = 5
+
+// EncodeWireFormat frames serialized data with the magic byte and schema ID. Protobuf
+// records also carry the indexes of the message type within the schema; nil for Avro.
+func EncodeWireFormat(schemaID int, messageIndexes []int, data []byte) []byte {
+	framed := make([]byte, wireHeaderLength, wireHeaderLength+len(data)+4)
+	framed[0] = magicByte
+	binary.BigEndian.PutUint32(framed[1:], uint32(schemaID))
+
+	if messageIndexes != nil {
+		// The common case of the first message type is written as a single zero
+		if len(messageIndexes) == 1 && messageIndexes[0] == 0 {
+			framed = append(framed, 0)
+		} else {
+			framed = binary.AppendVarint(framed, int64(len(messageIndexes)))
+			for _, index := range messageIndexes {
+				framed = binary.AppendVarint(framed, int64(index))
+			}
+		}
+	}
+
+	return append(framed, data...)
+}
+
+// IsWireFormat reports whether a record value looks like Confluent wire format data
+func IsWireFormat(data []byte) bool {
+	return len(data) >= wireHeaderLength && data[0] == magicByte
+}
+
+// DecodeWireFormat returns the schema ID and the data following the wire format header
+func DecodeWireFormat(data []byte) (int, []byte, error) {
+	if !IsWireFormat(data) {
+		return 0, nil, fmt.Errorf("not in schema registry wire format")
+	}
+	return int(binary.BigEndian.Uint32(data[1:wireHeaderLength])), data[wireHeaderLength:], nil
+}
+
+// DecodeMessageIndexes reads the Protobuf message indexes that precede the message data
+func DecodeMessageIndexes(data []byte) ([]int, []byte, error) {
+	count, n := binary.Varint(data)
+	if n <= 0 || count < 0 {
+		return nil, nil, fmt.Errorf("invalid protobuf message indexes")
+	}
+	data = data[n:]
+	if count == 0 {
+		return []int{0}, data, nil
+	}
+	// Every index takes at least one byte, larger counts can't be valid
+	if count > int64(len(data)) {
+		return nil, nil, fmt.Errorf("invalid protobuf message indexes: %d indexes in %d bytes", count, len(data))
+	}
+
+	indexes := make([]int, 0, count)
+	for i := int64(0); i < count; i++ {
+		index, n := binary.Varint(data)
+		if n <= 0 {
+			return nil, nil, fmt.Errorf("invalid protobuf message indexes")
+		}
+		indexes = append(indexes, int(index))
+		data = data[n:]
+	}
+	return indexes, data, nil
+}
@@ -0,0 +1,318 @@
+package sparkplug
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gom2k/pkg/types"
+)
+
+// Output modes
+const (
+	OutputMetric  = "metric"  // One record per metric
+	OutputPayload = "payload" // One record per Sparkplug payload
+)
+
+// seqModulus is the range of Sparkplug sequence numbers (0-255)
+const seqModulus = 256
+
+// Record is a decoded Kafka record, keyed by group/edge node[/device]
+type Record struct {
+	Key   string
+	Value []byte
+}
+
+// Result holds the records decoded from a Sparkplug message. RebirthTopic is set when
+// the edge node should be asked to republish its birth certificates.
+type Result struct {
+	Records        []Record
+	RebirthTopic   string
+	RebirthPayload []byte
+}
+
+// Decoder decodes Sparkplug B messages, keeping the per edge node state needed for
+// alias resolution and sequence tracking
+type Decoder struct {
+	config *types.SparkplugConfig
+
+	mutex sync.Mutex
+	nodes map[string]*nodeState // group_id/edge_node_id -> state
+}
+
+// nodeState is what the decoder knows about an edge node from its birth certificates
+type nodeState struct {
+	born        bool
+	lastSeq     uint64
+	aliases     map[uint64]metricInfo // Aliases are unique across an edge node and its devices
+	dataTypes   map[string]uint32     // device_id + "/" + metric name -> data type
+	lastRebirth time.Time
+}
+
+// metricInfo is the name and data type of a metric announced in a birth certificate
+type metricInfo struct {
+	name     string
+	dataType uint32
+}
+
+// NewDecoder creates a Sparkplug B decoder
+func NewDecoder(config *types.SparkplugConfig) *Decoder {
+	return &Decoder{
+		config: config,
+		nodes:  make(map[string]*nodeState),
+	}
+}
+
+// Decode decodes a Sparkplug B message into Kafka records. Birth certificates update the
+// alias table of the edge node; sequence gaps, data from unknown nodes and unknown aliases
+// trigger a rebirth request when enabled.
+func (d *Decoder) Decode(mqttTopic string, data []byte, receivedAt time.Time) (*Result, error) {
+	topic, err := ParseTopic(mqttTopic)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := DecodePayload(data)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	result := &Result{}
+	node := d.nodes[topic.NodeKey()]
+	needsRebirth := false
+
+	switch topic.MessageType {
+	case MessageNBIRTH:
+		node = &nodeState{
+			born:      true,
+			aliases:   make(map[uint64]metricInfo),
+			dataTypes: make(map[string]uint32),
+		}
+		if previous := d.nodes[topic.NodeKey()]; previous != nil {
+			node.lastRebirth = previous.lastRebirth
+		}
+		d.nodes[topic.NodeKey()] = node
+		node.lastSeq = payload.Seq
+		node.register(topic.DeviceID, payload.Metrics)
+
+	case MessageNDEATH:
+		delete(d.nodes, topic.NodeKey())
+		node = nil
+
+	case MessageNCMD, MessageDCMD:
+		// Commands are sent to the node and don't take part in its sequence
+
+	default:
+		if node == nil || !node.born {
+			log.Printf("Warning: Sparkplug %s from %s before NBIRTH", topic.MessageType, topic.Key())
+			if node == nil {
+				node = &nodeState{}
+				d.nodes[topic.NodeKey()] = node
+			}
+			needsRebirth = true
+		} else {
+			needsRebirth = node.checkSeq(topic, payload)
+		}
+		if topic.MessageType == MessageDBIRTH && node.born {
+			node.register(topic.DeviceID, payload.Metrics)
+		}
+	}
+
+	metrics, unknownAliases := d.resolveMetrics(node, topic, payload.Metrics)
+	if unknownAliases {
+		needsRebirth = true
+	}
+
+	if needsRebirth && node != nil {
+		d.requestRebirth(node, topic, result)
+	}
+
+	records, err := d.buildRecords(topic, payload, metrics, receivedAt)
+	if err != nil {
+		return nil, err
+	}
+	result.Records = records
+
+	return result, nil
+}
+
+// register records the aliases and data types announced in a birth certificate
+func (n *nodeState) register(deviceID string, metrics []Metric) {
+	for _, metric := range metrics {
+		if metric.Name == "" {
+			continue
+		}
+		if metric.HasAlias {
+			n.aliases[metric.Alias] = metricInfo{name: metric.Name, dataType: metric.DataType}
+		}
+		n.dataTypes[deviceID+"/"+metric.Name] = metric.DataType
+	}
+}
+
+// checkSeq verifies the sequence number of a node or device message and reports a gap
+func (n *nodeState) checkSeq(topic Topic, payload *Payload) bool {
+	if !payload.HasSeq {
+		return false
+	}
+
+	expected := (n.lastSeq + 1) % seqModulus
+	n.lastSeq = payload.Seq
+	if payload.Seq == expected {
+		return false
+	}
+
+	log.Printf("Warning: Sparkplug sequence gap from %s: expected seq %d, got %d (%s)",
+		topic.NodeKey(), expected, payload.Seq, topic.MessageType)
+	return true
+}
+
+// resolveMetrics fills in names and data types of metrics that only carry an alias
+func (d *Decoder) resolveMetrics(node *nodeState, topic Topic, metrics []Metric) ([]Metric, bool) {
+	unknownAliases := false
+	resolved := make([]Metric, len(metrics))
+
+	for i, metric := range metrics {
+		if node != nil && node.aliases != nil {
+			if metric.Name == "" && metric.HasAlias {
+				if info, ok := node.aliases[metric.Alias]; ok {
+					metric.Name = info.name
+					if metric.DataType == 0 {
+						metric.DataType = info.dataType
+					}
+				}
+			}
+			if metric.DataType == 0 && metric.Name != "" {
+				metric.DataType = node.dataTypes[topic.DeviceID+"/"+metric.Name]
+			}
+		}
+		if metric.Name == "" && metric.HasAlias {
+			log.Printf("Warning: unknown Sparkplug metric alias %d from %s", metric.Alias, topic.Key())
+			unknownAliases = true
+		}
+		resolved[i] = metric
+	}
+
+	return resolved, unknownAliases
+}
+
+// requestRebirth asks the edge node to republish its birth certificates, at most once per
+// rebirth interval
+func (d *Decoder) requestRebirth(node *nodeState, topic Topic, result *Result) {
+	if !d.config.Rebirth {
+		return
+	}
+
+	now := time.Now()
+	if !node.lastRebirth.IsZero() && now.Sub(node.lastRebirth) < d.config.RebirthInterval {
+		return
+	}
+	node.lastRebirth = now
+
+	log.Printf("Requesting Sparkplug rebirth from %s", topic.NodeKey())
+	result.RebirthTopic = topic.CommandTopic()
+	result.RebirthPayload = EncodeRebirthRequest(uint64(now.UnixMilli()))
+}
+
+// recordValue is the JSON value of a decoded Sparkplug record
+type recordValue struct {
+	GroupID     string        `json:"group_id"`
+	EdgeNodeID  string        `json:"edge_node_id"`
+	DeviceID    string        `json:"device_id,omitempty"`
+	MessageType string        `json:"message_type"`
+	Seq         *uint64       `json:"seq,omitempty"`
+	Timestamp   *time.Time    `json:"timestamp,omitempty"`
+	ReceivedAt  time.Time     `json:"received_at"`
+	UUID        string        `json:"uuid,omitempty"`
+	Metric      *metricValue  `json:"metric,omitempty"`
+	Metrics     []metricValue `json:"metrics,omitempty"`
+}
+
+// metricValue is the JSON form of a metric
+type metricValue struct {
+	Name         string      `json:"name"`
+	Alias        *uint64     `json:"alias,omitempty"`
+	Timestamp    *time.Time  `json:"timestamp,omitempty"`
+	DataType     string      `json:"datatype,omitempty"`
+	Value        interface{} `json:"value"`
+	IsNull       bool        `json:"is_null,omitempty"`
+	IsHistorical bool        `json:"is_historical,omitempty"`
+	IsTransient  bool        `json:"is_transient,omitempty"`
+}
+
+// buildRecords encodes the decoded message as one record per metric or per payload.
+// Messages without metrics (such as deaths) always produce a single record.
+func (d *Decoder) buildRecords(topic Topic, payload *Payload, metrics []Metric, receivedAt time.Time) ([]Record, error) {
+	base := recordValue{
+		GroupID:     topic.GroupID,
+		EdgeNodeID:  topic.EdgeNodeID,
+		DeviceID:    topic.DeviceID,
+		MessageType: topic.MessageType,
+		Timestamp:   millisToTime(payload.Timestamp),
+		ReceivedAt:  receivedAt,
+		UUID:        payload.UUID,
+	}
+	if payload.HasSeq {
+		seq := payload.Seq
+		base.Seq = &seq
+	}
+
+	var values []recordValue
+	if d.config.Output == OutputPayload || len(metrics) == 0 {
+		value := base
+		for _, metric := range metrics {
+			value.Metrics = append(value.Metrics, toMetricValue(metric))
+		}
+		values = append(values, value)
+	} else {
+		for _, metric := range metrics {
+			value := base
+			metricJSON := toMetricValue(metric)
+			value.Metric = &metricJSON
+			values = append(values, value)
+		}
+	}
+
+	records := make([]Record, 0, len(values))
+	for _, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal Sparkplug record: %w", err)
+		}
+		records = append(records, Record{Key: topic.Key(), Value: data})
+	}
+	return records, nil
+}
+
+// toMetricValue converts a decoded metric to its JSON form
+func toMetricValue(metric Metric) metricValue {
+	value := metricValue{
+		Name:         metric.Name,
+		Timestamp:    millisToTime(metric.Timestamp),
+		DataType:     dataTypeNames[metric.DataType],
+		IsNull:       metric.IsNull,
+		IsHistorical: metric.IsHistorical,
+		IsTransient:  metric.IsTransient,
+	}
+	if metric.HasAlias {
+		alias := metric.Alias
+		value.Alias = &alias
+	}
+	if !metric.IsNull {
+		value.Value = typedValue(metric.Value, metric.DataType)
+	}
+	return value
+}
+
+// millisToTime converts a Sparkplug timestamp, nil when unset
+func millisToTime(millis uint64) *time.Time {
+	if millis == 0 {
+		return nil
+	}
+	t := time.UnixMilli(int64(millis)).UTC()
+	return &t
+}
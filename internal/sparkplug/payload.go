@@ -0,0 +1,202 @@
+package sparkplug
+
+import (
+	"fmt"
+	"math"
+
+	"gom2k/internal/protowire"
+)
+
+// Sparkplug B metric data types
+const (
+	TypeInt8     = 1
+	TypeInt16    = 2
+	TypeInt32    = 3
+	TypeInt64    = 4
+	TypeUInt8    = 5
+	TypeUInt16   = 6
+	TypeUInt32   = 7
+	TypeUInt64   = 8
+	TypeFloat    = 9
+	TypeDouble   = 10
+	TypeBoolean  = 11
+	TypeString   = 12
+	TypeDateTime = 13
+	TypeText     = 14
+	TypeUUID     = 15
+	TypeDataSet  = 16
+	TypeBytes    = 17
+	TypeFile     = 18
+	TypeTemplate = 19
+)
+
+// dataTypeNames names the data types in decoded records
+var dataTypeNames = map[uint32]string{
+	TypeInt8: "Int8", TypeInt16: "Int16", TypeInt32: "Int32", TypeInt64: "Int64",
+	TypeUInt8: "UInt8", TypeUInt16: "UInt16", TypeUInt32: "UInt32", TypeUInt64: "UInt64",
+	TypeFloat: "Float", TypeDouble: "Double", TypeBoolean: "Boolean", TypeString: "String",
+	TypeDateTime: "DateTime", TypeText: "Text", TypeUUID: "UUID", TypeDataSet: "DataSet",
+	TypeBytes: "Bytes", TypeFile: "File", TypeTemplate: "Template",
+}
+
+// Payload is a decoded Sparkplug B payload
+type Payload struct {
+	Timestamp uint64 // Milliseconds since the epoch
+	Metrics   []Metric
+	Seq       uint64
+	HasSeq    bool
+	UUID      string
+	Body      []byte
+}
+
+// Metric is a decoded Sparkplug B metric. Value holds the raw oneof value: uint64 for
+// integer fields, float32/float64, bool, string or []byte (also for DataSet, Template
+// and extension values, which are kept undecoded).
+type Metric struct {
+	Name         string
+	Alias        uint64
+	HasAlias     bool
+	Timestamp    uint64
+	DataType     uint32
+	IsHistorical bool
+	IsTransient  bool
+	IsNull       bool
+	Value        interface{}
+}
+
+// Metric field numbers
+const (
+	metricName         = 1
+	metricAlias        = 2
+	metricTimestamp    = 3
+	metricDataType     = 4
+	metricIsHistorical = 5
+	metricIsTransient  = 6
+	metricIsNull       = 7
+	metricIntValue     = 10
+	metricLongValue    = 11
+	metricFloatValue   = 12
+	metricDoubleValue  = 13
+	metricBooleanValue = 14
+	metricStringValue  = 15
+	metricBytesValue   = 16
+	metricExtension    = 19 // Last value field (DataSet, Template and extension values precede it)
+)
+
+// DecodePayload decodes a Sparkplug B protobuf payload
+func DecodePayload(data []byte) (*Payload, error) {
+	payload := &Payload{}
+	err := protowire.Decode(data, func(field protowire.Field) error {
+		switch field.Number {
+		case 1:
+			payload.Timestamp = field.Varint
+		case 2:
+			metric, err := decodeMetric(field.Bytes)
+			if err != nil {
+				return err
+			}
+			payload.Metrics = append(payload.Metrics, metric)
+		case 3:
+			payload.Seq = field.Varint
+			payload.HasSeq = true
+		case 4:
+			payload.UUID = string(field.Bytes)
+		case 5:
+			payload.Body = field.Bytes
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid Sparkplug B payload: %w", err)
+	}
+	return payload, nil
+}
+
+// decodeMetric decodes a single metric message
+func decodeMetric(data []byte) (Metric, error) {
+	metric := Metric{}
+	err := protowire.Decode(data, func(field protowire.Field) error {
+		switch field.Number {
+		case metricName:
+			metric.Name = string(field.Bytes)
+		case metricAlias:
+			metric.Alias = field.Varint
+			metric.HasAlias = true
+		case metricTimestamp:
+			metric.Timestamp = field.Varint
+		case metricDataType:
+			metric.DataType = uint32(field.Varint)
+		case metricIsHistorical:
+			metric.IsHistorical = field.Varint != 0
+		case metricIsTransient:
+			metric.IsTransient = field.Varint != 0
+		case metricIsNull:
+			metric.IsNull = field.Varint != 0
+		case metricIntValue, metricLongValue:
+			metric.Value = field.Varint
+		case metricFloatValue:
+			metric.Value = math.Float32frombits(uint32(field.Varint))
+		case metricDoubleValue:
+			metric.Value = math.Float64frombits(field.Varint)
+		case metricBooleanValue:
+			metric.Value = field.Varint != 0
+		case metricStringValue:
+			metric.Value = string(field.Bytes)
+		default:
+			if field.Number >= metricBytesValue && field.Number <= metricExtension {
+				metric.Value = field.Bytes
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Metric{}, fmt.Errorf("invalid metric: %w", err)
+	}
+	return metric, nil
+}
+
+// EncodeRebirthRequest encodes the NCMD payload asking an edge node to republish its
+// birth certificates (metric "Node Control/Rebirth" set to true)
+func EncodeRebirthRequest(timestamp uint64) []byte {
+	var metric []byte
+	metric = protowire.AppendBytes(metric, metricName, []byte("Node Control/Rebirth"))
+	metric = protowire.AppendVarint(metric, metricTimestamp, timestamp)
+	metric = protowire.AppendVarint(metric, metricDataType, TypeBoolean)
+	metric = protowire.AppendVarint(metric, metricBooleanValue, 1)
+
+	var payload []byte
+	payload = protowire.AppendVarint(payload, 1, timestamp)
+	return protowire.AppendBytes(payload, 2, metric)
+}
+
+// typedValue converts a raw metric value to its Sparkplug data type for JSON output.
+// Signed integers are stored as two's complement in unsigned fields.
+func typedValue(value interface{}, dataType uint32) interface{} {
+	switch v := value.(type) {
+	case uint64:
+		switch dataType {
+		case TypeInt8:
+			return int8(v)
+		case TypeInt16:
+			return int16(v)
+		case TypeInt32:
+			return int32(v)
+		case TypeInt64:
+			return int64(v)
+		case TypeBoolean:
+			return v != 0
+		}
+		return v
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return fmt.Sprint(v) // JSON has no NaN or Inf
+		}
+		return v
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Sprint(v)
+		}
+		return v
+	}
+	return value
+}
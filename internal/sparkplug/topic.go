@@ -0,0 +1,84 @@
+// Package sparkplug decodes Sparkplug B traffic: it parses spBv1.0 topics, decodes the
+// protobuf payloads, resolves metric aliases from birth certificates, tracks sequence
+// numbers per edge node and turns NBIRTH/NDATA/DBIRTH/DDATA messages into Kafka records.
+package sparkplug
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Namespace is the first topic level of Sparkplug B topics
+const Namespace = "spBv1.0"
+
+// Sparkplug B message types
+const (
+	MessageNBIRTH = "NBIRTH"
+	MessageNDEATH = "NDEATH"
+	MessageDBIRTH = "DBIRTH"
+	MessageDDEATH = "DDEATH"
+	MessageNDATA  = "NDATA"
+	MessageDDATA  = "DDATA"
+	MessageNCMD   = "NCMD"
+	MessageDCMD   = "DCMD"
+)
+
+// Topic is a parsed Sparkplug B topic: spBv1.0/group_id/message_type/edge_node_id[/device_id]
+type Topic struct {
+	GroupID     string
+	MessageType string
+	EdgeNodeID  string
+	DeviceID    string // Empty for node level messages
+}
+
+// IsSparkplugTopic reports whether an MQTT topic is in the Sparkplug B namespace
+func IsSparkplugTopic(mqttTopic string) bool {
+	return strings.HasPrefix(mqttTopic, Namespace+"/")
+}
+
+// ParseTopic parses a Sparkplug B topic. STATE topics are rejected since they don't
+// carry protobuf payloads.
+func ParseTopic(mqttTopic string) (Topic, error) {
+	levels := strings.Split(mqttTopic, "/")
+	if len(levels) < 4 || len(levels) > 5 || levels[0] != Namespace {
+		return Topic{}, fmt.Errorf("not a Sparkplug B node or device topic: %s", mqttTopic)
+	}
+
+	topic := Topic{GroupID: levels[1], MessageType: levels[2], EdgeNodeID: levels[3]}
+	if len(levels) == 5 {
+		topic.DeviceID = levels[4]
+	}
+
+	switch topic.MessageType {
+	case MessageNBIRTH, MessageNDEATH, MessageNDATA, MessageNCMD:
+		if topic.DeviceID != "" {
+			return Topic{}, fmt.Errorf("node message with device ID: %s", mqttTopic)
+		}
+	case MessageDBIRTH, MessageDDEATH, MessageDDATA, MessageDCMD:
+		if topic.DeviceID == "" {
+			return Topic{}, fmt.Errorf("device message without device ID: %s", mqttTopic)
+		}
+	default:
+		return Topic{}, fmt.Errorf("unknown Sparkplug B message type %q in %s", topic.MessageType, mqttTopic)
+	}
+
+	return topic, nil
+}
+
+// NodeKey identifies the edge node, "group_id/edge_node_id"
+func (t Topic) NodeKey() string {
+	return t.GroupID + "/" + t.EdgeNodeID
+}
+
+// Key identifies the edge node or device, "group_id/edge_node_id[/device_id]"
+func (t Topic) Key() string {
+	if t.DeviceID == "" {
+		return t.NodeKey()
+	}
+	return t.NodeKey() + "/" + t.DeviceID
+}
+
+// CommandTopic returns the NCMD topic of the edge node
+func (t Topic) CommandTopic() string {
+	return Namespace + "/" + t.GroupID + "/" + MessageNCMD + "/" + t.EdgeNodeID
+}
@@ -57,15 +57,31 @@ type KafkaConfig struct {
 	Consumer struct {
 		GroupID string `yaml:"group_id"`
 	} `yaml:"consumer"`
-	Partitioning string `yaml:"partitioning"`
+	Producer     ProducerConfig `yaml:"producer"`
+	Partitioning string         `yaml:"partitioning"`
+}
+
+// ProducerConfig holds Kafka producer delivery settings
+type ProducerConfig struct {
+	Compression  string        `yaml:"compression"`   // Record batch compression: "none", "gzip", "snappy", "lz4" or "zstd"
+	RequiredAcks string        `yaml:"required_acks"` // Acknowledgements per write: "all" (full ISR), "one" (leader) or "none"
+	MaxAttempts  int           `yaml:"max_attempts"`  // Delivery attempts per batch before a write fails
+	WriteTimeout time.Duration `yaml:"write_timeout"` // Timeout for a single produce request
+	BatchBytes   int64         `yaml:"batch_bytes"`   // Maximum size of a produce request in bytes
+	BatchSize    int           `yaml:"batch_size"`    // MQTT messages written to Kafka together, 1 writes each on its own
+	BatchLinger  time.Duration `yaml:"batch_linger"`  // How long MQTT→Kafka waits for a batch to fill
+
+	Transactional      bool          `yaml:"transactional"`       // Commit each write atomically in a Kafka transaction
+	TransactionalID    string        `yaml:"transactional_id"`    // Stable transactional ID, defaults to gom2k-<instance_id>
+	TransactionTimeout time.Duration `yaml:"transaction_timeout"` // Coordinator aborts transactions open longer than this
 }
 
 // BridgeConfig holds bridge behavior settings
 type BridgeConfig struct {
-	Mapping struct {
-		KafkaPrefix     string `yaml:"kafka_prefix"`
-		MaxTopicLevels  int    `yaml:"max_topic_levels"`
-	} `yaml:"mapping"`
+	InstanceID string          `yaml:"instance_id"` // Identifies this bridge instance, defaults to the hostname
+	Mapping    MappingConfig   `yaml:"mapping"`
+	Envelope   EnvelopeConfig  `yaml:"envelope"`
+	Sparkplug  SparkplugConfig `yaml:"sparkplug"`
 	Retry struct {
 		ConnectionTimeout time.Duration `yaml:"connection_timeout"`
 	} `yaml:"retry"`
@@ -76,16 +92,165 @@ type BridgeConfig struct {
 		MQTTToKafka bool `yaml:"mqtt_to_kafka"`
 		KafkaToMQTT bool `yaml:"kafka_to_mqtt"`
 	} `yaml:"features"`
-	Kafka struct {
-		AutoCreateTopics  bool `yaml:"auto_create_topics"`
-		DefaultPartitions int  `yaml:"default_partitions"`
-		ReplicationFactor int  `yaml:"replication_factor"`
-	} `yaml:"kafka"`
-	DeadLetter struct {
-		Enabled       bool   `yaml:"enabled"`
-		KafkaTopic    string `yaml:"kafka_topic"`
-		MQTTTopic     string `yaml:"mqtt_topic"`
-		MaxRetries    int    `yaml:"max_retries"`
-		RetryInterval time.Duration `yaml:"retry_interval"`
-	} `yaml:"dead_letter"`
-}
\ No newline at end of file
+	Kafka      TopicCreationConfig `yaml:"kafka"`
+	DeadLetter DeadLetterConfig    `yaml:"dead_letter"`
+
+	LoopPrevention LoopPreventionConfig `yaml:"loop_prevention"`
+	Ignore         IgnoreConfig         `yaml:"ignore"`
+}
+
+// LoopPreventionConfig keeps bidirectional mode from forwarding messages in circles.
+// Fingerprints only work when both directions run in one process, the namespace also
+// separates bridges running one direction each.
+type LoopPreventionConfig struct {
+	Namespace           string        `yaml:"namespace"`            // MQTT topic prefix of messages from Kafka, ignored by MQTT→Kafka
+	FingerprintTTL      time.Duration `yaml:"fingerprint_ttl"`      // How long forwarded messages are remembered
+	MaxFingerprints     int           `yaml:"max_fingerprints"`     // Forwarded messages remembered at most per direction
+	DisableFingerprints bool          `yaml:"disable_fingerprints"` // Turns off fingerprint-based loop detection
+}
+
+// IgnoreConfig lists MQTT topic filters (with + and # wildcards) of messages a direction
+// doesn't forward
+type IgnoreConfig struct {
+	MQTTToKafka []string `yaml:"mqtt_to_kafka"` // Matched against the topic a message was received on
+	KafkaToMQTT []string `yaml:"kafka_to_mqtt"` // Matched against the topic a record would be published to, defaults to $SYS/# and gom2k/#
+}
+
+// TopicCreationConfig holds the settings for Kafka topics created by the bridge
+type TopicCreationConfig struct {
+	AutoCreateTopics  bool        `yaml:"auto_create_topics"`
+	DefaultPartitions int         `yaml:"default_partitions"`
+	ReplicationFactor int         `yaml:"replication_factor"`
+	TopicRules        []TopicRule `yaml:"topic_rules"` // Per-topic overrides, first match wins
+
+	CreationTimeout time.Duration    `yaml:"creation_timeout"` // How long to wait for partition leaders of new topics
+	Guard           TopicGuardConfig `yaml:"guard"`            // Limits which topics the bridge writes and creates
+}
+
+// TopicGuardConfig protects the cluster from topic floods, e.g. a device publishing
+// random MQTT topics while the bridge subscribes to "#" with auto-created topics.
+type TopicGuardConfig struct {
+	Allow []string `yaml:"allow"` // Kafka topic patterns the bridge may write, empty allows all
+	Deny  []string `yaml:"deny"`  // Kafka topic patterns the bridge must not write, checked before allow
+
+	MaxCreatedTopics int           `yaml:"max_created_topics"` // Topics created per creation_window, 0 is unlimited
+	CreationWindow   time.Duration `yaml:"creation_window"`    // Sliding window of max_created_topics
+
+	DisallowedPolicy string `yaml:"disallowed_policy"` // "dlq" (default), "drop" or "catch_all"
+	CatchAllTopic    string `yaml:"catch_all_topic"`   // Receives disallowed messages with the catch_all policy
+}
+
+// TopicRule overrides the configuration of auto-created topics whose name matches a pattern.
+// Zero values keep the defaults (partitions and replication) or the broker defaults (topic configs).
+type TopicRule struct {
+	Match             string `yaml:"match"`               // Regular expression that must match the whole topic name
+	Partitions        int    `yaml:"partitions"`          // Overrides default_partitions
+	ReplicationFactor int    `yaml:"replication_factor"`  // Overrides replication_factor
+	RetentionMs       int64  `yaml:"retention_ms"`        // retention.ms, -1 retains forever
+	CleanupPolicy     string `yaml:"cleanup_policy"`      // cleanup.policy: "delete", "compact" or "compact,delete"
+	MinInsyncReplicas int    `yaml:"min_insync_replicas"` // min.insync.replicas
+	SegmentBytes      int64  `yaml:"segment_bytes"`       // segment.bytes
+}
+
+// DeadLetterConfig holds the dead letter queue settings
+type DeadLetterConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	KafkaTopic    string        `yaml:"kafka_topic"`
+	MQTTTopic     string        `yaml:"mqtt_topic"`
+	MaxRetries    int           `yaml:"max_retries"`
+	RetryInterval time.Duration `yaml:"retry_interval"` // Delay before the first retry, doubled with every failure
+	Compression   string        `yaml:"compression"`    // Compress serialized failed messages: "none", "gzip", "snappy", "lz4" or "zstd"
+
+	MaxRetryInterval time.Duration `yaml:"max_retry_interval"` // Longest delay between retries
+	RetryJitter      float64       `yaml:"retry_jitter"`       // Share of each delay taken off at random, 0 to 1
+
+	Store RetryStoreConfig `yaml:"store"` // Where messages pending retry are kept
+}
+
+// RetryStoreConfig holds the settings of the dead letter retry store
+type RetryStoreConfig struct {
+	Type        string `yaml:"type"`         // "memory" (default) or "file"
+	Dir         string `yaml:"dir"`          // Directory of the file store, one file per bridge direction
+	MaxMessages int    `yaml:"max_messages"` // Pending retries kept at most
+	Overflow    string `yaml:"overflow"`     // Policy when full: "dead_letter" (default), "evict_oldest" or "drop"
+}
+
+// Retry store types
+const (
+	RetryStoreMemory = "memory" // Pending retries are lost on restart
+	RetryStoreFile   = "file"   // Pending retries are kept in an append-only file
+)
+
+// Overflow policies for failed messages arriving while the retry store is full
+const (
+	OverflowDeadLetter  = "dead_letter"  // The new message goes straight to the dead letter topics
+	OverflowEvictOldest = "evict_oldest" // The oldest pending message goes to the dead letter topics
+	OverflowDrop        = "drop"         // The new message is dropped with a log entry
+)
+
+// DefaultMaxPendingRetries limits the retry store if no capacity is configured
+const DefaultMaxPendingRetries = 10000
+
+// Retry backoff defaults
+const (
+	DefaultMaxRetryInterval = 10 * time.Minute
+	DefaultRetryJitter      = 0.2
+)
+
+// MappingConfig holds the topic mapping settings between MQTT and Kafka
+type MappingConfig struct {
+	KafkaPrefix    string               `yaml:"kafka_prefix"`
+	MaxTopicLevels int                  `yaml:"max_topic_levels"`
+	Sanitize       string               `yaml:"sanitize"`      // Illegal Kafka characters: "replace", "encode" or "drop"
+	Replacement    string               `yaml:"replacement"`   // Substitute for illegal characters when sanitize is "replace"
+	Truncation     string               `yaml:"truncation"`    // Names over 249 chars: "slice" or "hash" (slice + stable hash suffix)
+	ReverseRules   []ReverseMappingRule `yaml:"reverse_rules"` // Kafka→MQTT topic derivation rules, first match wins
+}
+
+// EnvelopeConfig controls how MQTT messages are encoded as Kafka records
+type EnvelopeConfig struct {
+	Mode            string            `yaml:"mode"`             // "json", "raw" (payload bytes, metadata in headers), "cloudevents", "avro" or "protobuf"
+	PayloadEncoding string            `yaml:"payload_encoding"` // JSON mode: "auto" (utf8, base64 for binary payloads) or "base64" (always)
+	EmbedJSON       bool              `yaml:"embed_json"`       // JSON mode: embed payloads that are valid JSON as nested values
+	CloudEvents     CloudEventsConfig `yaml:"cloudevents"`      // Settings for the "cloudevents" mode
+	Schema          SchemaConfig      `yaml:"schema"`           // Schema registry settings for the "avro" and "protobuf" modes
+}
+
+// SchemaConfig configures the schema registry used by the "avro" and "protobuf" envelope
+// modes. When a registry URL is set, Kafka→MQTT forwarding also decodes such records.
+type SchemaConfig struct {
+	RegistryURL     string        `yaml:"registry_url"`
+	Username        string        `yaml:"username"`
+	Password        string        `yaml:"password"`
+	Timeout         time.Duration `yaml:"timeout"`          // Registry request timeout
+	Target          string        `yaml:"target"`           // "envelope" (payload and MQTT metadata) or "payload" (payload only, metadata in headers)
+	SubjectStrategy string        `yaml:"subject_strategy"` // "topic" (<topic>-value), "record" or "topic_record"
+	LookupOnly      bool          `yaml:"lookup_only"`      // Only use schemas that are already registered
+}
+
+// SparkplugConfig controls decoding of Sparkplug B messages (spBv1.0 topics)
+type SparkplugConfig struct {
+	Enabled         bool          `yaml:"enabled"`          // Decode Sparkplug B payloads instead of forwarding opaque bytes
+	Output          string        `yaml:"output"`           // "metric" (one record per metric) or "payload" (one record per message)
+	Rebirth         bool          `yaml:"rebirth"`          // Send rebirth requests on sequence gaps and unknown aliases
+	RebirthInterval time.Duration `yaml:"rebirth_interval"` // Minimum time between rebirth requests to the same edge node
+}
+
+// CloudEventsConfig controls the CloudEvents envelope mode
+type CloudEventsConfig struct {
+	ContentMode string `yaml:"content_mode"` // "structured" (JSON event in the value) or "binary" (ce_ headers)
+	Source      string `yaml:"source"`       // Event source, defaults to /gom2k/<instance_id>
+	Type        string `yaml:"type"`         // Event type, defaults to io.gom2k.mqtt.message
+}
+
+// ReverseMappingRule derives the MQTT topic for a Kafka record from its topic name,
+// record key or a header value. This allows Kafka-native producers, which don't wrap
+// their records in the gom2k JSON envelope, to publish commands to MQTT devices.
+type ReverseMappingRule struct {
+	Source    string `yaml:"source"`     // Value to match: "topic", "key" or "header"
+	Header    string `yaml:"header"`     // Header name, required when source is "header"
+	Match     string `yaml:"match"`      // Regular expression that must match the whole source value
+	MQTTTopic string `yaml:"mqtt_topic"` // Topic template, {1} or {name} expand to capture groups
+	QoS       byte   `yaml:"qos"`        // QoS for records without a gom2k envelope
+	Retained  bool   `yaml:"retained"`   // Retain flag for records without a gom2k envelope
+}
@@ -0,0 +1,189 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DeadLetterSchemaVersion is the version of the dead letter record schema written by
+// this bridge. Records without a version were written before the schema was versioned.
+const DeadLetterSchemaVersion = 1
+
+// Types of original messages in dead letter records
+const (
+	OriginalTypeMQTT  = "mqtt"  // An MQTT message that failed on its way to Kafka
+	OriginalTypeKafka = "kafka" // A Kafka record that failed on its way to MQTT
+)
+
+// DeadLetterRecord is the versioned schema of the messages published to the dead letter
+// topics. The original message is stored with a type discriminator, so it can be decoded
+// back into an MQTT message or Kafka record.
+type DeadLetterRecord struct {
+	Version       int                `json:"version"`
+	MessageID     string             `json:"message_id,omitempty"`  // ID the bridge assigned to the original message
+	InstanceID    string             `json:"instance_id,omitempty"` // Bridge instance that gave up on the message
+	Direction     string             `json:"direction"`             // "mqtt-to-kafka" or "kafka-to-mqtt"
+	OriginalTopic string             `json:"original_topic"`
+	TargetTopic   string             `json:"target_topic"`
+	FailureReason string             `json:"failure_reason"`
+	ErrorClass    string             `json:"error_class"` // "transient" or "permanent"
+	AttemptCount  int                `json:"attempt_count"`
+	FirstFailure  time.Time          `json:"first_failure"`
+	LastAttempt   time.Time          `json:"last_attempt"`
+	Original      DeadLetterOriginal `json:"original"`
+}
+
+// DeadLetterOriginal holds the original message of a dead letter record. Type names the
+// field that is set.
+type DeadLetterOriginal struct {
+	Type  string                 `json:"type"`
+	MQTT  *MQTTMessage           `json:"mqtt,omitempty"`
+	Kafka *DeadLetterKafkaRecord `json:"kafka,omitempty"`
+}
+
+// DeadLetterKafkaRecord is a Kafka record in a dead letter record. The partition and
+// offset locate the record in its source topic. Values are stored like MQTT payloads,
+// as text when they are valid UTF-8 and as base64 otherwise.
+type DeadLetterKafkaRecord struct {
+	Topic         string                  `json:"topic"`
+	Partition     int                     `json:"partition"`
+	Offset        int64                   `json:"offset"`
+	Key           string                  `json:"key"`
+	Value         string                  `json:"value"`
+	ValueEncoding string                  `json:"value_encoding"`
+	Headers       []DeadLetterKafkaHeader `json:"headers,omitempty"`
+}
+
+// DeadLetterKafkaHeader is a Kafka record header in a dead letter record
+type DeadLetterKafkaHeader struct {
+	Key           string `json:"key"`
+	Value         string `json:"value"`
+	ValueEncoding string `json:"value_encoding"`
+}
+
+// NewDeadLetterRecord creates the dead letter record of a failed message
+func NewDeadLetterRecord(failedMsg *FailedMessage, instanceID string) (*DeadLetterRecord, error) {
+	record := &DeadLetterRecord{
+		Version:       DeadLetterSchemaVersion,
+		MessageID:     failedMsg.MessageID,
+		InstanceID:    instanceID,
+		Direction:     failedMsg.Direction,
+		OriginalTopic: failedMsg.OriginalTopic,
+		TargetTopic:   failedMsg.TargetTopic,
+		FailureReason: failedMsg.FailureReason,
+		ErrorClass:    failedMsg.ErrorClass,
+		AttemptCount:  failedMsg.AttemptCount,
+		FirstFailure:  failedMsg.FirstFailure,
+		LastAttempt:   failedMsg.LastAttempt,
+	}
+
+	switch original := failedMsg.OriginalMessage.(type) {
+	case *MQTTMessage:
+		record.Original = DeadLetterOriginal{Type: OriginalTypeMQTT, MQTT: original}
+	case *KafkaMessage:
+		value, encoding := EncodePayload(original.Value, false)
+		kafkaRecord := &DeadLetterKafkaRecord{
+			Topic:         original.Topic,
+			Partition:     original.Partition,
+			Offset:        original.Offset,
+			Key:           original.Key,
+			Value:         value,
+			ValueEncoding: encoding,
+		}
+		for _, header := range original.Headers {
+			headerValue, headerEncoding := EncodePayload(header.Value, false)
+			kafkaRecord.Headers = append(kafkaRecord.Headers, DeadLetterKafkaHeader{Key: header.Key, Value: headerValue, ValueEncoding: headerEncoding})
+		}
+		record.Original = DeadLetterOriginal{Type: OriginalTypeKafka, Kafka: kafkaRecord}
+	default:
+		return nil, fmt.Errorf("unsupported message type %T", failedMsg.OriginalMessage)
+	}
+	return record, nil
+}
+
+// FailedMessage restores the failed message of a dead letter record
+func (r *DeadLetterRecord) FailedMessage() (*FailedMessage, error) {
+	failedMsg := &FailedMessage{
+		MessageID:     r.MessageID,
+		FailureReason: r.FailureReason,
+		AttemptCount:  r.AttemptCount,
+		FirstFailure:  r.FirstFailure,
+		LastAttempt:   r.LastAttempt,
+		ErrorClass:    r.ErrorClass,
+		Direction:     r.Direction,
+		OriginalTopic: r.OriginalTopic,
+		TargetTopic:   r.TargetTopic,
+	}
+
+	switch r.Original.Type {
+	case OriginalTypeMQTT:
+		if r.Original.MQTT == nil {
+			return nil, fmt.Errorf("dead letter record of type %s without MQTT message", r.Original.Type)
+		}
+		failedMsg.OriginalMessage = r.Original.MQTT
+	case OriginalTypeKafka:
+		if r.Original.Kafka == nil {
+			return nil, fmt.Errorf("dead letter record of type %s without Kafka record", r.Original.Type)
+		}
+		kafkaMsg, err := r.Original.Kafka.message()
+		if err != nil {
+			return nil, err
+		}
+		kafkaMsg.ID = r.MessageID
+		failedMsg.OriginalMessage = kafkaMsg
+	default:
+		return nil, fmt.Errorf("unknown original message type in dead letter record: %q", r.Original.Type)
+	}
+	return failedMsg, nil
+}
+
+// message decodes the value and headers of a Kafka record
+func (r *DeadLetterKafkaRecord) message() (*KafkaMessage, error) {
+	value, err := DecodePayload(r.Value, r.ValueEncoding)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kafka record value: %w", err)
+	}
+
+	kafkaMsg := &KafkaMessage{
+		Topic:     r.Topic,
+		Partition: r.Partition,
+		Offset:    r.Offset,
+		Key:       r.Key,
+		Value:     value,
+	}
+	for _, header := range r.Headers {
+		headerValue, err := DecodePayload(header.Value, header.ValueEncoding)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Kafka record header %s: %w", header.Key, err)
+		}
+		kafkaMsg.Headers = append(kafkaMsg.Headers, KafkaHeader{Key: header.Key, Value: headerValue})
+	}
+	return kafkaMsg, nil
+}
+
+// EncodeDeadLetterRecord serializes a failed message as a dead letter record
+func EncodeDeadLetterRecord(failedMsg *FailedMessage, instanceID string) ([]byte, error) {
+	record, err := NewDeadLetterRecord(failedMsg, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(record)
+}
+
+// DecodeDeadLetterRecord parses a dead letter record. Records of an unknown version are
+// rejected, as are records without a version.
+func DecodeDeadLetterRecord(data []byte) (*DeadLetterRecord, error) {
+	var record DeadLetterRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid dead letter record: %w", err)
+	}
+	if record.Version < 1 || record.Version > DeadLetterSchemaVersion {
+		return nil, fmt.Errorf("unsupported dead letter record version: %d", record.Version)
+	}
+	// Restoring the failed message validates the original message
+	if _, err := record.FailedMessage(); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
@@ -1,9 +1,13 @@
 package types
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // MQTTMessage represents an MQTT message with metadata
 type MQTTMessage struct {
+	ID        string    `json:"message_id,omitempty"` // Assigned by the bridge on receipt
 	Topic     string    `json:"mqtt_topic"`
 	Payload   []byte    `json:"payload"`
 	QoS       byte      `json:"qos"`
@@ -11,21 +15,98 @@ type MQTTMessage struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// mqttMessageJSON is the serialized form of MQTTMessage with a text-safe payload
+type mqttMessageJSON struct {
+	ID              string    `json:"message_id,omitempty"`
+	Topic           string    `json:"mqtt_topic"`
+	Payload         string    `json:"payload"`
+	PayloadEncoding string    `json:"payload_encoding"`
+	QoS             byte      `json:"qos"`
+	Retained        bool      `json:"retained"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// MarshalJSON keeps text payloads readable and base64 encodes binary payloads,
+// recording the choice in payload_encoding
+func (m MQTTMessage) MarshalJSON() ([]byte, error) {
+	payload, encoding := EncodePayload(m.Payload, false)
+	return json.Marshal(mqttMessageJSON{
+		ID:              m.ID,
+		Topic:           m.Topic,
+		Payload:         payload,
+		PayloadEncoding: encoding,
+		QoS:             m.QoS,
+		Retained:        m.Retained,
+		Timestamp:       m.Timestamp,
+	})
+}
+
+// UnmarshalJSON decodes the payload according to payload_encoding. Without it the
+// payload is treated as base64, which is how messages were serialized before.
+func (m *MQTTMessage) UnmarshalJSON(data []byte) error {
+	var raw mqttMessageJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	encoding := raw.PayloadEncoding
+	if encoding == "" {
+		encoding = PayloadEncodingBase64
+	}
+	payload, err := DecodePayload(raw.Payload, encoding)
+	if err != nil {
+		return err
+	}
+
+	*m = MQTTMessage{
+		ID:        raw.ID,
+		Topic:     raw.Topic,
+		Payload:   payload,
+		QoS:       raw.QoS,
+		Retained:  raw.Retained,
+		Timestamp: raw.Timestamp,
+	}
+	return nil
+}
+
 // KafkaMessage represents a Kafka message
 type KafkaMessage struct {
+	ID        string // Assigned by the bridge on receipt, not part of the record
+	Key       string
+	Value     []byte
+	Topic     string
+	Partition int   // Where a consumed record was read from
+	Offset    int64 // Offset of a consumed record in its partition
+	Headers   []KafkaHeader
+}
+
+// KafkaHeader represents a single Kafka record header
+type KafkaHeader struct {
 	Key   string
 	Value []byte
-	Topic string
+}
+
+// Header returns the value of the first header with the given key
+func (m *KafkaMessage) Header(key string) (string, bool) {
+	for _, header := range m.Headers {
+		if header.Key == key {
+			return string(header.Value), true
+		}
+	}
+	return "", false
 }
 
 // FailedMessage represents a message that failed processing and should be sent to dead letter queue
 type FailedMessage struct {
-	OriginalMessage interface{} `json:"original_message"` // The original MQTT or Kafka message
-	FailureReason   string      `json:"failure_reason"`   // Why the message failed
-	AttemptCount    int         `json:"attempt_count"`    // Number of processing attempts
-	FirstFailure    time.Time   `json:"first_failure"`    // When the message first failed
-	LastAttempt     time.Time   `json:"last_attempt"`     // When the last attempt was made
-	Direction       string      `json:"direction"`        // "mqtt-to-kafka" or "kafka-to-mqtt"
-	OriginalTopic   string      `json:"original_topic"`   // The topic where message originated
-	TargetTopic     string      `json:"target_topic"`     // The topic where message was being sent
-}
\ No newline at end of file
+	MessageID       string      `json:"message_id,omitempty"`  // ID the bridge assigned to the original message
+	OriginalMessage interface{} `json:"original_message"`      // The original MQTT or Kafka message
+	FailureReason   string      `json:"failure_reason"`        // Why the message failed
+	AttemptCount    int         `json:"attempt_count"`         // Number of processing attempts
+	FirstFailure    time.Time   `json:"first_failure"`         // When the message first failed
+	LastAttempt     time.Time   `json:"last_attempt"`          // When the last attempt was made
+	NextAttempt     time.Time   `json:"next_attempt"`          // When the message is retried next
+	ErrorClass      string      `json:"error_class,omitempty"` // "transient" or "permanent"
+	Direction       string      `json:"direction"`             // "mqtt-to-kafka" or "kafka-to-mqtt"
+	OriginalTopic   string      `json:"original_topic"`        // The topic where message originated
+	TargetTopic     string      `json:"target_topic"`          // The topic where message was being sent
+}
@@ -0,0 +1,41 @@
+package types
+
+import (
+	"encoding/base64"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Payload encodings for MQTT payloads embedded in JSON documents
+const (
+	PayloadEncodingAuto   = "auto"   // utf8 for valid UTF-8 text, base64 otherwise
+	PayloadEncodingUTF8   = "utf8"   // Payload is stored as a JSON string
+	PayloadEncodingBase64 = "base64" // Payload is stored as standard base64
+)
+
+// EncodePayload converts a payload to a JSON-safe string and returns the encoding used.
+// Payloads that aren't valid UTF-8 are always base64 encoded, as are all payloads when
+// forceBase64 is set.
+func EncodePayload(payload []byte, forceBase64 bool) (string, string) {
+	if !forceBase64 && utf8.Valid(payload) {
+		return string(payload), PayloadEncodingUTF8
+	}
+	return base64.StdEncoding.EncodeToString(payload), PayloadEncodingBase64
+}
+
+// DecodePayload reverses EncodePayload. An empty encoding is treated as utf8 so that
+// JSON envelopes written before payload_encoding existed still decode.
+func DecodePayload(encoded string, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", PayloadEncodingUTF8:
+		return []byte(encoded), nil
+	case PayloadEncodingBase64:
+		payload, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 payload: %w", err)
+		}
+		return payload, nil
+	default:
+		return nil, fmt.Errorf("unknown payload encoding: %s", encoding)
+	}
+}
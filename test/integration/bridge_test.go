@@ -125,11 +125,7 @@ func getBridgeTestConfig() *types.BridgeConfig {
 			MQTTToKafka: true,
 			KafkaToMQTT: true,
 		},
-		Kafka: struct {
-			AutoCreateTopics  bool `yaml:"auto_create_topics"`
-			DefaultPartitions int  `yaml:"default_partitions"`
-			ReplicationFactor int  `yaml:"replication_factor"`
-		}{
+		Kafka: types.TopicCreationConfig{
 			AutoCreateTopics:  true,
 			DefaultPartitions: 1,
 			ReplicationFactor: 1,
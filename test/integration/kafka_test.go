@@ -151,18 +151,11 @@ func getKafkaTestConfig() *types.KafkaConfig {
 
 func getBridgeTestConfig() *types.BridgeConfig {
 	return &types.BridgeConfig{
-		Mapping: struct {
-			KafkaPrefix    string `yaml:"kafka_prefix"`
-			MaxTopicLevels int    `yaml:"max_topic_levels"`
-		}{
+		Mapping: types.MappingConfig{
 			KafkaPrefix:    "gom2k-test",
 			MaxTopicLevels: 3,
 		},
-		Kafka: struct {
-			AutoCreateTopics  bool `yaml:"auto_create_topics"`
-			DefaultPartitions int  `yaml:"default_partitions"`
-			ReplicationFactor int  `yaml:"replication_factor"`
-		}{
+		Kafka: types.TopicCreationConfig{
 			AutoCreateTopics:  true,
 			DefaultPartitions: 1,
 			ReplicationFactor: 1,
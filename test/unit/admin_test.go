@@ -0,0 +1,77 @@
+package unit
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"gom2k/internal/kafka"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// closedAddress returns a local address nothing is listening on
+func closedAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+func TestAdminClientTriesEveryBroker(t *testing.T) {
+	brokers := []string{closedAddress(t), "not-an-address", closedAddress(t)}
+	admin := kafka.NewAdminClient(brokers, &kafkago.Dialer{Timeout: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := admin.ListTopics(ctx)
+	if err == nil {
+		t.Fatal("Expected error when no broker is reachable")
+	}
+	for _, broker := range brokers {
+		if !strings.Contains(err.Error(), broker) {
+			t.Errorf("Expected error to mention broker %s: %v", broker, err)
+		}
+	}
+
+	err = admin.CreateTopics(ctx, kafkago.TopicConfig{Topic: "gom2k.test", NumPartitions: 1, ReplicationFactor: 1})
+	if err == nil || !strings.Contains(err.Error(), "controller") {
+		t.Errorf("Expected controller lookup error, got %v", err)
+	}
+}
+
+func TestAdminClientWithoutBrokers(t *testing.T) {
+	admin := kafka.NewAdminClient(nil, &kafkago.Dialer{Timeout: time.Second})
+	if _, err := admin.ListTopics(context.Background()); err == nil || !strings.Contains(err.Error(), "no Kafka brokers configured") {
+		t.Errorf("Expected missing brokers error, got %v", err)
+	}
+}
+
+func TestAdminClientEnsureTopicSurfacesErrors(t *testing.T) {
+	admin := kafka.NewAdminClient([]string{closedAddress(t)}, &kafkago.Dialer{Timeout: time.Second})
+	ctx := context.Background()
+
+	created, err := admin.EnsureTopic(ctx, kafkago.TopicConfig{Topic: "gom2k.test", NumPartitions: 1, ReplicationFactor: 1}, time.Second)
+	if err == nil || created {
+		t.Fatalf("Expected metadata error, got created=%v err=%v", created, err)
+	}
+	if !strings.Contains(err.Error(), "gom2k.test") {
+		t.Errorf("Expected error to name the topic: %v", err)
+	}
+
+	// Waiting is bounded by the timeout
+	start := time.Now()
+	err = admin.WaitForTopic(ctx, "gom2k.test", 200*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "not ready after") {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected wait to stop after the timeout, took %v", elapsed)
+	}
+}
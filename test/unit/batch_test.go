@@ -0,0 +1,104 @@
+package unit
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gom2k/internal/bridge"
+	"gom2k/internal/kafka"
+	"gom2k/pkg/types"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// batchRecorder collects the batches flushed by a record batcher
+type batchRecorder struct {
+	mutex   sync.Mutex
+	batches [][]string
+}
+
+func (r *batchRecorder) flush(records []*bridge.BatchedRecord) {
+	var topics []string
+	for _, record := range records {
+		topics = append(topics, record.MQTTMessage.Topic)
+	}
+	r.mutex.Lock()
+	r.batches = append(r.batches, topics)
+	r.mutex.Unlock()
+}
+
+func (r *batchRecorder) sizes() []int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var sizes []int
+	for _, batch := range r.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+func batchedRecord(i int) *bridge.BatchedRecord {
+	topic := fmt.Sprintf("sensor/room%d", i)
+	return &bridge.BatchedRecord{
+		MQTTMessage:  &types.MQTTMessage{Topic: topic},
+		KafkaMessage: &types.KafkaMessage{Topic: "gom2k.sensor", Key: topic},
+	}
+}
+
+func TestRecordBatcher(t *testing.T) {
+	recorder := &batchRecorder{}
+	batcher := bridge.NewRecordBatcher(3, 50*time.Millisecond, recorder.flush)
+
+	// Full batches are written right away, the rest after the linger time
+	for i := 0; i < 7; i++ {
+		batcher.Add(batchedRecord(i))
+	}
+	time.Sleep(20 * time.Millisecond)
+	if sizes := recorder.sizes(); fmt.Sprint(sizes) != "[3 3]" {
+		t.Errorf("Expected two full batches before the linger time, got %v", sizes)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if sizes := recorder.sizes(); fmt.Sprint(sizes) != "[3 3 1]" {
+		t.Errorf("Expected the partial batch after the linger time, got %v", sizes)
+	}
+
+	// Closing writes the queued records, later ones are written on their own
+	batcher.Add(batchedRecord(7))
+	batcher.Close()
+	batcher.Add(batchedRecord(8))
+	if sizes := recorder.sizes(); fmt.Sprint(sizes) != "[3 3 1 1 1]" {
+		t.Errorf("Expected queued and late records to be flushed, got %v", sizes)
+	}
+
+	// Records keep their order across batches
+	var topics []string
+	for _, batch := range recorder.batches {
+		topics = append(topics, batch...)
+	}
+	for i, topic := range topics {
+		if topic != fmt.Sprintf("sensor/room%d", i) {
+			t.Fatalf("Expected records in order, got %v", topics)
+		}
+	}
+}
+
+func TestFailedWrites(t *testing.T) {
+	writeErr := errors.New("leader not available")
+
+	// Only the failed messages of a partial write are written again
+	partial := fmt.Errorf("failed to write messages to Kafka: %w", kafkago.WriteErrors{nil, writeErr, nil, writeErr})
+	if failed := kafka.FailedWrites(partial, 4); fmt.Sprint(failed) != "[1 3]" {
+		t.Errorf("Expected the failed messages of a partial write, got %v", failed)
+	}
+
+	// Any other failure leaves all messages unwritten
+	if failed := kafka.FailedWrites(writeErr, 3); fmt.Sprint(failed) != "[0 1 2]" {
+		t.Errorf("Expected all messages to have failed, got %v", failed)
+	}
+	if failed := kafka.FailedWrites(nil, 3); len(failed) != 0 {
+		t.Errorf("Expected no failed messages, got %v", failed)
+	}
+}
@@ -0,0 +1,159 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gom2k/internal/kafka"
+	"gom2k/pkg/types"
+)
+
+func cloudEventsEnvelope(contentMode string) *types.EnvelopeConfig {
+	return &types.EnvelopeConfig{
+		Mode: kafka.EnvelopeCloudEvents,
+		CloudEvents: types.CloudEventsConfig{
+			ContentMode: contentMode,
+			Source:      "/gom2k/bridge-1",
+			Type:        kafka.DefaultCloudEventType,
+		},
+	}
+}
+
+func TestCloudEventsStructuredMode(t *testing.T) {
+	timestamp := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		payload     []byte
+		contentType string
+		dataField   string
+	}{
+		{"JSON payload", []byte(`{"temperature":23.5}`), "application/json", "data"},
+		{"text payload", []byte("ON"), "text/plain; charset=utf-8", "data"},
+		{"binary payload", []byte{0x08, 0xff, 0x00}, "application/octet-stream", "data_base64"},
+		{"formatted JSON payload", []byte("{\n  \"html\": \"<b>a & b</b>\",\n  \"n\": [1, 2]\n}"), "application/json", "data"},
+		{"text payload with markup", []byte("<b>a & b</b>"), "text/plain; charset=utf-8", "data"},
+		{"JSON payload with surrounding whitespace", []byte(" {\"on\": true}\n"), "text/plain; charset=utf-8", "data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mqttMsg := &types.MQTTMessage{Topic: "sensor/room1/temp", Payload: tt.payload, QoS: 1, Retained: true, Timestamp: timestamp}
+
+			kafkaMsg, err := kafka.ConvertMQTTMessageWithEnvelope(mqttMsg, "gom2k.sensor.room1.temp", cloudEventsEnvelope(kafka.CloudEventsStructured))
+			if err != nil {
+				t.Fatalf("Failed to convert MQTT message: %v", err)
+			}
+
+			if contentType, _ := kafkaMsg.Header("content-type"); contentType != "application/cloudevents+json" {
+				t.Errorf("Expected content-type application/cloudevents+json, got %q", contentType)
+			}
+
+			var event map[string]interface{}
+			if err := json.Unmarshal(kafkaMsg.Value, &event); err != nil {
+				t.Fatalf("Failed to parse CloudEvent: %v", err)
+			}
+			expected := map[string]string{
+				"specversion":     "1.0",
+				"source":          "/gom2k/bridge-1",
+				"type":            kafka.DefaultCloudEventType,
+				"subject":         "sensor/room1/temp",
+				"time":            "2024-01-01T12:00:00Z",
+				"datacontenttype": tt.contentType,
+			}
+			for attribute, value := range expected {
+				if event[attribute] != value {
+					t.Errorf("Expected %s %q, got %v", attribute, value, event[attribute])
+				}
+			}
+			if id, _ := event["id"].(string); id == "" {
+				t.Error("Expected non-empty event id")
+			}
+			if _, ok := event[tt.dataField]; !ok {
+				t.Errorf("Expected %s field in %s", tt.dataField, kafkaMsg.Value)
+			}
+			if tt.contentType == "application/json" && !bytes.Contains(kafkaMsg.Value, tt.payload) {
+				t.Errorf("Expected JSON data verbatim in %s", kafkaMsg.Value)
+			}
+			if bytes.Contains(kafkaMsg.Value, []byte(`\u003c`)) {
+				t.Errorf("Expected no HTML escaping in %s", kafkaMsg.Value)
+			}
+
+			restored, err := kafka.ConvertKafkaMessage(kafkaMsg)
+			if err != nil {
+				t.Fatalf("Failed to convert CloudEvent: %v", err)
+			}
+			if restored.Topic != mqttMsg.Topic || !bytes.Equal(restored.Payload, tt.payload) {
+				t.Errorf("Round trip mismatch: topic %q payload %v", restored.Topic, restored.Payload)
+			}
+			if restored.QoS != 1 || !restored.Retained || !restored.Timestamp.Equal(timestamp) {
+				t.Errorf("Round trip metadata mismatch: %+v", restored)
+			}
+		})
+	}
+}
+
+func TestCloudEventsBinaryMode(t *testing.T) {
+	payload := []byte{0x08, 0x96, 0x01}
+	mqttMsg := &types.MQTTMessage{Topic: "sensor/room1/temp", Payload: payload, Timestamp: time.Now()}
+
+	kafkaMsg, err := kafka.ConvertMQTTMessageWithEnvelope(mqttMsg, "gom2k.sensor.room1.temp", cloudEventsEnvelope(kafka.CloudEventsBinary))
+	if err != nil {
+		t.Fatalf("Failed to convert MQTT message: %v", err)
+	}
+
+	if !bytes.Equal(kafkaMsg.Value, payload) {
+		t.Errorf("Expected payload as record value, got %v", kafkaMsg.Value)
+	}
+	for header, expected := range map[string]string{
+		"ce_specversion": "1.0",
+		"ce_source":      "/gom2k/bridge-1",
+		"ce_subject":     "sensor/room1/temp",
+		"content-type":   "application/octet-stream",
+	} {
+		if value, ok := kafkaMsg.Header(header); !ok || value != expected {
+			t.Errorf("Expected header %s=%q, got %q", header, expected, value)
+		}
+	}
+
+	restored, err := kafka.ConvertKafkaMessage(kafkaMsg)
+	if err != nil {
+		t.Fatalf("Failed to convert CloudEvent: %v", err)
+	}
+	if restored.Topic != mqttMsg.Topic || !bytes.Equal(restored.Payload, payload) {
+		t.Errorf("Round trip mismatch: topic %q payload %v", restored.Topic, restored.Payload)
+	}
+}
+
+func TestIncomingCloudEvents(t *testing.T) {
+	// Structured event from another producer without gom2k extensions
+	structured := &types.KafkaMessage{Value: []byte(`{
+		"specversion": "1.0", "id": "42", "source": "/billing", "type": "com.example.command",
+		"subject": "devices/lamp1/set", "datacontenttype": "application/json", "data": {"on": true}
+	}`)}
+	mqttMsg, err := kafka.ConvertKafkaMessage(structured)
+	if err != nil {
+		t.Fatalf("Failed to convert structured CloudEvent: %v", err)
+	}
+	if mqttMsg.Topic != "devices/lamp1/set" || string(mqttMsg.Payload) != `{"on": true}` {
+		t.Errorf("Unexpected MQTT message: topic %q payload %q", mqttMsg.Topic, mqttMsg.Payload)
+	}
+
+	// Text data is carried as a JSON string
+	text := &types.KafkaMessage{Value: []byte(`{"specversion":"1.0","id":"1","source":"/x","type":"t","subject":"a/b","datacontenttype":"text/plain","data":"ON"}`)}
+	if mqttMsg, err := kafka.ConvertKafkaMessage(text); err != nil || string(mqttMsg.Payload) != "ON" {
+		t.Errorf("Expected text payload 'ON', got %v (err: %v)", mqttMsg, err)
+	}
+
+	// Events without a subject can't be routed to MQTT
+	noSubject := &types.KafkaMessage{Value: []byte(`{"specversion":"1.0","id":"1","source":"/x","type":"t","data":"ON"}`)}
+	if _, err := kafka.ConvertKafkaMessage(noSubject); err == nil {
+		t.Error("Expected error for CloudEvent without subject")
+	}
+
+	binaryNoSubject := &types.KafkaMessage{Value: []byte("ON"), Headers: []types.KafkaHeader{{Key: "ce_specversion", Value: []byte("1.0")}}}
+	if _, err := kafka.ConvertKafkaMessage(binaryNoSubject); err == nil {
+		t.Error("Expected error for binary CloudEvent without subject")
+	}
+}
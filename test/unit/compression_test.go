@@ -0,0 +1,52 @@
+package unit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gom2k/internal/kafka"
+)
+
+func TestPayloadCompressionRoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat(`{"payload":"23.5","qos":0,"retained":false,"mqtt_topic":"sensor/room1/temp"}`, 50))
+
+	for _, name := range []string{"gzip", "snappy", "lz4", "zstd"} {
+		t.Run(name, func(t *testing.T) {
+			compressed, err := kafka.CompressPayload(data, name)
+			if err != nil {
+				t.Fatalf("Failed to compress: %v", err)
+			}
+			if len(compressed) >= len(data) {
+				t.Errorf("Expected repetitive data to shrink, %d >= %d bytes", len(compressed), len(data))
+			}
+
+			decompressed, err := kafka.DecompressPayload(compressed, name)
+			if err != nil {
+				t.Fatalf("Failed to decompress: %v", err)
+			}
+			if !bytes.Equal(decompressed, data) {
+				t.Error("Round trip changed the data")
+			}
+		})
+	}
+}
+
+func TestCompressionNames(t *testing.T) {
+	for _, name := range []string{"", "none", "gzip", "snappy", "lz4", "zstd"} {
+		if _, err := kafka.ParseCompression(name); err != nil {
+			t.Errorf("Expected %q to be valid: %v", name, err)
+		}
+	}
+	if _, err := kafka.ParseCompression("brotli"); err == nil {
+		t.Error("Expected error for unsupported compression")
+	}
+
+	// No compression passes data through
+	data := []byte("ON")
+	for _, name := range []string{"", "none"} {
+		if result, err := kafka.CompressPayload(data, name); err != nil || !bytes.Equal(result, data) {
+			t.Errorf("Expected %q to leave data unchanged, got %q (err: %v)", name, result, err)
+		}
+	}
+}
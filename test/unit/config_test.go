@@ -1,10 +1,17 @@
 package unit
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"gom2k/internal/config"
+	"gom2k/internal/kafka"
 	"gom2k/pkg/types"
+
+	kafkago "github.com/segmentio/kafka-go"
 )
 
 func TestConfigLoading(t *testing.T) {
@@ -205,4 +212,91 @@ func applyTestDefaults(config *types.Config) {
 func validateTestConfig(cfg *types.Config) error {
 	// Use the actual config package validation function in test mode
 	return config.ValidateConfig(cfg, true)
-}
\ No newline at end of file
+}
+func TestProducerDeliveryConfig(t *testing.T) {
+	writeConfig := func(producerYAML string) string {
+		configYAML := `
+mqtt:
+  broker:
+    host: "localhost"
+    port: 1883
+kafka:
+  brokers: ["localhost:9092"]
+` + producerYAML + `
+bridge:
+  features:
+    mqtt_to_kafka: true
+`
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+			t.Fatalf("Failed to write test config: %v", err)
+		}
+		return configPath
+	}
+
+	// Defaults guarantee acks from the full ISR and write each MQTT message on its own
+	loaded, err := config.LoadForTesting(writeConfig(""))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	producer := loaded.Kafka.Producer
+	if producer.RequiredAcks != "all" || producer.MaxAttempts != 10 || producer.WriteTimeout != 10*time.Second || producer.BatchBytes != 1048576 || producer.BatchSize != 1 {
+		t.Errorf("Unexpected producer defaults: %+v", producer)
+	}
+
+	loaded, err = config.LoadForTesting(writeConfig(`  producer:
+    required_acks: "one"
+    max_attempts: 5
+    write_timeout: "30s"
+    batch_bytes: 524288`))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	producer = loaded.Kafka.Producer
+	if producer.RequiredAcks != "one" || producer.MaxAttempts != 5 || producer.WriteTimeout != 30*time.Second || producer.BatchBytes != 524288 {
+		t.Errorf("Producer settings not loaded correctly: %+v", producer)
+	}
+
+	// Transactional producers default to a transactional ID derived from the instance ID
+	loaded, err = config.LoadForTesting(writeConfig(`  producer:
+    transactional: true`))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	producer = loaded.Kafka.Producer
+	if producer.TransactionalID != "gom2k-"+loaded.Bridge.InstanceID || producer.TransactionTimeout != 60*time.Second {
+		t.Errorf("Unexpected transactional defaults: %+v", producer)
+	}
+
+	invalid := map[string]string{
+		"transactional": "    transactional: true\n    required_acks: \"one\"",
+		"required_acks": `    required_acks: "leader"`,
+		"max_attempts":  `    max_attempts: -1`,
+		"write_timeout": `    write_timeout: "-5s"`,
+		"batch_bytes":   `    batch_bytes: -1`,
+	}
+	for field, line := range invalid {
+		_, err := config.LoadForTesting(writeConfig("  producer:\n" + line))
+		if err == nil || !strings.Contains(err.Error(), field) {
+			t.Errorf("Expected %s validation error, got %v", field, err)
+		}
+	}
+}
+
+func TestParseRequiredAcks(t *testing.T) {
+	tests := map[string]kafkago.RequiredAcks{
+		"":     kafkago.RequireAll,
+		"all":  kafkago.RequireAll,
+		"one":  kafkago.RequireOne,
+		"none": kafkago.RequireNone,
+	}
+	for name, expected := range tests {
+		acks, err := kafka.ParseRequiredAcks(name)
+		if err != nil || acks != expected {
+			t.Errorf("ParseRequiredAcks(%q) = %v, %v; expected %v", name, acks, err, expected)
+		}
+	}
+	if _, err := kafka.ParseRequiredAcks("-1"); err == nil {
+		t.Error("Expected error for numeric required acks")
+	}
+}
@@ -11,13 +11,7 @@ import (
 func TestNewDeadLetterQueue(t *testing.T) {
 	// Test with DLQ disabled
 	config := &types.BridgeConfig{
-		DeadLetter: struct {
-			Enabled       bool   `yaml:"enabled"`
-			KafkaTopic    string `yaml:"kafka_topic"`
-			MQTTTopic     string `yaml:"mqtt_topic"`
-			MaxRetries    int    `yaml:"max_retries"`
-			RetryInterval time.Duration `yaml:"retry_interval"`
-		}{
+		DeadLetter: types.DeadLetterConfig{
 			Enabled: false,
 		},
 	}
@@ -44,13 +38,7 @@ func TestNewDeadLetterQueue(t *testing.T) {
 
 func TestDeadLetterQueueStartStop(t *testing.T) {
 	config := &types.BridgeConfig{
-		DeadLetter: struct {
-			Enabled       bool   `yaml:"enabled"`
-			KafkaTopic    string `yaml:"kafka_topic"`
-			MQTTTopic     string `yaml:"mqtt_topic"`
-			MaxRetries    int    `yaml:"max_retries"`
-			RetryInterval time.Duration `yaml:"retry_interval"`
-		}{
+		DeadLetter: types.DeadLetterConfig{
 			Enabled:       true,
 			MaxRetries:    2,
 			RetryInterval: 100 * time.Millisecond, // Short interval for testing
@@ -75,13 +63,7 @@ func TestDeadLetterQueueStartStop(t *testing.T) {
 
 func TestHandleFailedMessage(t *testing.T) {
 	config := &types.BridgeConfig{
-		DeadLetter: struct {
-			Enabled       bool   `yaml:"enabled"`
-			KafkaTopic    string `yaml:"kafka_topic"`
-			MQTTTopic     string `yaml:"mqtt_topic"`
-			MaxRetries    int    `yaml:"max_retries"`
-			RetryInterval time.Duration `yaml:"retry_interval"`
-		}{
+		DeadLetter: types.DeadLetterConfig{
 			Enabled:       true,
 			MaxRetries:    2,
 			RetryInterval: 50 * time.Millisecond,
@@ -0,0 +1,171 @@
+package unit
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"gom2k/internal/bridge"
+	"gom2k/pkg/types"
+)
+
+func TestDeadLetterRecordRoundTrip(t *testing.T) {
+	firstFailure := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	kafkaFailure := &types.FailedMessage{
+		MessageID: "01HN3Q2X4YB8M7T6VZK5R9C0DE",
+		OriginalMessage: &types.KafkaMessage{
+			ID:        "01HN3Q2X4YB8M7T6VZK5R9C0DE",
+			Topic:     "gom2k.cmd",
+			Partition: 3,
+			Offset:    1042,
+			Key:       "device1",
+			Value:     []byte{0x00, 0xff},
+			Headers:   []types.KafkaHeader{{Key: "source", Value: []byte("ops")}, {Key: "trace", Value: []byte{0x80}}},
+		},
+		FailureReason: "publish timeout",
+		AttemptCount:  3,
+		FirstFailure:  firstFailure,
+		LastAttempt:   firstFailure.Add(time.Minute),
+		ErrorClass:    bridge.ErrorTransient,
+		Direction:     "kafka-to-mqtt",
+		OriginalTopic: "gom2k.cmd",
+		TargetTopic:   "gom2k/from-kafka/cmd",
+	}
+
+	data, err := types.EncodeDeadLetterRecord(kafkaFailure, "bridge-1")
+	if err != nil {
+		t.Fatalf("Failed to encode dead letter record: %v", err)
+	}
+
+	// The original message is stored under its type, with the value encoding marked
+	var fields struct {
+		Version  int `json:"version"`
+		Original struct {
+			Type  string                 `json:"type"`
+			Kafka map[string]interface{} `json:"kafka"`
+		} `json:"original"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Failed to parse dead letter record: %v", err)
+	}
+	if fields.Version != types.DeadLetterSchemaVersion || fields.Original.Type != types.OriginalTypeKafka {
+		t.Errorf("Expected version %d of type kafka, got %+v", types.DeadLetterSchemaVersion, fields)
+	}
+	if fields.Original.Kafka["value_encoding"] != types.PayloadEncodingBase64 {
+		t.Errorf("Expected a base64 value for a binary record, got %v", fields.Original.Kafka)
+	}
+
+	record, err := bridge.DecodeDeadLetterRecord(&types.KafkaMessage{Value: data})
+	if err != nil {
+		t.Fatalf("Failed to decode dead letter record: %v", err)
+	}
+	if record.InstanceID != "bridge-1" || record.ErrorClass != bridge.ErrorTransient || record.AttemptCount != 3 {
+		t.Errorf("Record details not restored: %+v", record)
+	}
+
+	restored, err := record.FailedMessage()
+	if err != nil {
+		t.Fatalf("Failed to restore failed message: %v", err)
+	}
+	if !restored.LastAttempt.Equal(kafkaFailure.LastAttempt) || restored.TargetTopic != kafkaFailure.TargetTopic {
+		t.Errorf("Failure details not restored: %+v", restored)
+	}
+	kafkaMsg, ok := restored.OriginalMessage.(*types.KafkaMessage)
+	if !ok {
+		t.Fatalf("Expected a Kafka message, got %T", restored.OriginalMessage)
+	}
+	if kafkaMsg.ID != kafkaFailure.MessageID || kafkaMsg.Partition != 3 || kafkaMsg.Offset != 1042 || string(kafkaMsg.Value) != "\x00\xff" {
+		t.Errorf("Kafka message not restored: %+v", kafkaMsg)
+	}
+	if len(kafkaMsg.Headers) != 2 || string(kafkaMsg.Headers[1].Value) != "\x80" {
+		t.Errorf("Kafka headers not restored: %+v", kafkaMsg.Headers)
+	}
+
+	mqttFailure := &types.FailedMessage{
+		OriginalMessage: &types.MQTTMessage{Topic: "sensor/room1", Payload: []byte("23.5"), QoS: 1},
+		ErrorClass:      bridge.ErrorPermanent,
+		Direction:       "mqtt-to-kafka",
+		OriginalTopic:   "sensor/room1",
+	}
+	data, _ = types.EncodeDeadLetterRecord(mqttFailure, "bridge-1")
+	decoded, err := types.DecodeDeadLetterRecord(data)
+	if err != nil {
+		t.Fatalf("Failed to decode MQTT dead letter record: %v", err)
+	}
+	if decoded.Original.Type != types.OriginalTypeMQTT || decoded.Original.MQTT == nil || string(decoded.Original.MQTT.Payload) != "23.5" {
+		t.Errorf("MQTT message not restored: %+v", decoded.Original)
+	}
+}
+
+func TestDecodeDeadLetterRecordErrors(t *testing.T) {
+	invalid := map[string]string{
+		"newer version":    `{"version":99,"direction":"mqtt-to-kafka","original":{"type":"mqtt","mqtt":{"mqtt_topic":"a"}}}`,
+		"unknown type":     `{"version":1,"direction":"mqtt-to-kafka","original":{"type":"amqp"}}`,
+		"missing original": `{"version":1,"direction":"kafka-to-mqtt","original":{"type":"kafka"}}`,
+		"bad encoding":     `{"version":1,"direction":"kafka-to-mqtt","original":{"type":"kafka","kafka":{"value":"x","value_encoding":"hex"}}}`,
+	}
+	for name, data := range invalid {
+		if _, err := types.DecodeDeadLetterRecord([]byte(data)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	if _, err := types.EncodeDeadLetterRecord(&types.FailedMessage{OriginalMessage: "payload"}, ""); err == nil {
+		t.Error("Expected error for an unsupported original message type")
+	}
+}
+
+// baselineMQTTMessage and baselineFailedMessage have the layout of unversioned dead letter
+// records, which serialized MQTT payloads as base64 without payload_encoding
+type baselineMQTTMessage struct {
+	Topic     string    `json:"mqtt_topic"`
+	Payload   []byte    `json:"payload"`
+	QoS       byte      `json:"qos"`
+	Retained  bool      `json:"retained"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type baselineFailedMessage struct {
+	OriginalMessage interface{} `json:"original_message"`
+	FailureReason   string      `json:"failure_reason"`
+	AttemptCount    int         `json:"attempt_count"`
+	FirstFailure    time.Time   `json:"first_failure"`
+	LastAttempt     time.Time   `json:"last_attempt"`
+	Direction       string      `json:"direction"`
+	OriginalTopic   string      `json:"original_topic"`
+	TargetTopic     string      `json:"target_topic"`
+}
+
+func TestDecodeBaselineDeadLetterRecord(t *testing.T) {
+	data, err := json.Marshal(baselineFailedMessage{
+		OriginalMessage: baselineMQTTMessage{Topic: "sensor/room1", Payload: []byte("hello"), QoS: 1},
+		FailureReason:   "broker unavailable",
+		AttemptCount:    3,
+		Direction:       "mqtt-to-kafka",
+		OriginalTopic:   "sensor/room1",
+		TargetTopic:     "gom2k.sensor.room1",
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode baseline record: %v", err)
+	}
+	if !strings.Contains(string(data), `"payload":"aGVsbG8="`) {
+		t.Fatalf("Expected a base64 payload in the baseline record, got %s", data)
+	}
+
+	record, err := bridge.DecodeDeadLetterPayload(data, "")
+	if err != nil {
+		t.Fatalf("Failed to decode baseline record: %v", err)
+	}
+	failedMsg, err := record.FailedMessage()
+	if err != nil {
+		t.Fatalf("Failed to restore failed message: %v", err)
+	}
+	mqttMsg, ok := failedMsg.OriginalMessage.(*types.MQTTMessage)
+	if !ok {
+		t.Fatalf("Expected an MQTT message, got %T", failedMsg.OriginalMessage)
+	}
+	if string(mqttMsg.Payload) != "hello" || mqttMsg.QoS != 1 || failedMsg.AttemptCount != 3 {
+		t.Errorf("Baseline record not restored: %+v, payload %q", failedMsg, mqttMsg.Payload)
+	}
+}
@@ -0,0 +1,142 @@
+package unit
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"gom2k/internal/bridge"
+	"gom2k/internal/kafka"
+	"gom2k/pkg/types"
+)
+
+func TestDecodeLegacyDeadLetterRecord(t *testing.T) {
+	lastAttempt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	failed := []*types.FailedMessage{
+		{
+			MessageID:       "01HN3Q2X4YB8M7T6VZK5R9C0DE",
+			OriginalMessage: &types.MQTTMessage{ID: "01HN3Q2X4YB8M7T6VZK5R9C0DE", Topic: "sensor/room1", Payload: []byte{0x00, 0xff}, QoS: 1},
+			FailureReason:   "broker unavailable",
+			LastAttempt:     lastAttempt,
+			Direction:       "mqtt-to-kafka",
+			OriginalTopic:   "sensor/room1",
+			TargetTopic:     "gom2k.sensor.room1",
+		},
+		{
+			OriginalMessage: &types.KafkaMessage{Topic: "gom2k.cmd", Key: "device1", Value: []byte("on"), Headers: []types.KafkaHeader{{Key: "source", Value: []byte("ops")}}},
+			FailureReason:   "publish timeout",
+			LastAttempt:     lastAttempt,
+			Direction:       "kafka-to-mqtt",
+			OriginalTopic:   "gom2k.cmd",
+		},
+	}
+
+	for _, failedMsg := range failed {
+		value, err := json.Marshal(failedMsg)
+		if err != nil {
+			t.Fatalf("Failed to encode failed message: %v", err)
+		}
+		compressed, err := kafka.CompressPayload(value, "gzip")
+		if err != nil {
+			t.Fatalf("Failed to compress failed message: %v", err)
+		}
+		record := &types.KafkaMessage{Value: compressed, Headers: []types.KafkaHeader{{Key: kafka.HeaderContentEncoding, Value: []byte("gzip")}}}
+
+		dlqRecord, err := bridge.DecodeDeadLetterRecord(record)
+		if err != nil {
+			t.Fatalf("%s: failed to decode dead letter record: %v", failedMsg.Direction, err)
+		}
+		if dlqRecord.Version != 0 {
+			t.Errorf("%s: expected version 0 for an unversioned record, got %d", failedMsg.Direction, dlqRecord.Version)
+		}
+		decoded, err := dlqRecord.FailedMessage()
+		if err != nil {
+			t.Fatalf("%s: failed to restore failed message: %v", failedMsg.Direction, err)
+		}
+		if decoded.FailureReason != failedMsg.FailureReason || !decoded.LastAttempt.Equal(lastAttempt) || decoded.MessageID != failedMsg.MessageID {
+			t.Errorf("%s: failure details not restored: %+v", failedMsg.Direction, decoded)
+		}
+
+		switch original := decoded.OriginalMessage.(type) {
+		case *types.MQTTMessage:
+			if original.ID != failedMsg.MessageID || string(original.Payload) != "\x00\xff" || original.QoS != 1 {
+				t.Errorf("MQTT message not restored: %+v", original)
+			}
+		case *types.KafkaMessage:
+			if original.Key != "device1" || string(original.Value) != "on" || len(original.Headers) != 1 {
+				t.Errorf("Kafka message not restored: %+v", original)
+			}
+		default:
+			t.Errorf("%s: unexpected original message type %T", failedMsg.Direction, decoded.OriginalMessage)
+		}
+	}
+
+	if _, err := bridge.DecodeDeadLetterRecord(&types.KafkaMessage{Value: []byte(`{"direction":"sideways"}`)}); err == nil {
+		t.Error("Expected error for an unknown direction")
+	}
+}
+
+func TestReplayFilter(t *testing.T) {
+	failedMsg := &types.FailedMessage{
+		FailureReason: "failed to send message to Kafka topic gom2k.sensor.room1: Leader Not Available",
+		LastAttempt:   time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		Direction:     "mqtt-to-kafka",
+		OriginalTopic: "sensor/room1",
+		TargetTopic:   "gom2k.sensor.room1",
+	}
+
+	tests := []struct {
+		name    string
+		filter  bridge.ReplayFilter
+		matches bool
+	}{
+		{"no filter", bridge.ReplayFilter{}, true},
+		{"direction", bridge.ReplayFilter{Direction: "mqtt-to-kafka"}, true},
+		{"other direction", bridge.ReplayFilter{Direction: "kafka-to-mqtt"}, false},
+		{"original topic", bridge.ReplayFilter{Topic: regexp.MustCompile(`^sensor/.*$`)}, true},
+		{"target topic", bridge.ReplayFilter{Topic: regexp.MustCompile(`^gom2k\.sensor\..*$`)}, true},
+		{"other topic", bridge.ReplayFilter{Topic: regexp.MustCompile(`^alarm/.*$`)}, false},
+		{"within time range", bridge.ReplayFilter{Since: failedMsg.LastAttempt.Add(-time.Hour), Until: failedMsg.LastAttempt}, true},
+		{"before time range", bridge.ReplayFilter{Since: failedMsg.LastAttempt.Add(time.Second)}, false},
+		{"after time range", bridge.ReplayFilter{Until: failedMsg.LastAttempt.Add(-time.Second)}, false},
+		{"reason", bridge.ReplayFilter{Reason: "leader not available"}, true},
+		{"other reason", bridge.ReplayFilter{Reason: "authorization"}, false},
+	}
+
+	for _, test := range tests {
+		if matches := test.filter.Matches(failedMsg); matches != test.matches {
+			t.Errorf("%s: expected %v, got %v", test.name, test.matches, matches)
+		}
+	}
+}
+
+func TestReplayerPlan(t *testing.T) {
+	config := &types.BridgeConfig{
+		Mapping:        types.MappingConfig{KafkaPrefix: "gom2k", MaxTopicLevels: 3},
+		LoopPrevention: types.LoopPreventionConfig{Namespace: "gom2k/from-kafka"},
+	}
+	replayer, err := bridge.NewReplayer(config, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create replayer: %v", err)
+	}
+
+	toKafka := &types.FailedMessage{
+		OriginalMessage: &types.MQTTMessage{Topic: "sensor/room1", Payload: []byte("23.5"), Timestamp: time.Now()},
+		Direction:       "mqtt-to-kafka",
+	}
+	if target, err := replayer.Plan(toKafka); err != nil || target != "gom2k.sensor.room1" {
+		t.Errorf("Expected MQTT message replayed to gom2k.sensor.room1, got %q (%v)", target, err)
+	}
+
+	record, _ := kafka.ConvertMQTTMessage(&types.MQTTMessage{Topic: "cmd/device1", Payload: []byte("on"), Timestamp: time.Now()}, "gom2k.cmd.device1")
+	toMQTT := &types.FailedMessage{OriginalMessage: record, Direction: "kafka-to-mqtt"}
+	if target, err := replayer.Plan(toMQTT); err != nil || target != "gom2k/from-kafka/cmd/device1" {
+		t.Errorf("Expected record replayed to the bridge namespace, got %q (%v)", target, err)
+	}
+
+	invalid := &types.FailedMessage{OriginalMessage: &types.KafkaMessage{Topic: "gom2k.cmd", Value: []byte("not an envelope")}, Direction: "kafka-to-mqtt"}
+	if _, err := replayer.Plan(invalid); err == nil {
+		t.Error("Expected error for a record that can't be converted")
+	}
+}
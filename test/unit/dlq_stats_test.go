@@ -0,0 +1,119 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"gom2k/internal/bridge"
+	"gom2k/internal/kafka"
+	"gom2k/pkg/types"
+)
+
+func TestDeadLetterStatsGrouping(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	records := []*types.DeadLetterRecord{
+		{Direction: "mqtt-to-kafka", OriginalTopic: "sensor/room1", FailureReason: "leader not available", ErrorClass: bridge.ErrorTransient, LastAttempt: base.Add(5 * time.Minute)},
+		{Direction: "mqtt-to-kafka", OriginalTopic: "sensor/room1", FailureReason: "leader not available", ErrorClass: bridge.ErrorTransient, LastAttempt: base.Add(50 * time.Minute)},
+		{Direction: "mqtt-to-kafka", OriginalTopic: "sensor/room2", FailureReason: "leader not available", ErrorClass: bridge.ErrorTransient, LastAttempt: base.Add(70 * time.Minute)},
+		{Direction: "kafka-to-mqtt", OriginalTopic: "gom2k.cmd", FailureReason: "invalid envelope", ErrorClass: bridge.ErrorPermanent, LastAttempt: base.Add(80 * time.Minute)},
+	}
+
+	stats, err := bridge.NewDeadLetterStats([]string{bridge.GroupByDirection, bridge.GroupByTopic}, 0)
+	if err != nil {
+		t.Fatalf("Failed to create stats: %v", err)
+	}
+	for _, record := range records {
+		stats.Add(record)
+	}
+	groups := stats.Groups()
+	if stats.Total() != 4 || len(groups) != 3 {
+		t.Fatalf("Expected 4 records in 3 groups, got %d in %+v", stats.Total(), groups)
+	}
+	first := groups[0]
+	if first.Topic != "sensor/room1" || first.Count != 2 || first.Reason != "" || first.Bucket != nil {
+		t.Errorf("Expected the largest group first with only the grouped dimensions set, got %+v", first)
+	}
+	if !first.First.Equal(records[0].LastAttempt) || !first.Last.Equal(records[1].LastAttempt) {
+		t.Errorf("Expected the group to span %v to %v, got %v to %v", records[0].LastAttempt, records[1].LastAttempt, first.First, first.Last)
+	}
+
+	stats, _ = bridge.NewDeadLetterStats([]string{bridge.GroupByTime, bridge.GroupByClass}, time.Hour)
+	for _, record := range records {
+		stats.Add(record)
+	}
+	groups = stats.Groups()
+	if len(groups) != 3 {
+		t.Fatalf("Expected 3 groups, got %+v", groups)
+	}
+	if !groups[0].Bucket.Equal(base) || groups[0].Count != 2 || groups[0].Class != bridge.ErrorTransient {
+		t.Errorf("Expected the first hour's transient failures first, got %+v", groups[0])
+	}
+	for _, group := range groups[1:] {
+		if !group.Bucket.Equal(base.Add(time.Hour)) || group.Count != 1 {
+			t.Errorf("Expected one failure of each class in the second hour, got %+v", group)
+		}
+	}
+
+	if _, err := bridge.NewDeadLetterStats([]string{"partition"}, time.Hour); err == nil {
+		t.Error("Expected error for an unknown dimension")
+	}
+	if _, err := bridge.NewDeadLetterStats([]string{bridge.GroupByTime}, 0); err == nil {
+		t.Error("Expected error for time buckets without a size")
+	}
+}
+
+func TestDecodeDeadLetterPayload(t *testing.T) {
+	failedMsg := &types.FailedMessage{
+		OriginalMessage: &types.MQTTMessage{Topic: "sensor/room1", Payload: []byte("23.5")},
+		FailureReason:   "broker unavailable",
+		Direction:       "mqtt-to-kafka",
+		OriginalTopic:   "sensor/room1",
+	}
+	data, err := types.EncodeDeadLetterRecord(failedMsg, "bridge-1")
+	if err != nil {
+		t.Fatalf("Failed to encode dead letter record: %v", err)
+	}
+	compressed, err := kafka.CompressPayload(data, "snappy")
+	if err != nil {
+		t.Fatalf("Failed to compress dead letter record: %v", err)
+	}
+
+	record, err := bridge.DecodeDeadLetterPayload(compressed, "snappy")
+	if err != nil {
+		t.Fatalf("Failed to decode compressed dead letter record: %v", err)
+	}
+	if record.InstanceID != "bridge-1" || record.OriginalTopic != "sensor/room1" {
+		t.Errorf("Record not restored: %+v", record)
+	}
+	if _, err := bridge.DecodeDeadLetterPayload(compressed, "none"); err == nil {
+		t.Error("Expected error for a compressed record read without its codec")
+	}
+}
+
+func TestDeadLetterStatsGroupsSameFailure(t *testing.T) {
+	stats, err := bridge.NewDeadLetterStats([]string{bridge.GroupByReason}, 0)
+	if err != nil {
+		t.Fatalf("Failed to create stats: %v", err)
+	}
+
+	// Message IDs are kept in the record, not in the failure reason
+	for _, id := range []string{"01HQ3Z6J8K9M2N4P6R8T0V2X4Y", "01HQ3Z6J8K9M2N4P6R8T0V2X4Z"} {
+		failedMsg := &types.FailedMessage{
+			MessageID:       id,
+			OriginalMessage: &types.MQTTMessage{ID: id, Topic: "sensor/room1", Payload: []byte("23.5")},
+			FailureReason:   "failed to send message to Kafka topic gom2k.sensor.room1: leader not available",
+			Direction:       "mqtt-to-kafka",
+			OriginalTopic:   "sensor/room1",
+		}
+		record, err := types.NewDeadLetterRecord(failedMsg, "bridge-1")
+		if err != nil {
+			t.Fatalf("Failed to create dead letter record: %v", err)
+		}
+		stats.Add(record)
+	}
+
+	groups := stats.Groups()
+	if len(groups) != 1 || groups[0].Count != 2 {
+		t.Fatalf("Expected both failures in one group, got %+v", groups)
+	}
+}
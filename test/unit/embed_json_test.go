@@ -0,0 +1,83 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gom2k/internal/kafka"
+	"gom2k/pkg/types"
+)
+
+func TestEmbedJSONPayload(t *testing.T) {
+	envelope := &types.EnvelopeConfig{Mode: kafka.EnvelopeJSON, EmbedJSON: true}
+
+	tests := []struct {
+		name         string
+		payload      string
+		expectedType string
+	}{
+		{"object", `{"temperature": 23.5, "unit": "C"}`, kafka.PayloadTypeJSON},
+		{"pretty printed object", "{\n  \"on\": true\n}", kafka.PayloadTypeJSON},
+		{"array", `[1,2,3]`, kafka.PayloadTypeJSON},
+		{"number", `23.5`, kafka.PayloadTypeJSON},
+		{"html characters", `{"expr": "a < b && c > d"}`, kafka.PayloadTypeJSON},
+		{"plain text", `ON`, kafka.PayloadTypeString},
+		{"truncated JSON", `{"temperature": 23.5`, kafka.PayloadTypeString},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mqttMsg := &types.MQTTMessage{Topic: "sensor/room1", Payload: []byte(tt.payload), Timestamp: time.Now()}
+
+			kafkaMsg, err := kafka.ConvertMQTTMessageWithEnvelope(mqttMsg, "gom2k.sensor.room1", envelope)
+			if err != nil {
+				t.Fatalf("Failed to convert MQTT message: %v", err)
+			}
+
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(kafkaMsg.Value, &fields); err != nil {
+				t.Fatalf("Envelope is not valid JSON: %v\n%s", err, kafkaMsg.Value)
+			}
+			if string(fields["payload_type"]) != `"`+tt.expectedType+`"` {
+				t.Errorf("Expected payload_type %q, got %s", tt.expectedType, fields["payload_type"])
+			}
+			if tt.expectedType == kafka.PayloadTypeJSON && fields["payload"][0] == '"' && tt.payload[0] != '"' {
+				t.Errorf("Expected payload to be embedded, got %s", fields["payload"])
+			}
+
+			restored, err := kafka.ConvertKafkaMessage(kafkaMsg)
+			if err != nil {
+				t.Fatalf("Failed to convert Kafka message: %v", err)
+			}
+			if !bytes.Equal(restored.Payload, []byte(tt.payload)) {
+				t.Errorf("Expected payload %q byte-for-byte, got %q", tt.payload, restored.Payload)
+			}
+		})
+	}
+}
+
+func TestEmbedJSONDisabledByDefault(t *testing.T) {
+	mqttMsg := &types.MQTTMessage{Topic: "sensor/room1", Payload: []byte(`{"on":true}`), Timestamp: time.Now()}
+
+	kafkaMsg, err := kafka.ConvertMQTTMessage(mqttMsg, "gom2k.sensor.room1")
+	if err != nil {
+		t.Fatalf("Failed to convert MQTT message: %v", err)
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(kafkaMsg.Value, &payload); err != nil {
+		t.Fatalf("Failed to parse JSON payload: %v", err)
+	}
+	if payload["payload"] != `{"on":true}` || payload["payload_type"] != kafka.PayloadTypeString {
+		t.Errorf("Expected string payload, got %v (%v)", payload["payload"], payload["payload_type"])
+	}
+}
+
+func TestUnknownPayloadType(t *testing.T) {
+	kafkaMsg := &types.KafkaMessage{Value: []byte(`{"payload":"ON","payload_type":"xml","mqtt_topic":"a/b"}`)}
+	if _, err := kafka.ConvertKafkaMessage(kafkaMsg); err == nil {
+		t.Error("Expected error for unknown payload_type")
+	}
+}
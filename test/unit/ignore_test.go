@@ -0,0 +1,132 @@
+package unit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gom2k/internal/bridge"
+	"gom2k/internal/config"
+	"gom2k/internal/mqtt"
+)
+
+func TestTopicFilterMatching(t *testing.T) {
+	tests := []struct {
+		filter  string
+		topic   string
+		matches bool
+	}{
+		{"sensor/room1", "sensor/room1", true},
+		{"sensor/room1", "sensor/room2", false},
+		{"sensor/+/temp", "sensor/room1/temp", true},
+		{"sensor/+/temp", "sensor/room1/humidity", false},
+		{"sensor/+", "sensor/room1/temp", false},
+		{"sensor/#", "sensor/room1/temp", true},
+		{"sensor/#", "sensor", true},
+		{"sensor/#", "sensors/room1", false},
+		{"#", "sensor/room1", true},
+		{"+/+", "sensor/", true},
+		{"#", "$SYS/broker/uptime", false},
+		{"+/broker/uptime", "$SYS/broker/uptime", false},
+		{"$SYS/#", "$SYS/broker/uptime", true},
+	}
+
+	for _, test := range tests {
+		if matches := mqtt.TopicMatches(test.filter, test.topic); matches != test.matches {
+			t.Errorf("TopicMatches(%q, %q) = %v, expected %v", test.filter, test.topic, matches, test.matches)
+		}
+	}
+}
+
+func TestTopicFilterValidation(t *testing.T) {
+	for _, filter := range []string{"#", "+", "sensor/+/temp", "sensor/#", "$SYS/#"} {
+		if err := mqtt.ValidateTopicFilter(filter); err != nil {
+			t.Errorf("Expected %q to be valid: %v", filter, err)
+		}
+	}
+	for _, filter := range []string{"", "sensor/#/temp", "sensor+/temp", "sensor/room#"} {
+		if err := mqtt.ValidateTopicFilter(filter); err == nil {
+			t.Errorf("Expected %q to be invalid", filter)
+		}
+	}
+}
+
+func TestIgnoreListAndSkipCounts(t *testing.T) {
+	ignore, err := mqtt.NewIgnoreList([]string{"$SYS/#", "debug/+/trace"})
+	if err != nil {
+		t.Fatalf("Failed to create ignore list: %v", err)
+	}
+
+	skips := bridge.NewSkipCounter()
+	for _, topic := range []string{"$SYS/broker/load", "debug/room1/trace", "debug/room2/trace", "sensor/room1"} {
+		if filter, ignored := ignore.Match(topic); ignored {
+			skips.Count(bridge.SkipIgnored, "matches ignore filter "+filter, topic)
+		}
+	}
+	skips.Count(bridge.SkipLoop, "published by the bridge", "sensor/room1")
+
+	counts := skips.Counts()
+	if counts[bridge.SkipIgnored] != 3 || counts[bridge.SkipLoop] != 1 {
+		t.Errorf("Unexpected skip counts: %v", counts)
+	}
+
+	if _, err := mqtt.NewIgnoreList([]string{"sensor/#/temp"}); err == nil {
+		t.Error("Expected error for an invalid filter")
+	}
+}
+
+func TestIgnoreConfigLoading(t *testing.T) {
+	configYAML := `
+mqtt:
+  broker:
+    host: "localhost"
+    port: 1883
+kafka:
+  brokers: ["localhost:9092"]
+bridge:
+  features:
+    mqtt_to_kafka: true
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	// Kafka→MQTT ignores broker and bridge topics by default
+	loaded, err := config.LoadForTesting(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(loaded.Bridge.Ignore.MQTTToKafka) != 0 {
+		t.Errorf("Expected no MQTT→Kafka filters by default, got %v", loaded.Bridge.Ignore.MQTTToKafka)
+	}
+	if len(loaded.Bridge.Ignore.KafkaToMQTT) != 2 || loaded.Bridge.Ignore.KafkaToMQTT[0] != "$SYS/#" || loaded.Bridge.Ignore.KafkaToMQTT[1] != "gom2k/#" {
+		t.Errorf("Expected default Kafka→MQTT filters, got %v", loaded.Bridge.Ignore.KafkaToMQTT)
+	}
+
+	// An empty list turns the defaults off
+	ignoreYAML := configYAML + `  ignore:
+    mqtt_to_kafka: ["debug/#", "+/raw"]
+    kafka_to_mqtt: []
+`
+	if err := os.WriteFile(configPath, []byte(ignoreYAML), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	loaded, err = config.LoadForTesting(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(loaded.Bridge.Ignore.MQTTToKafka) != 2 || loaded.Bridge.Ignore.MQTTToKafka[1] != "+/raw" {
+		t.Errorf("MQTT→Kafka filters not loaded correctly: %v", loaded.Bridge.Ignore.MQTTToKafka)
+	}
+	if len(loaded.Bridge.Ignore.KafkaToMQTT) != 0 {
+		t.Errorf("Expected Kafka→MQTT defaults to be turned off, got %v", loaded.Bridge.Ignore.KafkaToMQTT)
+	}
+
+	if err := os.WriteFile(configPath, []byte(configYAML+"  ignore:\n    mqtt_to_kafka: [\"debug/#/trace\"]\n"), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	if _, err := config.LoadForTesting(configPath); err == nil {
+		t.Error("Expected error for an invalid ignore filter")
+	}
+}
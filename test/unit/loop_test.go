@@ -0,0 +1,149 @@
+package unit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gom2k/internal/bridge"
+	"gom2k/internal/config"
+	"gom2k/pkg/types"
+)
+
+func TestLoopDetectorFingerprints(t *testing.T) {
+	loops := bridge.NewLoopDetector(&types.LoopPreventionConfig{}, true)
+	payload := []byte(`{"temp":23.5}`)
+
+	// A message published from Kafka comes back once through the MQTT subscription
+	loops.Published("sensor/room1", payload)
+	if !loops.IsEcho("sensor/room1", payload) {
+		t.Error("Expected published message to be recognized as echo")
+	}
+	if loops.IsEcho("sensor/room1", payload) {
+		t.Error("Expected each publication to match a single received message")
+	}
+	if loops.IsEcho("sensor/room2", payload) || loops.IsEcho("sensor/room1", []byte(`{"temp":23.6}`)) {
+		t.Error("Expected other topics and payloads not to match")
+	}
+
+	// A message forwarded to Kafka isn't published back to its own topic
+	loops.Forwarded("sensor/room1", payload)
+	loops.Forwarded("sensor/room1", payload)
+	if !loops.IsReturning("sensor/room1", payload) || !loops.IsReturning("sensor/room1", payload) {
+		t.Error("Expected both forwarded messages to be recognized as returning")
+	}
+	if loops.IsReturning("sensor/room1", payload) {
+		t.Error("Expected no more returning messages")
+	}
+
+	// Reverse rules publishing to another topic aren't affected
+	loops.Forwarded("sensor/room1", payload)
+	if loops.IsReturning("actuator/room1", payload) {
+		t.Error("Expected message for another topic to be published")
+	}
+}
+
+func TestLoopDetectorFingerprintsExpire(t *testing.T) {
+	loops := bridge.NewLoopDetector(&types.LoopPreventionConfig{FingerprintTTL: 20 * time.Millisecond}, true)
+
+	loops.Published("sensor/room1", []byte("23.5"))
+	time.Sleep(40 * time.Millisecond)
+	if loops.IsEcho("sensor/room1", []byte("23.5")) {
+		t.Error("Expected fingerprint to expire")
+	}
+}
+
+func TestLoopDetectorFingerprintLimit(t *testing.T) {
+	loops := bridge.NewLoopDetector(&types.LoopPreventionConfig{MaxFingerprints: 2}, true)
+
+	// Messages that never come back don't pile up, the oldest is forgotten first
+	loops.Published("sensor/room1", []byte("1"))
+	loops.Published("sensor/room2", []byte("2"))
+	loops.Published("sensor/room1", []byte("1"))
+	loops.Published("sensor/room3", []byte("3"))
+	if loops.IsEcho("sensor/room2", []byte("2")) {
+		t.Error("Expected the oldest fingerprint to be evicted")
+	}
+	if !loops.IsEcho("sensor/room1", []byte("1")) || !loops.IsEcho("sensor/room1", []byte("1")) || !loops.IsEcho("sensor/room3", []byte("3")) {
+		t.Error("Expected the recent fingerprints to be kept")
+	}
+}
+
+func TestLoopDetectorWithoutFingerprints(t *testing.T) {
+	for name, loops := range map[string]*bridge.LoopDetector{
+		"single direction": bridge.NewLoopDetector(&types.LoopPreventionConfig{}, false),
+		"disabled":         bridge.NewLoopDetector(&types.LoopPreventionConfig{DisableFingerprints: true}, true),
+	} {
+		t.Run(name, func(t *testing.T) {
+			loops.Published("sensor/room1", []byte("23.5"))
+			loops.Forwarded("sensor/room1", []byte("23.5"))
+			if loops.IsEcho("sensor/room1", []byte("23.5")) || loops.IsReturning("sensor/room1", []byte("23.5")) {
+				t.Error("Expected fingerprints not to be tracked")
+			}
+		})
+	}
+}
+
+func TestLoopDetectorNamespace(t *testing.T) {
+	loops := bridge.NewLoopDetector(&types.LoopPreventionConfig{Namespace: "from-kafka/"}, false)
+
+	if topic := loops.PublishTopic("sensor/room1"); topic != "from-kafka/sensor/room1" {
+		t.Errorf("Expected namespaced topic, got %s", topic)
+	}
+	if !loops.IsEcho("from-kafka/sensor/room1", nil) {
+		t.Error("Expected namespaced topic to be skipped")
+	}
+	if loops.IsEcho("from-kafka-other/sensor/room1", nil) || loops.IsEcho("sensor/room1", nil) {
+		t.Error("Expected topics outside the namespace to be forwarded")
+	}
+
+	// Without a namespace topics are published unchanged
+	loops = bridge.NewLoopDetector(&types.LoopPreventionConfig{}, false)
+	if topic := loops.PublishTopic("sensor/room1"); topic != "sensor/room1" {
+		t.Errorf("Expected unchanged topic, got %s", topic)
+	}
+}
+
+func TestLoopPreventionConfigLoading(t *testing.T) {
+	configYAML := `
+mqtt:
+  broker:
+    host: "localhost"
+    port: 1883
+kafka:
+  brokers: ["localhost:9092"]
+bridge:
+  features:
+    mqtt_to_kafka: true
+    kafka_to_mqtt: true
+  loop_prevention:
+    namespace: "from-kafka"
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	loaded, err := config.LoadForTesting(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if loaded.Bridge.LoopPrevention.Namespace != "from-kafka" || loaded.Bridge.LoopPrevention.FingerprintTTL != time.Minute {
+		t.Errorf("Loop prevention not loaded correctly: %+v", loaded.Bridge.LoopPrevention)
+	}
+
+	if err := os.WriteFile(configPath, []byte(configYAML+"    disable_fingerprints: true\n"), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	if loaded, err = config.LoadForTesting(configPath); err != nil || !loaded.Bridge.LoopPrevention.DisableFingerprints {
+		t.Errorf("Expected fingerprints to be disabled, got %v", err)
+	}
+
+	if err := os.WriteFile(configPath, []byte(configYAML[:len(configYAML)-len("\"from-kafka\"\n")]+"\"from-kafka/#\"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	if _, err := config.LoadForTesting(configPath); err == nil {
+		t.Error("Expected error for a namespace with wildcards")
+	}
+}
@@ -0,0 +1,101 @@
+package unit
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gom2k/internal/bridge"
+	"gom2k/internal/kafka"
+	"gom2k/internal/msgid"
+	"gom2k/pkg/types"
+)
+
+func TestMessageIDsAreOrderedAndUnique(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	seen := make(map[string]bool)
+	previous := ""
+	for i := 0; i < 10000; i++ {
+		// All IDs share one millisecond, so only the random part tells them apart
+		id := msgid.NewAt(now)
+		if len(id) != msgid.Length {
+			t.Fatalf("Expected %d characters, got %q", msgid.Length, id)
+		}
+		if seen[id] {
+			t.Fatalf("Duplicate ID %s after %d IDs", id, i)
+		}
+		if id <= previous {
+			t.Fatalf("IDs not ordered: %s after %s", id, previous)
+		}
+		seen[id] = true
+		previous = id
+	}
+
+	if later := msgid.NewAt(now.Add(time.Millisecond)); later <= previous {
+		t.Errorf("ID of a later time sorts before earlier IDs: %s <= %s", later, previous)
+	}
+
+	parsed, err := msgid.Time(previous)
+	if err != nil || !parsed.Equal(now) {
+		t.Errorf("Expected time %v, got %v (%v)", now, parsed, err)
+	}
+	for _, invalid := range []string{"", "01HKZ3", "81HKZ3N0000000000000000000", "01HKZ3N000000000000000000U"} {
+		if _, err := msgid.Time(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestMessageIDInEnvelopes(t *testing.T) {
+	id := msgid.New()
+	mqttMsg := &types.MQTTMessage{ID: id, Topic: "sensor/room1", Payload: []byte("23.5"), Timestamp: time.Now()}
+
+	for _, envelope := range []*types.EnvelopeConfig{
+		{Mode: kafka.EnvelopeJSON},
+		{Mode: kafka.EnvelopeRaw},
+		cloudEventsEnvelope(kafka.CloudEventsStructured),
+		cloudEventsEnvelope(kafka.CloudEventsBinary),
+	} {
+		kafkaMsg, err := kafka.ConvertMQTTMessageWithEnvelope(mqttMsg, "gom2k.sensor.room1", envelope)
+		if err != nil {
+			t.Fatalf("%s: failed to convert MQTT message: %v", envelope.Mode, err)
+		}
+		if header, _ := kafkaMsg.Header(kafka.HeaderMessageID); header != id {
+			t.Errorf("%s: expected message ID header %s, got %q", envelope.Mode, id, header)
+		}
+	}
+
+	kafkaMsg, _ := kafka.ConvertMQTTMessage(mqttMsg, "gom2k.sensor.room1")
+	var fields map[string]interface{}
+	if err := json.Unmarshal(kafkaMsg.Value, &fields); err != nil {
+		t.Fatalf("Failed to parse envelope: %v", err)
+	}
+	if fields["message_id"] != id {
+		t.Errorf("Expected message_id %s in the JSON envelope, got %v", id, fields["message_id"])
+	}
+
+	event, _ := kafka.ConvertMQTTMessageWithEnvelope(mqttMsg, "gom2k.sensor.room1", cloudEventsEnvelope(kafka.CloudEventsBinary))
+	if eventID, _ := event.Header("ce_id"); eventID != id {
+		t.Errorf("Expected the message ID as CloudEvent id, got %q", eventID)
+	}
+}
+
+func TestDeadLetterQueueTracksMessagesByID(t *testing.T) {
+	config := &types.BridgeConfig{
+		DeadLetter: types.DeadLetterConfig{Enabled: true, MaxRetries: 5, RetryInterval: time.Hour},
+	}
+	dlq := bridge.NewDeadLetterQueue(config, nil, nil)
+
+	// Messages on the same topic within the same second are still told apart
+	timestamp := time.Now()
+	first := &types.MQTTMessage{ID: msgid.New(), Topic: "sensor/room1", Payload: []byte("23.5"), Timestamp: timestamp}
+	second := &types.MQTTMessage{ID: msgid.New(), Topic: "sensor/room1", Payload: []byte("23.6"), Timestamp: timestamp}
+	for _, msg := range []*types.MQTTMessage{first, second, first} {
+		dlq.HandleFailedMessage(msg, "broker unavailable", "mqtt-to-kafka", msg.Topic, "gom2k.sensor.room1")
+	}
+
+	if count := dlq.GetFailedMessageCount(); count != 2 {
+		t.Errorf("Expected 2 tracked messages, got %d", count)
+	}
+}
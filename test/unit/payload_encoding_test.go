@@ -0,0 +1,135 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gom2k/internal/kafka"
+	"gom2k/pkg/types"
+)
+
+func TestPayloadEncodingRoundTrip(t *testing.T) {
+	tests := []struct {
+		name             string
+		payload          []byte
+		encodingConfig   string
+		expectedEncoding string
+	}{
+		{"text payload", []byte("23.5"), types.PayloadEncodingAuto, types.PayloadEncodingUTF8},
+		{"unicode text payload", []byte("température 23°C"), types.PayloadEncodingAuto, types.PayloadEncodingUTF8},
+		{"binary payload", []byte{0x08, 0x96, 0x01, 0xff, 0xfe, 0x00}, types.PayloadEncodingAuto, types.PayloadEncodingBase64},
+		{"forced base64", []byte("23.5"), types.PayloadEncodingBase64, types.PayloadEncodingBase64},
+		{"empty payload", []byte{}, types.PayloadEncodingAuto, types.PayloadEncodingUTF8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mqttMsg := &types.MQTTMessage{
+				Topic:     "sensor/room1/temp",
+				Payload:   tt.payload,
+				QoS:       1,
+				Timestamp: time.Now(),
+			}
+
+			envelope := &types.EnvelopeConfig{Mode: kafka.EnvelopeJSON, PayloadEncoding: tt.encodingConfig}
+			kafkaMsg, err := kafka.ConvertMQTTMessageWithEnvelope(mqttMsg, "gom2k.sensor.room1", envelope)
+			if err != nil {
+				t.Fatalf("Failed to convert MQTT message: %v", err)
+			}
+
+			var payload map[string]interface{}
+			if err := json.Unmarshal(kafkaMsg.Value, &payload); err != nil {
+				t.Fatalf("Failed to parse JSON payload: %v", err)
+			}
+			if payload["payload_encoding"] != tt.expectedEncoding {
+				t.Errorf("Expected payload_encoding %q, got %v", tt.expectedEncoding, payload["payload_encoding"])
+			}
+
+			restored, err := kafka.ConvertKafkaMessage(kafkaMsg)
+			if err != nil {
+				t.Fatalf("Failed to convert Kafka message: %v", err)
+			}
+			if !bytes.Equal(restored.Payload, tt.payload) {
+				t.Errorf("Payload not preserved: expected %v, got %v", tt.payload, restored.Payload)
+			}
+		})
+	}
+}
+
+func TestPayloadEncodingLegacyAndInvalid(t *testing.T) {
+	// Records written before payload_encoding existed carry plain text
+	legacy := &types.KafkaMessage{Value: []byte(`{"payload":"ON","mqtt_topic":"a/b"}`)}
+	mqttMsg, err := kafka.ConvertKafkaMessage(legacy)
+	if err != nil {
+		t.Fatalf("Failed to convert legacy message: %v", err)
+	}
+	if string(mqttMsg.Payload) != "ON" {
+		t.Errorf("Expected payload 'ON', got %q", string(mqttMsg.Payload))
+	}
+
+	invalid := []string{
+		`{"payload":"not base64!","payload_encoding":"base64","mqtt_topic":"a/b"}`,
+		`{"payload":"ON","payload_encoding":"hex","mqtt_topic":"a/b"}`,
+	}
+	for _, value := range invalid {
+		if _, err := kafka.ConvertKafkaMessage(&types.KafkaMessage{Value: []byte(value)}); err == nil {
+			t.Errorf("Expected error for %s", value)
+		}
+	}
+}
+
+func TestFailedMessageBinaryPayloadSerialization(t *testing.T) {
+	binaryPayload := []byte{0x00, 0xc3, 0x28, 0xff}
+	failedMsg := &types.FailedMessage{
+		OriginalMessage: &types.MQTTMessage{Topic: "a/b", Payload: binaryPayload, Timestamp: time.Now()},
+		Direction:       "mqtt-to-kafka",
+	}
+
+	data, err := json.Marshal(failedMsg)
+	if err != nil {
+		t.Fatalf("Failed to serialize failed message: %v", err)
+	}
+	if !contains(string(data), `"payload_encoding":"base64"`) {
+		t.Errorf("Expected base64 payload encoding in %s", data)
+	}
+
+	var decoded struct {
+		OriginalMessage types.MQTTMessage `json:"original_message"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to deserialize failed message: %v", err)
+	}
+	if !bytes.Equal(decoded.OriginalMessage.Payload, binaryPayload) {
+		t.Errorf("Payload not preserved: expected %v, got %v", binaryPayload, decoded.OriginalMessage.Payload)
+	}
+
+	// Text payloads stay readable
+	data, err = json.Marshal(&types.MQTTMessage{Topic: "a/b", Payload: []byte("ON")})
+	if err != nil {
+		t.Fatalf("Failed to serialize message: %v", err)
+	}
+	if !contains(string(data), `"payload":"ON"`) {
+		t.Errorf("Expected readable text payload in %s", data)
+	}
+}
+
+func TestPayloadEncodingDefaults(t *testing.T) {
+	// Without payload_encoding, envelopes hold text and serialized MQTT messages base64,
+	// as they were written before
+	document := `{"mqtt_topic":"a/b","payload":"T04="}`
+
+	fromEnvelope, err := kafka.ConvertKafkaMessage(&types.KafkaMessage{Value: []byte(document)})
+	if err != nil {
+		t.Fatalf("Failed to convert envelope: %v", err)
+	}
+	var fromJSON types.MQTTMessage
+	if err := json.Unmarshal([]byte(document), &fromJSON); err != nil {
+		t.Fatalf("Failed to decode MQTT message: %v", err)
+	}
+
+	if string(fromEnvelope.Payload) != "T04=" || string(fromJSON.Payload) != "ON" {
+		t.Errorf("Expected payloads 'T04=' and 'ON', got %q and %q", fromEnvelope.Payload, fromJSON.Payload)
+	}
+}
@@ -0,0 +1,116 @@
+package unit
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gom2k/internal/kafka"
+	"gom2k/pkg/types"
+)
+
+func TestRawEnvelopeConversion(t *testing.T) {
+	timestamp := time.Date(2024, 1, 1, 12, 0, 0, 123456789, time.UTC)
+	payload := []byte{0x08, 0x96, 0x01, 0xff, 0x00} // Binary device payload
+
+	mqttMsg := &types.MQTTMessage{
+		Topic:     "sensor/room1/temp",
+		Payload:   payload,
+		QoS:       1,
+		Retained:  true,
+		Timestamp: timestamp,
+	}
+
+	kafkaMsg, err := kafka.ConvertMQTTMessageWithEnvelope(mqttMsg, "gom2k.sensor.room1.temp", &types.EnvelopeConfig{Mode: kafka.EnvelopeRaw})
+	if err != nil {
+		t.Fatalf("Failed to convert MQTT message: %v", err)
+	}
+
+	if !bytes.Equal(kafkaMsg.Value, payload) {
+		t.Errorf("Expected value to be the payload byte-for-byte, got %v", kafkaMsg.Value)
+	}
+	if kafkaMsg.Key != mqttMsg.Topic {
+		t.Errorf("Expected key %q, got %q", mqttMsg.Topic, kafkaMsg.Key)
+	}
+
+	expectedHeaders := map[string]string{
+		kafka.HeaderEnvelope:  "raw",
+		kafka.HeaderMQTTTopic: "sensor/room1/temp",
+		kafka.HeaderQoS:       "1",
+		kafka.HeaderRetained:  "true",
+		kafka.HeaderTimestamp: "2024-01-01T12:00:00.123456789Z",
+	}
+	for key, expected := range expectedHeaders {
+		if value, ok := kafkaMsg.Header(key); !ok || value != expected {
+			t.Errorf("Expected header %s=%q, got %q (present: %v)", key, expected, value, ok)
+		}
+	}
+
+	// Round trip back to MQTT
+	restored, err := kafka.ConvertKafkaMessage(kafkaMsg)
+	if err != nil {
+		t.Fatalf("Failed to convert raw Kafka message: %v", err)
+	}
+	if restored.Topic != mqttMsg.Topic || !bytes.Equal(restored.Payload, payload) {
+		t.Errorf("Round trip mismatch: got topic %q payload %v", restored.Topic, restored.Payload)
+	}
+	if restored.QoS != 1 || !restored.Retained || !restored.Timestamp.Equal(timestamp) {
+		t.Errorf("Round trip metadata mismatch: %+v", restored)
+	}
+}
+
+func TestRawEnvelopeInvalidHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []types.KafkaHeader
+	}{
+		{
+			name:    "missing MQTT topic",
+			headers: []types.KafkaHeader{{Key: kafka.HeaderEnvelope, Value: []byte("raw")}},
+		},
+		{
+			name: "invalid QoS",
+			headers: []types.KafkaHeader{
+				{Key: kafka.HeaderEnvelope, Value: []byte("raw")},
+				{Key: kafka.HeaderMQTTTopic, Value: []byte("a/b")},
+				{Key: kafka.HeaderQoS, Value: []byte("3")},
+			},
+		},
+		{
+			name: "invalid retain flag",
+			headers: []types.KafkaHeader{
+				{Key: kafka.HeaderEnvelope, Value: []byte("raw")},
+				{Key: kafka.HeaderMQTTTopic, Value: []byte("a/b")},
+				{Key: kafka.HeaderRetained, Value: []byte("maybe")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kafkaMsg := &types.KafkaMessage{Topic: "gom2k.a.b", Value: []byte("ON"), Headers: tt.headers}
+			if _, err := kafka.ConvertKafkaMessage(kafkaMsg); err == nil {
+				t.Error("Expected error for invalid raw headers")
+			}
+		})
+	}
+}
+
+func TestDefaultEnvelopeIsJSON(t *testing.T) {
+	mqttMsg := &types.MQTTMessage{Topic: "a/b", Payload: []byte("ON"), Timestamp: time.Now()}
+
+	kafkaMsg, err := kafka.ConvertMQTTMessageWithEnvelope(mqttMsg, "gom2k.a.b", &types.EnvelopeConfig{})
+	if err != nil {
+		t.Fatalf("Failed to convert MQTT message: %v", err)
+	}
+	if len(kafkaMsg.Headers) != 0 {
+		t.Errorf("Expected no headers in JSON mode, got %v", kafkaMsg.Headers)
+	}
+	if _, err := kafka.ConvertKafkaMessage(kafkaMsg); err != nil {
+		t.Errorf("Failed to convert JSON envelope back: %v", err)
+	}
+
+	if _, err := kafka.ConvertMQTTMessageWithEnvelope(mqttMsg, "gom2k.a.b", &types.EnvelopeConfig{Mode: "xml"}); err == nil {
+		t.Error("Expected error for unknown envelope mode")
+	}
+}
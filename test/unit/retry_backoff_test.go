@@ -0,0 +1,142 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gom2k/internal/bridge"
+	"gom2k/internal/config"
+	"gom2k/internal/kafka"
+	"gom2k/internal/mqtt"
+	"gom2k/pkg/types"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestRetryDelayBackoff(t *testing.T) {
+	config := &types.BridgeConfig{
+		DeadLetter: types.DeadLetterConfig{
+			Enabled:          true,
+			MaxRetries:       10,
+			RetryInterval:    time.Second,
+			MaxRetryInterval: 5 * time.Second,
+		},
+	}
+	dlq := bridge.NewDeadLetterQueue(config, nil, nil)
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, delay := range expected {
+		if got := dlq.RetryDelay(i + 1); got != delay {
+			t.Errorf("Failure %d: expected delay %v, got %v", i+1, delay, got)
+		}
+	}
+
+	// Jitter only ever shortens the delay, so the max delay holds
+	config.DeadLetter.RetryJitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := dlq.RetryDelay(3); got < 2*time.Second || got > 4*time.Second {
+			t.Fatalf("Expected a jittered delay between 2s and 4s, got %v", got)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		class string
+	}{
+		{"network error", errors.New("dial tcp 127.0.0.1:9092: connection refused"), bridge.ErrorTransient},
+		{"timeout", context.DeadlineExceeded, bridge.ErrorTransient},
+		{"leader not available", fmt.Errorf("failed to write messages to Kafka: %w", kafkago.WriteErrors{kafkago.LeaderNotAvailable}), bridge.ErrorTransient},
+		{"conversion error", bridge.Permanent(errors.New("invalid envelope")), bridge.ErrorPermanent},
+		{"invalid Kafka topic", fmt.Errorf("failed to write messages to Kafka: %w", kafkago.InvalidTopic), bridge.ErrorPermanent},
+		{"topic authorization", fmt.Errorf("failed to write messages to Kafka: %w", kafkago.WriteErrors{kafkago.TopicAuthorizationFailed, nil}), bridge.ErrorPermanent},
+		{"partly transient batch", kafkago.WriteErrors{kafkago.TopicAuthorizationFailed, kafkago.NotEnoughReplicas}, bridge.ErrorTransient},
+		{"refused topic", fmt.Errorf("write: %w", kafka.ErrTopicNotAllowed), bridge.ErrorPermanent},
+		{"invalid MQTT topic", fmt.Errorf("failed to publish: %w", mqtt.ValidateTopicName("sensor/+/temp")), bridge.ErrorPermanent},
+	}
+
+	for _, test := range tests {
+		if class := bridge.ClassifyError(test.err); class != test.class {
+			t.Errorf("%s: expected %s, got %s", test.name, test.class, class)
+		}
+	}
+}
+
+func TestHandleErrorByClass(t *testing.T) {
+	config := &types.BridgeConfig{
+		DeadLetter: types.DeadLetterConfig{Enabled: true, MaxRetries: 5, RetryInterval: time.Hour},
+	}
+	dlq := bridge.NewDeadLetterQueue(config, nil, nil)
+
+	transient := &types.MQTTMessage{ID: "01HN3Q2X4YB8M7T6VZK5R9C0DE", Topic: "sensor/room1", Payload: []byte("23.5")}
+	permanent := &types.MQTTMessage{ID: "01HN3Q2X4YB8M7T6VZK5R9C0DF", Topic: "sensor/room2", Payload: []byte("23.5")}
+	dlq.HandleError(transient, errors.New("connection refused"), "mqtt-to-kafka", transient.Topic, "gom2k.sensor.room1")
+	dlq.HandleError(permanent, bridge.Permanent(errors.New("invalid envelope")), "mqtt-to-kafka", permanent.Topic, "gom2k.sensor.room2")
+
+	if count := dlq.GetFailedMessageCount(); count != 1 {
+		t.Fatalf("Expected only the transient failure to be retried, got %d pending", count)
+	}
+
+	// A retry failing permanently ends the retries
+	dlq.HandleError(transient, fmt.Errorf("retry: %w", kafkago.TopicAuthorizationFailed), "mqtt-to-kafka", transient.Topic, "gom2k.sensor.room1")
+	if count := dlq.GetFailedMessageCount(); count != 0 {
+		t.Errorf("Expected no pending retries after a permanent failure, got %d", count)
+	}
+}
+
+func TestRetryBackoffConfig(t *testing.T) {
+	configYAML := `
+mqtt:
+  broker:
+    host: "localhost"
+    port: 1883
+kafka:
+  brokers: ["localhost:9092"]
+bridge:
+  features:
+    mqtt_to_kafka: true
+  dead_letter:
+    enabled: true
+    retry_interval: 5s
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	loaded, err := config.LoadForTesting(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if loaded.Bridge.DeadLetter.MaxRetryInterval != types.DefaultMaxRetryInterval || loaded.Bridge.DeadLetter.RetryJitter != types.DefaultRetryJitter {
+		t.Errorf("Expected backoff defaults, got max %v and jitter %v", loaded.Bridge.DeadLetter.MaxRetryInterval, loaded.Bridge.DeadLetter.RetryJitter)
+	}
+
+	// An explicit zero turns jitter off
+	if err := os.WriteFile(configPath, []byte(configYAML+"    retry_jitter: 0\n"), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	loaded, err = config.LoadForTesting(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if loaded.Bridge.DeadLetter.RetryJitter != 0 {
+		t.Errorf("Expected jitter to stay off, got %v", loaded.Bridge.DeadLetter.RetryJitter)
+	}
+
+	for _, invalid := range []string{"    max_retry_interval: 1s\n", "    retry_jitter: 1.5\n"} {
+		if err := os.WriteFile(configPath, []byte(configYAML+invalid), 0600); err != nil {
+			t.Fatalf("Failed to write test config: %v", err)
+		}
+		if _, err := config.LoadForTesting(configPath); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
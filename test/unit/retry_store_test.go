@@ -0,0 +1,196 @@
+package unit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gom2k/internal/bridge"
+	"gom2k/pkg/types"
+)
+
+func TestFileRetryStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "retries", "mqtt-to-kafka.log")
+	store, err := bridge.OpenFileRetryStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open retry store: %v", err)
+	}
+
+	firstFailure := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	mqttMsg := &types.FailedMessage{
+		OriginalMessage: &types.MQTTMessage{Topic: "sensor/room1", Payload: []byte{0x00, 0xff}, QoS: 1, Timestamp: firstFailure},
+		FailureReason:   "broker unavailable",
+		AttemptCount:    1,
+		FirstFailure:    firstFailure,
+		Direction:       "mqtt-to-kafka",
+		OriginalTopic:   "sensor/room1",
+		TargetTopic:     "gom2k.sensor.room1",
+	}
+	kafkaMsg := &types.FailedMessage{
+		OriginalMessage: &types.KafkaMessage{Topic: "gom2k.cmd", Key: "device1", Value: []byte("on"), Headers: []types.KafkaHeader{{Key: "source", Value: []byte("ops")}}},
+		FailureReason:   "publish timeout",
+		AttemptCount:    1,
+		FirstFailure:    firstFailure.Add(time.Second),
+		Direction:       "kafka-to-mqtt",
+		OriginalTopic:   "gom2k.cmd",
+	}
+	for key, msg := range map[string]*types.FailedMessage{"m1": mqttMsg, "k1": kafkaMsg, "gone": kafkaMsg} {
+		if err := store.Put(key, msg); err != nil {
+			t.Fatalf("Failed to store %s: %v", key, err)
+		}
+	}
+	mqttMsg.AttemptCount = 2
+	if err := store.Put("m1", mqttMsg); err != nil {
+		t.Fatalf("Failed to update message: %v", err)
+	}
+	if err := store.Delete("gone"); err != nil {
+		t.Fatalf("Failed to delete message: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close retry store: %v", err)
+	}
+
+	// A record cut short by a crash is skipped
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("Failed to open store file: %v", err)
+	}
+	file.WriteString(`{"key":"partial","message":{"failure_re`)
+	file.Close()
+
+	store, err = bridge.OpenFileRetryStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen retry store: %v", err)
+	}
+	defer store.Close()
+
+	entries := store.List()
+	if len(entries) != 2 || entries[0].Key != "m1" || entries[1].Key != "k1" {
+		t.Fatalf("Expected m1 and k1 oldest first, got %+v", entries)
+	}
+
+	restored, ok := entries[0].Message.OriginalMessage.(*types.MQTTMessage)
+	if !ok || restored.Topic != "sensor/room1" || string(restored.Payload) != "\x00\xff" || restored.QoS != 1 {
+		t.Errorf("MQTT message not restored: %#v", entries[0].Message.OriginalMessage)
+	}
+	if entries[0].Message.AttemptCount != 2 || entries[0].Message.TargetTopic != "gom2k.sensor.room1" {
+		t.Errorf("Expected the latest update to win, got %+v", entries[0].Message)
+	}
+	restoredKafka, ok := entries[1].Message.OriginalMessage.(*types.KafkaMessage)
+	if !ok || restoredKafka.Key != "device1" || string(restoredKafka.Value) != "on" || len(restoredKafka.Headers) != 1 {
+		t.Errorf("Kafka message not restored: %#v", entries[1].Message.OriginalMessage)
+	}
+
+	// The store keeps working after the corrupt record was dropped
+	if err := store.Put("m2", mqttMsg); err != nil {
+		t.Fatalf("Failed to store after reload: %v", err)
+	}
+	store.Close()
+	store, err = bridge.OpenFileRetryStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen retry store: %v", err)
+	}
+	if store.Len() != 3 {
+		t.Errorf("Expected 3 pending messages, got %d", store.Len())
+	}
+}
+
+func TestFileRetryStoreCompactionFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mqtt-to-kafka.log")
+	store, err := bridge.OpenFileRetryStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open retry store: %v", err)
+	}
+	defer store.Close()
+
+	// A directory in place of the temporary file makes compaction fail
+	if err := os.Mkdir(path+".tmp", 0700); err != nil {
+		t.Fatalf("Failed to block compaction: %v", err)
+	}
+	msg := &types.FailedMessage{
+		OriginalMessage: &types.MQTTMessage{Topic: "sensor/room1", Payload: []byte("23.5")},
+		Direction:       "mqtt-to-kafka",
+	}
+	compactionFailed := false
+	for i := 0; i < 2000 && !compactionFailed; i++ {
+		msg.AttemptCount = i
+		compactionFailed = store.Put("m1", msg) != nil
+	}
+	if !compactionFailed {
+		t.Fatal("Expected compaction to fail")
+	}
+
+	// The store keeps appending to the original file
+	if err := os.Remove(path + ".tmp"); err != nil {
+		t.Fatalf("Failed to unblock compaction: %v", err)
+	}
+	if err := store.Put("m2", msg); err != nil {
+		t.Fatalf("Failed to store after a failed compaction: %v", err)
+	}
+	store.Close()
+
+	store, err = bridge.OpenFileRetryStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen retry store: %v", err)
+	}
+	if store.Len() != 2 {
+		t.Errorf("Expected 2 pending messages, got %d", store.Len())
+	}
+}
+
+func TestDeadLetterQueueResumesFromFileStore(t *testing.T) {
+	config := &types.BridgeConfig{
+		DeadLetter: types.DeadLetterConfig{
+			Enabled:       true,
+			MaxRetries:    5,
+			RetryInterval: time.Hour,
+			Store:         types.RetryStoreConfig{Type: types.RetryStoreFile, Dir: t.TempDir()},
+		},
+	}
+
+	dlq := bridge.NewDeadLetterQueue(config, nil, nil)
+	if err := dlq.Start(); err != nil {
+		t.Fatalf("Failed to start DLQ: %v", err)
+	}
+	msg := &types.MQTTMessage{Topic: "sensor/room1", Payload: []byte("23.5"), Timestamp: time.Now()}
+	dlq.HandleFailedMessage(msg, "broker unavailable", "mqtt-to-kafka", "sensor/room1", "gom2k.sensor.room1")
+	if err := dlq.Stop(); err != nil {
+		t.Fatalf("Failed to stop DLQ: %v", err)
+	}
+
+	// A restarted bridge picks up the pending retry
+	dlq = bridge.NewDeadLetterQueue(config, nil, nil)
+	if err := dlq.Start(); err != nil {
+		t.Fatalf("Failed to restart DLQ: %v", err)
+	}
+	defer dlq.Stop()
+	if dlq.GetFailedMessageCount() != 1 {
+		t.Errorf("Expected 1 pending retry after restart, got %d", dlq.GetFailedMessageCount())
+	}
+}
+
+func TestDeadLetterQueueOverflow(t *testing.T) {
+	for _, overflow := range []string{types.OverflowDeadLetter, types.OverflowEvictOldest, types.OverflowDrop} {
+		t.Run(overflow, func(t *testing.T) {
+			config := &types.BridgeConfig{
+				DeadLetter: types.DeadLetterConfig{
+					Enabled:       true,
+					MaxRetries:    5,
+					RetryInterval: time.Hour,
+					Store:         types.RetryStoreConfig{MaxMessages: 2, Overflow: overflow},
+				},
+			}
+			dlq := bridge.NewDeadLetterQueue(config, nil, nil)
+
+			for i, topic := range []string{"sensor/room1", "sensor/room2", "sensor/room3"} {
+				msg := &types.MQTTMessage{Topic: topic, Payload: []byte("23.5"), Timestamp: time.Unix(int64(i), 0)}
+				dlq.HandleFailedMessage(msg, "broker unavailable", "mqtt-to-kafka", topic, "gom2k.sensor")
+			}
+
+			if count := dlq.GetFailedMessageCount(); count != 2 {
+				t.Errorf("Expected the retry queue to stay at 2 messages, got %d", count)
+			}
+		})
+	}
+}
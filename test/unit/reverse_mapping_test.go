@@ -0,0 +1,207 @@
+package unit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gom2k/internal/config"
+	"gom2k/internal/kafka"
+	"gom2k/internal/mapping"
+	"gom2k/pkg/types"
+)
+
+func TestReverseMapping(t *testing.T) {
+	rules := []types.ReverseMappingRule{
+		{Source: "topic", Match: `gom2k\.cmd\.(.*)`, MQTTTopic: "devices/{1}/set", QoS: 1},
+		{Source: "key", Match: `(?P<room>[a-z]+)-(?P<device>[a-z0-9]+)`, MQTTTopic: "home/{room}/{device}/command"},
+		{Source: "header", Header: "target", Match: `(.+)`, MQTTTopic: "targets/{1}", Retained: true},
+	}
+
+	mapper, err := mapping.NewReverseMapper(rules)
+	if err != nil {
+		t.Fatalf("Failed to create reverse mapper: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		msg           *types.KafkaMessage
+		expectedTopic string
+		expectedRule  int
+		expectMatch   bool
+	}{
+		{
+			name:          "topic rule with numbered group",
+			msg:           &types.KafkaMessage{Topic: "gom2k.cmd.lamp1"},
+			expectedTopic: "devices/lamp1/set",
+			expectedRule:  0,
+			expectMatch:   true,
+		},
+		{
+			name:          "key rule with named groups",
+			msg:           &types.KafkaMessage{Topic: "commands", Key: "kitchen-fan2"},
+			expectedTopic: "home/kitchen/fan2/command",
+			expectedRule:  1,
+			expectMatch:   true,
+		},
+		{
+			name: "header rule",
+			msg: &types.KafkaMessage{
+				Topic:   "commands",
+				Key:     "NOT-MATCHING",
+				Headers: []types.KafkaHeader{{Key: "target", Value: []byte("garage/door")}},
+			},
+			expectedTopic: "targets/garage/door",
+			expectedRule:  2,
+			expectMatch:   true,
+		},
+		{
+			name:        "pattern must match the whole value",
+			msg:         &types.KafkaMessage{Topic: "prod.gom2k.cmd.lamp1", Key: "UPPER"},
+			expectMatch: false,
+		},
+		{
+			name:        "missing header does not match",
+			msg:         &types.KafkaMessage{Topic: "commands"},
+			expectMatch: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := mapper.Map(tt.msg)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !tt.expectMatch {
+				if match != nil {
+					t.Errorf("Expected no match, got topic %q from rule %d", match.Topic, match.RuleIndex)
+				}
+				return
+			}
+
+			if match == nil {
+				t.Fatalf("Expected match for %+v", tt.msg)
+			}
+			if match.Topic != tt.expectedTopic {
+				t.Errorf("Expected topic %q, got %q", tt.expectedTopic, match.Topic)
+			}
+			if match.RuleIndex != tt.expectedRule {
+				t.Errorf("Expected rule %d, got %d", tt.expectedRule, match.RuleIndex)
+			}
+			if match.QoS != rules[tt.expectedRule].QoS || match.Retained != rules[tt.expectedRule].Retained {
+				t.Errorf("Expected QoS/retain from rule %d, got %d/%v", tt.expectedRule, match.QoS, match.Retained)
+			}
+		})
+	}
+}
+
+func TestReverseMappingMatchesTopic(t *testing.T) {
+	mapper, err := mapping.NewReverseMapper([]types.ReverseMappingRule{
+		{Source: "topic", Match: `commands\..+`, MQTTTopic: "devices/{0}"},
+		{Source: "key", Match: `events\..+`, MQTTTopic: "events"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create reverse mapper: %v", err)
+	}
+
+	if !mapper.MatchesTopic("commands.lamp") {
+		t.Error("Expected topic rule to select commands.lamp")
+	}
+	if mapper.MatchesTopic("events.lamp") {
+		t.Error("Key rules should not select topics for consumption")
+	}
+}
+
+func TestSelectBridgeTopics(t *testing.T) {
+	mapper, err := mapping.NewReverseMapper([]types.ReverseMappingRule{
+		{Source: "topic", Match: `commands\..+`, MQTTTopic: "devices/{0}"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create reverse mapper: %v", err)
+	}
+	bridgeConfig := &types.BridgeConfig{}
+	bridgeConfig.DeadLetter.KafkaTopic = "gom2k.dead-letter"
+	bridgeConfig.Kafka.Guard.CatchAllTopic = "gom2k.unrouted"
+
+	topics := []string{"gom2k.sensor.room1", "gom2k.dead-letter", "gom2k.unrouted", "gom2kother.sensor", "gom2k", "commands.lamp", "other.topic"}
+	selected := kafka.SelectBridgeTopics(topics, "gom2k", bridgeConfig, mapper)
+	if strings.Join(selected, ",") != "gom2k.sensor.room1,commands.lamp" {
+		t.Errorf("Expected only bridged and rule topics without the dead letter and catch-all topics, got %v", selected)
+	}
+}
+
+func TestReverseMappingInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule types.ReverseMappingRule
+	}{
+		{"unknown source", types.ReverseMappingRule{Source: "value", Match: ".*", MQTTTopic: "a"}},
+		{"header without name", types.ReverseMappingRule{Source: "header", Match: ".*", MQTTTopic: "a"}},
+		{"invalid pattern", types.ReverseMappingRule{Source: "topic", Match: "(", MQTTTopic: "a"}},
+		{"missing template", types.ReverseMappingRule{Source: "topic", Match: ".*"}},
+		{"unknown group index", types.ReverseMappingRule{Source: "topic", Match: "(a)", MQTTTopic: "x/{2}"}},
+		{"unknown group name", types.ReverseMappingRule{Source: "topic", Match: "(a)", MQTTTopic: "x/{name}"}},
+		{"invalid qos", types.ReverseMappingRule{Source: "topic", Match: ".*", MQTTTopic: "a", QoS: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := mapping.NewReverseMapper([]types.ReverseMappingRule{tt.rule}); err == nil {
+				t.Errorf("Expected error for rule %+v", tt.rule)
+			}
+		})
+	}
+}
+
+func TestReverseMappingWildcardResult(t *testing.T) {
+	mapper, err := mapping.NewReverseMapper([]types.ReverseMappingRule{
+		{Source: "key", Match: `(.*)`, MQTTTopic: "devices/{1}"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create reverse mapper: %v", err)
+	}
+
+	if _, err := mapper.Map(&types.KafkaMessage{Key: "+/set"}); err == nil {
+		t.Error("Expected error when expansion produces an MQTT wildcard")
+	}
+}
+
+func TestReverseMappingConfigLoading(t *testing.T) {
+	configYAML := `
+mqtt:
+  broker:
+    host: "localhost"
+    port: 1883
+kafka:
+  brokers: ["localhost:9092"]
+bridge:
+  features:
+    kafka_to_mqtt: true
+  mapping:
+    reverse_rules:
+      - source: "topic"
+        match: "gom2k\\.cmd\\.(.*)"
+        mqtt_topic: "devices/{1}/set"
+        qos: 1
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	loaded, err := config.LoadForTesting(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	rules := loaded.Bridge.Mapping.ReverseRules
+	if len(rules) != 1 {
+		t.Fatalf("Expected 1 reverse rule, got %d", len(rules))
+	}
+	if rules[0].Match != `gom2k\.cmd\.(.*)` || rules[0].MQTTTopic != "devices/{1}/set" || rules[0].QoS != 1 {
+		t.Errorf("Reverse rule not loaded correctly: %+v", rules[0])
+	}
+}
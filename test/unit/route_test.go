@@ -0,0 +1,58 @@
+package unit
+
+import (
+	"strings"
+	"testing"
+
+	"gom2k/internal/bridge"
+	"gom2k/internal/kafka"
+	"gom2k/pkg/types"
+)
+
+func TestMQTTRouterRoutes(t *testing.T) {
+	config := &types.BridgeConfig{
+		Mapping:        types.MappingConfig{KafkaPrefix: "gom2k", MaxTopicLevels: 3, Sanitize: "replace", Replacement: "_"},
+		Envelope:       types.EnvelopeConfig{Mode: kafka.EnvelopeRaw},
+		Sparkplug:      types.SparkplugConfig{Enabled: true},
+		LoopPrevention: types.LoopPreventionConfig{Namespace: "gom2k/from-kafka"},
+		Ignore:         types.IgnoreConfig{MQTTToKafka: []string{"debug/#"}},
+	}
+	config.Kafka.Guard = types.TopicGuardConfig{Deny: []string{`gom2k\.secret\..*`}, DisallowedPolicy: kafka.DisallowedCatchAll, CatchAllTopic: "gom2k.catch-all"}
+
+	router, err := bridge.NewMQTTRouter(config)
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	tests := []struct {
+		mqttTopic  string
+		kafkaTopic string
+		key        string
+		rule       string
+	}{
+		{"sensor/room1/temp", "gom2k.sensor.room1.temp", "sensor/room1/temp", `prefix "gom2k", max 3 levels`},
+		{"home/living room/lamp", "gom2k.home.living_room.lamp", "home/living room/lamp", "sanitized (replace)"},
+		{"spBv1.0/plant1/DDATA/edge1/pump", "gom2k.spBv1.0.plant1", "plant1/edge1/pump", "sparkplug group plant1"},
+		{"debug/trace", "", "", "ignored by filter debug/#"},
+		{"gom2k/from-kafka/cmd", "", "", "loop prevention namespace"},
+		{"secret/key", "gom2k.catch-all", "secret/key", "refused by topic guard, sent to catch-all topic"},
+	}
+
+	for _, test := range tests {
+		route, err := router.Route(test.mqttTopic)
+		if err != nil {
+			t.Fatalf("%s: failed to route: %v", test.mqttTopic, err)
+		}
+		if route.KafkaTopic != test.kafkaTopic || route.Key != test.key {
+			t.Errorf("%s: expected %q keyed %q, got %q keyed %q", test.mqttTopic, test.kafkaTopic, test.key, route.KafkaTopic, route.Key)
+		}
+		if !strings.Contains(route.Rule, test.rule) {
+			t.Errorf("%s: expected rule containing %q, got %q", test.mqttTopic, test.rule, route.Rule)
+		}
+	}
+
+	config.Envelope = types.EnvelopeConfig{Mode: kafka.EnvelopeAvro}
+	if _, err := bridge.NewMQTTRouter(config); err == nil {
+		t.Error("Expected error for an Avro envelope without a schema registry")
+	}
+}
@@ -0,0 +1,272 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gom2k/internal/kafka"
+	"gom2k/internal/schema"
+	"gom2k/pkg/types"
+)
+
+// fakeRegistry is a minimal in-memory stand-in for a Confluent schema registry
+type fakeRegistry struct {
+	mutex    sync.Mutex
+	schemas  []schema.RegisteredSchema // Index + 1 is the schema ID
+	subjects map[string]int            // subject + schema -> ID
+	requests int
+}
+
+func newFakeRegistry(t *testing.T) (*fakeRegistry, *httptest.Server) {
+	registry := &fakeRegistry{subjects: make(map[string]int)}
+	server := httptest.NewServer(http.HandlerFunc(registry.serveHTTP))
+	t.Cleanup(server.Close)
+	return registry, server
+}
+
+func (r *fakeRegistry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests++
+
+	writeJSON := func(status int, body interface{}) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+	notFound := func(message string) {
+		writeJSON(http.StatusNotFound, map[string]interface{}{"error_code": 40403, "message": message})
+	}
+
+	path := req.URL.Path
+	switch {
+	case req.Method == http.MethodGet && strings.HasPrefix(path, "/schemas/ids/"):
+		var id int
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(path, "/schemas/ids/")), &id); err != nil || id < 1 || id > len(r.schemas) {
+			notFound("Schema not found")
+			return
+		}
+		writeJSON(http.StatusOK, r.schemas[id-1])
+
+	case req.Method == http.MethodPost && strings.HasPrefix(path, "/subjects/"):
+		var registered schema.RegisteredSchema
+		json.NewDecoder(req.Body).Decode(&registered)
+
+		subject := strings.TrimPrefix(path, "/subjects/")
+		register := strings.HasSuffix(subject, "/versions")
+		subject = strings.TrimSuffix(subject, "/versions")
+		key := subject + "|" + registered.SchemaType + "|" + registered.Schema
+
+		id, exists := r.subjects[key]
+		if !exists && !register {
+			notFound("Schema not found")
+			return
+		}
+		if !exists {
+			r.schemas = append(r.schemas, registered)
+			id = len(r.schemas)
+			r.subjects[key] = id
+		}
+		writeJSON(http.StatusOK, map[string]int{"id": id})
+
+	default:
+		notFound("Unknown endpoint")
+	}
+}
+
+func (r *fakeRegistry) subjectNames() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var names []string
+	for key := range r.subjects {
+		names = append(names, strings.SplitN(key, "|", 2)[0])
+	}
+	return names
+}
+
+func TestSubjectNamingStrategies(t *testing.T) {
+	tests := []struct {
+		strategy string
+		expected string
+	}{
+		{schema.SubjectTopic, "gom2k.sensor-value"},
+		{schema.SubjectRecord, "io.gom2k.MQTTMessage"},
+		{schema.SubjectTopicRecord, "gom2k.sensor-io.gom2k.MQTTMessage"},
+	}
+	for _, tt := range tests {
+		subject, err := schema.SubjectName(tt.strategy, "gom2k.sensor", "io.gom2k.MQTTMessage")
+		if err != nil || subject != tt.expected {
+			t.Errorf("Strategy %s: expected %q, got %q (err: %v)", tt.strategy, tt.expected, subject, err)
+		}
+	}
+
+	if _, err := schema.SubjectName("unknown", "t", "r"); err == nil {
+		t.Error("Expected error for unknown strategy")
+	}
+}
+
+func TestWireFormat(t *testing.T) {
+	framed := schema.EncodeWireFormat(258, nil, []byte{0xAA})
+	if !bytes.Equal(framed, []byte{0x00, 0x00, 0x00, 0x01, 0x02, 0xAA}) {
+		t.Errorf("Unexpected Avro wire format: %x", framed)
+	}
+
+	framed = schema.EncodeWireFormat(1, []int{0}, []byte{0xAA})
+	if !bytes.Equal(framed, []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0xAA}) {
+		t.Errorf("Unexpected Protobuf wire format: %x", framed)
+	}
+
+	id, data, err := schema.DecodeWireFormat(framed)
+	if err != nil || id != 1 {
+		t.Fatalf("Failed to decode wire format: id %d, err %v", id, err)
+	}
+	indexes, data, err := schema.DecodeMessageIndexes(data)
+	if err != nil || len(indexes) != 1 || indexes[0] != 0 || !bytes.Equal(data, []byte{0xAA}) {
+		t.Errorf("Unexpected message indexes %v and data %x (err: %v)", indexes, data, err)
+	}
+
+	if _, _, err := schema.DecodeWireFormat([]byte(`{"payload":"x"}`)); err == nil {
+		t.Error("Expected error for JSON value")
+	}
+
+	// A crafted index count must not allocate beyond the record
+	huge := binary.AppendVarint(nil, math.MaxInt64)
+	if _, _, err := schema.DecodeMessageIndexes(append(huge, 0x02, 0xAA)); err == nil {
+		t.Error("Expected error for an index count beyond the record size")
+	}
+}
+
+func TestEnvelopeBinaryEncodings(t *testing.T) {
+	mqttMsg := &types.MQTTMessage{Topic: "a", Payload: []byte("b"), QoS: 1, Retained: true, Timestamp: time.UnixMilli(0)}
+
+	// Avro: zigzag varint lengths and ints, single byte boolean
+	if avro := schema.EncodeAvroEnvelope(mqttMsg); !bytes.Equal(avro, []byte{0x02, 'a', 0x02, 'b', 0x02, 0x01, 0x00}) {
+		t.Errorf("Unexpected Avro encoding: %x", avro)
+	}
+
+	// Protobuf: proto3 omits the zero timestamp
+	expected := []byte{0x0A, 0x01, 'a', 0x12, 0x01, 'b', 0x18, 0x01, 0x20, 0x01}
+	if proto := schema.EncodeProtobufEnvelope(mqttMsg); !bytes.Equal(proto, expected) {
+		t.Errorf("Unexpected Protobuf encoding: %x", proto)
+	}
+}
+
+func TestSchemaCodecRoundTrip(t *testing.T) {
+	timestamp := time.UnixMilli(1704110400123)
+	payload := []byte{0x08, 0x96, 0x01, 0xff}
+
+	for _, mode := range []string{kafka.EnvelopeAvro, kafka.EnvelopeProtobuf} {
+		for _, target := range []string{schema.TargetEnvelope, schema.TargetPayload} {
+			t.Run(mode+"/"+target, func(t *testing.T) {
+				_, server := newFakeRegistry(t)
+				codec, err := kafka.NewCodec(&types.EnvelopeConfig{
+					Mode:   mode,
+					Schema: types.SchemaConfig{RegistryURL: server.URL, Target: target},
+				})
+				if err != nil {
+					t.Fatalf("Failed to create codec: %v", err)
+				}
+
+				mqttMsg := &types.MQTTMessage{Topic: "sensor/room1", Payload: payload, QoS: 2, Retained: true, Timestamp: timestamp}
+				kafkaMsg, err := codec.Encode(mqttMsg, "gom2k.sensor.room1")
+				if err != nil {
+					t.Fatalf("Failed to encode: %v", err)
+				}
+				if !schema.IsWireFormat(kafkaMsg.Value) {
+					t.Fatalf("Expected wire format value, got %x", kafkaMsg.Value)
+				}
+				if _, ok := kafkaMsg.Header(kafka.HeaderMQTTTopic); ok != (target == schema.TargetPayload) {
+					t.Errorf("Unexpected metadata headers for target %s: %v", target, kafkaMsg.Headers)
+				}
+
+				restored, err := codec.Decode(kafkaMsg)
+				if err != nil {
+					t.Fatalf("Failed to decode: %v", err)
+				}
+				if restored.Topic != mqttMsg.Topic || !bytes.Equal(restored.Payload, payload) ||
+					restored.QoS != 2 || !restored.Retained || !restored.Timestamp.Equal(timestamp) {
+					t.Errorf("Round trip mismatch: %+v", restored)
+				}
+			})
+		}
+	}
+}
+
+func TestSchemaRegistryCaching(t *testing.T) {
+	registry, server := newFakeRegistry(t)
+	codec, err := kafka.NewCodec(&types.EnvelopeConfig{
+		Mode:   kafka.EnvelopeAvro,
+		Schema: types.SchemaConfig{RegistryURL: server.URL, SubjectStrategy: schema.SubjectTopicRecord},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+
+	mqttMsg := &types.MQTTMessage{Topic: "a/b", Payload: []byte("ON"), Timestamp: time.Now()}
+	for i := 0; i < 5; i++ {
+		kafkaMsg, err := codec.Encode(mqttMsg, "gom2k.a.b")
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		if _, err := codec.Decode(kafkaMsg); err != nil {
+			t.Fatalf("Failed to decode: %v", err)
+		}
+	}
+
+	// One registration; the schema for decoding is known from registering it
+	if registry.requests != 1 {
+		t.Errorf("Expected 1 registry request, got %d", registry.requests)
+	}
+	if subjects := registry.subjectNames(); len(subjects) != 1 || subjects[0] != "gom2k.a.b-io.gom2k.MQTTMessage" {
+		t.Errorf("Unexpected subjects %v", subjects)
+	}
+}
+
+func TestSchemaRegistryLookupOnly(t *testing.T) {
+	_, server := newFakeRegistry(t)
+	codec, err := kafka.NewCodec(&types.EnvelopeConfig{
+		Mode:   kafka.EnvelopeProtobuf,
+		Schema: types.SchemaConfig{RegistryURL: server.URL, LookupOnly: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+
+	_, err = codec.Encode(&types.MQTTMessage{Topic: "a/b", Payload: []byte("ON")}, "gom2k.a.b")
+	if err == nil || !contains(err.Error(), "Schema not found") {
+		t.Errorf("Expected schema not found error, got %v", err)
+	}
+
+	// Registering first makes the lookup succeed
+	client := schema.NewRegistryClient(server.URL, "", "", time.Second)
+	if _, err := client.Register(context.Background(), "gom2k.a.b-value",
+		schema.RegisteredSchema{Schema: schema.ProtobufEnvelopeSchema, SchemaType: schema.TypeProtobuf}); err != nil {
+		t.Fatalf("Failed to register schema: %v", err)
+	}
+	if _, err := codec.Encode(&types.MQTTMessage{Topic: "a/b", Payload: []byte("ON")}, "gom2k.a.b"); err != nil {
+		t.Errorf("Expected lookup to succeed after registration, got %v", err)
+	}
+}
+
+func TestSchemaModesRequireRegistry(t *testing.T) {
+	if _, err := kafka.NewCodec(&types.EnvelopeConfig{Mode: kafka.EnvelopeAvro}); err == nil {
+		t.Error("Expected error for avro mode without registry_url")
+	}
+
+	// Without a registry, wire format lookalikes are treated as JSON envelopes
+	codec, err := kafka.NewCodec(&types.EnvelopeConfig{Mode: kafka.EnvelopeJSON})
+	if err != nil {
+		t.Fatalf("Failed to create codec: %v", err)
+	}
+	if _, err := codec.Decode(&types.KafkaMessage{Value: []byte{0, 0, 0, 0, 1, 2}}); err == nil {
+		t.Error("Expected error decoding wire format without registry")
+	}
+}
@@ -0,0 +1,241 @@
+package unit
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"gom2k/internal/protowire"
+	"gom2k/internal/sparkplug"
+	"gom2k/pkg/types"
+)
+
+// testMetric describes a metric to encode into a Sparkplug B test payload
+type testMetric struct {
+	name     string
+	alias    uint64
+	dataType uint64
+	value    interface{} // uint64, float64, bool or string
+}
+
+// encodeSparkplugPayload builds a Sparkplug B protobuf payload
+func encodeSparkplugPayload(seq uint64, metrics ...testMetric) []byte {
+	var payload []byte
+	payload = protowire.AppendVarint(payload, 1, 1704110400000)
+	for _, m := range metrics {
+		var metric []byte
+		if m.name != "" {
+			metric = protowire.AppendBytes(metric, 1, []byte(m.name))
+		}
+		if m.alias != 0 {
+			metric = protowire.AppendVarint(metric, 2, m.alias)
+		}
+		if m.dataType != 0 {
+			metric = protowire.AppendVarint(metric, 4, m.dataType)
+		}
+		switch v := m.value.(type) {
+		case uint64:
+			metric = protowire.AppendVarint(metric, 10, v)
+		case float64:
+			metric = protowire.AppendFixed64(metric, 13, math.Float64bits(v))
+		case bool:
+			metric = protowire.AppendVarint(metric, 14, map[bool]uint64{false: 0, true: 1}[v])
+		case string:
+			metric = protowire.AppendBytes(metric, 15, []byte(v))
+		}
+		payload = protowire.AppendBytes(payload, 2, metric)
+	}
+	return protowire.AppendVarint(payload, 3, seq)
+}
+
+func newSparkplugDecoder(output string) *sparkplug.Decoder {
+	return sparkplug.NewDecoder(&types.SparkplugConfig{
+		Enabled:         true,
+		Output:          output,
+		Rebirth:         true,
+		RebirthInterval: time.Minute,
+	})
+}
+
+// decodeRecords decodes the JSON values of Sparkplug records
+func decodeRecords(t *testing.T, result *sparkplug.Result) []map[string]interface{} {
+	t.Helper()
+	var values []map[string]interface{}
+	for _, record := range result.Records {
+		var value map[string]interface{}
+		if err := json.Unmarshal(record.Value, &value); err != nil {
+			t.Fatalf("Invalid record JSON: %v", err)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func TestSparkplugTopicParsing(t *testing.T) {
+	topic, err := sparkplug.ParseTopic("spBv1.0/plant1/DDATA/edge1/press4")
+	if err != nil {
+		t.Fatalf("Failed to parse topic: %v", err)
+	}
+	if topic.Key() != "plant1/edge1/press4" || topic.CommandTopic() != "spBv1.0/plant1/NCMD/edge1" {
+		t.Errorf("Unexpected key %q or command topic %q", topic.Key(), topic.CommandTopic())
+	}
+
+	for _, invalid := range []string{
+		"spBv1.0/STATE/scada1",
+		"spBv1.0/plant1/NDATA/edge1/device1",
+		"spBv1.0/plant1/DDATA/edge1",
+		"spBv1.0/plant1/XDATA/edge1",
+		"sensor/room1/temp",
+	} {
+		if _, err := sparkplug.ParseTopic(invalid); err == nil {
+			t.Errorf("Expected error for %s", invalid)
+		}
+	}
+}
+
+func TestSparkplugAliasResolution(t *testing.T) {
+	decoder := newSparkplugDecoder(sparkplug.OutputMetric)
+	now := time.Now()
+
+	birth := encodeSparkplugPayload(0,
+		testMetric{name: "Temperature", alias: 1, dataType: sparkplug.TypeDouble, value: 20.5},
+		testMetric{name: "Offset", alias: 2, dataType: sparkplug.TypeInt32, value: uint64(0)},
+	)
+	result, err := decoder.Decode("spBv1.0/plant1/NBIRTH/edge1", birth, now)
+	if err != nil {
+		t.Fatalf("Failed to decode NBIRTH: %v", err)
+	}
+	if len(result.Records) != 2 || result.RebirthTopic != "" {
+		t.Fatalf("Expected 2 records without rebirth, got %d (rebirth %q)", len(result.Records), result.RebirthTopic)
+	}
+
+	// NDATA only carries aliases; -5 as Int32 is sent as two's complement
+	data := encodeSparkplugPayload(1,
+		testMetric{alias: 1, value: 23.5},
+		testMetric{alias: 2, value: uint64(0xFFFFFFFB)},
+	)
+	result, err = decoder.Decode("spBv1.0/plant1/NDATA/edge1", data, now)
+	if err != nil {
+		t.Fatalf("Failed to decode NDATA: %v", err)
+	}
+
+	values := decodeRecords(t, result)
+	if len(values) != 2 {
+		t.Fatalf("Expected one record per metric, got %d", len(values))
+	}
+	first := values[0]["metric"].(map[string]interface{})
+	second := values[1]["metric"].(map[string]interface{})
+	if first["name"] != "Temperature" || first["value"] != 23.5 || first["datatype"] != "Double" {
+		t.Errorf("Unexpected first metric %v", first)
+	}
+	if second["name"] != "Offset" || second["value"] != float64(-5) {
+		t.Errorf("Unexpected second metric %v", second)
+	}
+	if result.Records[0].Key != "plant1/edge1" || values[0]["message_type"] != "NDATA" || values[0]["seq"] != float64(1) {
+		t.Errorf("Unexpected record key %q or fields %v", result.Records[0].Key, values[0])
+	}
+}
+
+func TestSparkplugDeviceMessagesAndPayloadOutput(t *testing.T) {
+	decoder := newSparkplugDecoder(sparkplug.OutputPayload)
+	now := time.Now()
+
+	steps := []struct {
+		topic   string
+		payload []byte
+	}{
+		{"spBv1.0/plant1/NBIRTH/edge1", encodeSparkplugPayload(0, testMetric{name: "bdSeq", dataType: sparkplug.TypeInt64, value: uint64(0)})},
+		{"spBv1.0/plant1/DBIRTH/edge1/press4", encodeSparkplugPayload(1,
+			testMetric{name: "Running", alias: 10, dataType: sparkplug.TypeBoolean, value: true},
+			testMetric{name: "Mode", alias: 11, dataType: sparkplug.TypeString, value: "auto"})},
+	}
+	for _, step := range steps {
+		if _, err := decoder.Decode(step.topic, step.payload, now); err != nil {
+			t.Fatalf("Failed to decode %s: %v", step.topic, err)
+		}
+	}
+
+	result, err := decoder.Decode("spBv1.0/plant1/DDATA/edge1/press4",
+		encodeSparkplugPayload(2, testMetric{alias: 10, value: false}, testMetric{alias: 11, value: "manual"}), now)
+	if err != nil {
+		t.Fatalf("Failed to decode DDATA: %v", err)
+	}
+
+	values := decodeRecords(t, result)
+	if len(values) != 1 {
+		t.Fatalf("Expected one record per payload, got %d", len(values))
+	}
+	metrics := values[0]["metrics"].([]interface{})
+	if len(metrics) != 2 || result.Records[0].Key != "plant1/edge1/press4" {
+		t.Fatalf("Unexpected payload record %v with key %q", values[0], result.Records[0].Key)
+	}
+	running := metrics[0].(map[string]interface{})
+	mode := metrics[1].(map[string]interface{})
+	if running["name"] != "Running" || running["value"] != false || mode["name"] != "Mode" || mode["value"] != "manual" {
+		t.Errorf("Unexpected metrics %v", metrics)
+	}
+}
+
+func TestSparkplugSeqGapRequestsRebirth(t *testing.T) {
+	decoder := newSparkplugDecoder(sparkplug.OutputMetric)
+	now := time.Now()
+
+	if _, err := decoder.Decode("spBv1.0/plant1/NBIRTH/edge1",
+		encodeSparkplugPayload(0, testMetric{name: "Temperature", alias: 1, dataType: sparkplug.TypeDouble, value: 20.0}), now); err != nil {
+		t.Fatalf("Failed to decode NBIRTH: %v", err)
+	}
+
+	// seq 1 is missing
+	result, err := decoder.Decode("spBv1.0/plant1/NDATA/edge1", encodeSparkplugPayload(2, testMetric{alias: 1, value: 21.0}), now)
+	if err != nil {
+		t.Fatalf("Failed to decode NDATA: %v", err)
+	}
+	if result.RebirthTopic != "spBv1.0/plant1/NCMD/edge1" {
+		t.Fatalf("Expected rebirth request, got %q", result.RebirthTopic)
+	}
+	if len(result.Records) != 1 {
+		t.Errorf("Expected records to be forwarded despite the gap, got %d", len(result.Records))
+	}
+
+	rebirth, err := sparkplug.DecodePayload(result.RebirthPayload)
+	if err != nil || len(rebirth.Metrics) != 1 || rebirth.Metrics[0].Name != "Node Control/Rebirth" || rebirth.Metrics[0].Value != true {
+		t.Errorf("Unexpected rebirth payload %+v (err: %v)", rebirth, err)
+	}
+
+	// Rebirth requests are rate limited per edge node
+	result, _ = decoder.Decode("spBv1.0/plant1/NDATA/edge1", encodeSparkplugPayload(5, testMetric{alias: 1, value: 22.0}), now)
+	if result.RebirthTopic != "" {
+		t.Error("Expected rebirth request to be rate limited")
+	}
+
+	// Sequence numbers wrap from 255 to 0
+	decoder.Decode("spBv1.0/plant2/NBIRTH/edge1", encodeSparkplugPayload(255), now)
+	result, _ = decoder.Decode("spBv1.0/plant2/NDATA/edge1", encodeSparkplugPayload(0), now)
+	if result.RebirthTopic != "" {
+		t.Error("Expected no rebirth request when seq wraps")
+	}
+}
+
+func TestSparkplugDataBeforeBirth(t *testing.T) {
+	decoder := newSparkplugDecoder(sparkplug.OutputMetric)
+
+	result, err := decoder.Decode("spBv1.0/plant1/DDATA/edge9/press1", encodeSparkplugPayload(7, testMetric{alias: 3, value: uint64(1)}), time.Now())
+	if err != nil {
+		t.Fatalf("Failed to decode DDATA: %v", err)
+	}
+	if result.RebirthTopic != "spBv1.0/plant1/NCMD/edge9" {
+		t.Errorf("Expected rebirth request for unknown edge node, got %q", result.RebirthTopic)
+	}
+
+	// Without rebirth enabled only a warning is logged
+	passive := sparkplug.NewDecoder(&types.SparkplugConfig{Enabled: true, Output: sparkplug.OutputMetric})
+	result, _ = passive.Decode("spBv1.0/plant1/DDATA/edge9/press1", encodeSparkplugPayload(7), time.Now())
+	if result.RebirthTopic != "" {
+		t.Error("Expected no rebirth request when disabled")
+	}
+
+	if _, err := decoder.Decode("spBv1.0/plant1/NDATA/edge1", []byte{0xFF}, time.Now()); err == nil {
+		t.Error("Expected error for invalid protobuf payload")
+	}
+}
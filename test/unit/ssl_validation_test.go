@@ -77,10 +77,7 @@ func TestSSLCertificateValidation(t *testing.T) {
 				},
 			},
 			Bridge: types.BridgeConfig{
-				Mapping: struct {
-					KafkaPrefix    string `yaml:"kafka_prefix"`
-					MaxTopicLevels int    `yaml:"max_topic_levels"`
-				}{
+				Mapping: types.MappingConfig{
 					KafkaPrefix:    "test",
 					MaxTopicLevels: 3,
 				},
@@ -163,10 +160,7 @@ func TestSSLCertificateValidation(t *testing.T) {
 				},
 			},
 			Bridge: types.BridgeConfig{
-				Mapping: struct {
-					KafkaPrefix    string `yaml:"kafka_prefix"`
-					MaxTopicLevels int    `yaml:"max_topic_levels"`
-				}{
+				Mapping: types.MappingConfig{
 					KafkaPrefix:    "test",
 					MaxTopicLevels: 3,
 				},
@@ -255,10 +249,7 @@ func TestSSLCertificateValidation(t *testing.T) {
 				},
 			},
 			Bridge: types.BridgeConfig{
-				Mapping: struct {
-					KafkaPrefix    string `yaml:"kafka_prefix"`
-					MaxTopicLevels int    `yaml:"max_topic_levels"`
-				}{
+				Mapping: types.MappingConfig{
 					KafkaPrefix:    "test",
 					MaxTopicLevels: 3,
 				},
@@ -344,10 +335,7 @@ func TestSSLValidationBypass(t *testing.T) {
 			},
 		},
 		Bridge: types.BridgeConfig{
-			Mapping: struct {
-				KafkaPrefix    string `yaml:"kafka_prefix"`
-				MaxTopicLevels int    `yaml:"max_topic_levels"`
-			}{
+			Mapping: types.MappingConfig{
 				KafkaPrefix:    "test",
 				MaxTopicLevels: 3,
 			},
@@ -0,0 +1,162 @@
+package unit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gom2k/internal/config"
+	"gom2k/internal/kafka"
+	"gom2k/pkg/types"
+)
+
+func TestTopicGuardPatterns(t *testing.T) {
+	guard, err := kafka.NewTopicGuard(&types.TopicGuardConfig{
+		Allow: []string{`gom2k\.sensor\..*`, `gom2k\.state\..*`},
+		Deny:  []string{`gom2k\.sensor\.debug\..*`},
+	}, "gom2k.dlq")
+	if err != nil {
+		t.Fatalf("Failed to create topic guard: %v", err)
+	}
+
+	tests := map[string]bool{
+		"gom2k.sensor.room1":       true,
+		"gom2k.state.room1":        true,
+		"gom2k.sensor.debug.room1": false, // Deny wins over allow
+		"gom2k.random.x7f3":        false, // No allow pattern matches
+		"other.gom2k.sensor.room1": false, // Patterns match the whole topic name
+		"gom2k.dlq":                true,  // Exempt topics are always allowed
+	}
+	for topic, allowed := range tests {
+		err := guard.Check(topic)
+		if allowed && err != nil {
+			t.Errorf("Expected %s to be allowed: %v", topic, err)
+		}
+		if !allowed && !errors.Is(err, kafka.ErrTopicNotAllowed) {
+			t.Errorf("Expected %s to be refused, got %v", topic, err)
+		}
+	}
+
+	// Without allow patterns every topic that isn't denied is allowed
+	guard, err = kafka.NewTopicGuard(&types.TopicGuardConfig{Deny: []string{`.*\.tmp`}})
+	if err != nil {
+		t.Fatalf("Failed to create topic guard: %v", err)
+	}
+	if err := guard.Check("gom2k.anything"); err != nil {
+		t.Errorf("Expected topic to be allowed: %v", err)
+	}
+	if err := guard.Check("gom2k.anything.tmp"); err == nil {
+		t.Error("Expected denied topic to be refused")
+	}
+	if guard.Policy() != kafka.DisallowedDLQ {
+		t.Errorf("Expected dlq policy by default, got %s", guard.Policy())
+	}
+}
+
+func TestTopicGuardCreationQuota(t *testing.T) {
+	guard, err := kafka.NewTopicGuard(&types.TopicGuardConfig{
+		MaxCreatedTopics: 2,
+		CreationWindow:   time.Minute,
+		DisallowedPolicy: kafka.DisallowedCatchAll,
+		CatchAllTopic:    "gom2k.unrouted",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create topic guard: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := guard.ReserveCreation("gom2k.a", start); err != nil {
+		t.Fatalf("Expected first creation to be allowed: %v", err)
+	}
+	if err := guard.ReserveCreation("gom2k.b", start.Add(30*time.Second)); err != nil {
+		t.Fatalf("Expected second creation to be allowed: %v", err)
+	}
+	if err := guard.ReserveCreation("gom2k.c", start.Add(45*time.Second)); !errors.Is(err, kafka.ErrTopicNotAllowed) {
+		t.Errorf("Expected quota to be exceeded, got %v", err)
+	}
+
+	// The catch-all topic doesn't count towards the quota
+	if err := guard.ReserveCreation("gom2k.unrouted", start.Add(45*time.Second)); err != nil {
+		t.Errorf("Expected catch-all topic to be exempt: %v", err)
+	}
+
+	// The window slides, the first creation expires after a minute
+	if err := guard.ReserveCreation("gom2k.c", start.Add(time.Minute)); err != nil {
+		t.Errorf("Expected creation after the first one expired: %v", err)
+	}
+	if err := guard.ReserveCreation("gom2k.d", start.Add(time.Minute)); err == nil {
+		t.Error("Expected quota to be exceeded again")
+	}
+}
+
+func TestTopicGuardValidation(t *testing.T) {
+	tests := map[string]types.TopicGuardConfig{
+		"invalid allow pattern": {Allow: []string{`gom2k\.(`}},
+		"empty deny pattern":    {Deny: []string{""}},
+		"negative quota":        {MaxCreatedTopics: -1},
+		"negative window":       {CreationWindow: -time.Second},
+		"unknown policy":        {DisallowedPolicy: "reject"},
+		"catch_all no topic":    {DisallowedPolicy: kafka.DisallowedCatchAll},
+	}
+
+	for name, guardConfig := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := kafka.NewTopicGuard(&guardConfig); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+}
+
+func TestTopicGuardConfigLoading(t *testing.T) {
+	configYAML := `
+mqtt:
+  broker:
+    host: "localhost"
+    port: 1883
+kafka:
+  brokers: ["localhost:9092"]
+bridge:
+  features:
+    mqtt_to_kafka: true
+  kafka:
+    auto_create_topics: true
+    guard:
+      allow: ["gom2k\\.sensor\\..*"]
+      deny: ["gom2k\\.sensor\\.debug\\..*"]
+      max_created_topics: 50
+      disallowed_policy: "catch_all"
+      catch_all_topic: "gom2k.unrouted"
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	loaded, err := config.LoadForTesting(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	guard := loaded.Bridge.Kafka.Guard
+	if len(guard.Allow) != 1 || guard.Allow[0] != `gom2k\.sensor\..*` || len(guard.Deny) != 1 {
+		t.Errorf("Topic patterns not loaded correctly: %+v", guard)
+	}
+	if guard.MaxCreatedTopics != 50 || guard.CreationWindow != time.Hour {
+		t.Errorf("Expected 50 topics per hour, got %d per %v", guard.MaxCreatedTopics, guard.CreationWindow)
+	}
+	if guard.DisallowedPolicy != kafka.DisallowedCatchAll || guard.CatchAllTopic != "gom2k.unrouted" {
+		t.Errorf("Disallowed policy not loaded correctly: %+v", guard)
+	}
+
+	// catch_all without a topic is rejected at load time
+	invalidYAML := configYAML[:len(configYAML)-len("      catch_all_topic: \"gom2k.unrouted\"\n")]
+	if err := os.WriteFile(configPath, []byte(invalidYAML), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	if _, err := config.LoadForTesting(configPath); err == nil {
+		t.Error("Expected error for catch_all policy without catch_all_topic")
+	}
+}
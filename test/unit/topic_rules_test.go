@@ -0,0 +1,122 @@
+package unit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gom2k/internal/config"
+	"gom2k/internal/kafka"
+	"gom2k/pkg/types"
+)
+
+func TestTopicRulesConfig(t *testing.T) {
+	rules, err := kafka.NewTopicRules(&types.TopicCreationConfig{
+		DefaultPartitions: 3,
+		ReplicationFactor: 3,
+		TopicRules: []types.TopicRule{
+			{Match: `gom2k\.state\..*`, CleanupPolicy: "compact", MinInsyncReplicas: 2, SegmentBytes: 104857600},
+			{Match: `gom2k\.telemetry\..*`, Partitions: 12, RetentionMs: 604800000},
+			{Match: `gom2k\..*`, Partitions: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create topic rules: %v", err)
+	}
+
+	config := rules.TopicConfig("gom2k.state.room1")
+	if config.Topic != "gom2k.state.room1" || config.NumPartitions != 3 || config.ReplicationFactor != 3 {
+		t.Errorf("Expected defaults for partitions and replication, got %+v", config)
+	}
+	entries := make(map[string]string)
+	for _, entry := range config.ConfigEntries {
+		entries[entry.ConfigName] = entry.ConfigValue
+	}
+	if len(entries) != 3 || entries["cleanup.policy"] != "compact" || entries["min.insync.replicas"] != "2" || entries["segment.bytes"] != "104857600" {
+		t.Errorf("Unexpected config entries: %v", entries)
+	}
+
+	// First matching rule wins
+	config = rules.TopicConfig("gom2k.telemetry.room1")
+	if config.NumPartitions != 12 || len(config.ConfigEntries) != 1 || config.ConfigEntries[0].ConfigName != "retention.ms" || config.ConfigEntries[0].ConfigValue != "604800000" {
+		t.Errorf("Unexpected telemetry topic config: %+v", config)
+	}
+
+	// Patterns match the whole topic name
+	config = rules.TopicConfig("other.gom2k.state.room1")
+	if config.NumPartitions != 3 || len(config.ConfigEntries) != 0 {
+		t.Errorf("Expected defaults for unmatched topic, got %+v", config)
+	}
+}
+
+func TestTopicRulesValidation(t *testing.T) {
+	tests := map[string]types.TopicRule{
+		"missing pattern":        {Partitions: 1},
+		"invalid pattern":        {Match: `gom2k\.(`},
+		"negative partitions":    {Match: ".*", Partitions: -1},
+		"invalid retention":      {Match: ".*", RetentionMs: -2},
+		"unknown cleanup policy": {Match: ".*", CleanupPolicy: "archive"},
+		"min insync above rf":    {Match: ".*", MinInsyncReplicas: 3},
+		"min insync above rule":  {Match: ".*", ReplicationFactor: 3, MinInsyncReplicas: 4},
+	}
+
+	for name, rule := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := kafka.NewTopicRules(&types.TopicCreationConfig{
+				DefaultPartitions: 3,
+				ReplicationFactor: 2,
+				TopicRules:        []types.TopicRule{rule},
+			})
+			if err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+
+	// Unlimited retention and rule-level replication are valid
+	if _, err := kafka.NewTopicRules(&types.TopicCreationConfig{
+		ReplicationFactor: 1,
+		TopicRules:        []types.TopicRule{{Match: ".*", RetentionMs: -1, ReplicationFactor: 3, MinInsyncReplicas: 2}},
+	}); err != nil {
+		t.Errorf("Expected valid rule: %v", err)
+	}
+}
+
+func TestTopicRulesConfigLoading(t *testing.T) {
+	configYAML := `
+mqtt:
+  broker:
+    host: "localhost"
+    port: 1883
+kafka:
+  brokers: ["localhost:9092"]
+bridge:
+  features:
+    mqtt_to_kafka: true
+  kafka:
+    auto_create_topics: true
+    replication_factor: 3
+    topic_rules:
+      - match: "gom2k\\.state\\..*"
+        cleanup_policy: "compact"
+        min_insync_replicas: 2
+        retention_ms: -1
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configYAML), 0600); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	loaded, err := config.LoadForTesting(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	rules := loaded.Bridge.Kafka.TopicRules
+	if len(rules) != 1 {
+		t.Fatalf("Expected 1 topic rule, got %d", len(rules))
+	}
+	if rules[0].Match != `gom2k\.state\..*` || rules[0].CleanupPolicy != "compact" || rules[0].MinInsyncReplicas != 2 || rules[0].RetentionMs != -1 {
+		t.Errorf("Topic rule not loaded correctly: %+v", rules[0])
+	}
+}
@@ -0,0 +1,171 @@
+package unit
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+
+	"gom2k/internal/config"
+	"gom2k/internal/mapping"
+	"gom2k/pkg/types"
+)
+
+func TestTopicSanitization(t *testing.T) {
+	tests := []struct {
+		name          string
+		mqttTopic     string
+		policy        string
+		expectedTopic string
+		sanitized     bool
+	}{
+		{
+			name:          "legal topic is unchanged",
+			mqttTopic:     "sensor/room-1/temp_c",
+			policy:        mapping.SanitizeReplace,
+			expectedTopic: "gom2k.sensor.room-1.temp_c",
+		},
+		{
+			name:          "replace spaces and plus",
+			mqttTopic:     "living room/lamp+1",
+			policy:        mapping.SanitizeReplace,
+			expectedTopic: "gom2k.living_room.lamp_1",
+			sanitized:     true,
+		},
+		{
+			name:          "replace multi-byte character once",
+			mqttTopic:     "küche/temp",
+			policy:        mapping.SanitizeReplace,
+			expectedTopic: "gom2k.k_che.temp",
+			sanitized:     true,
+		},
+		{
+			name:          "drop illegal characters",
+			mqttTopic:     "living room/lamp#1",
+			policy:        mapping.SanitizeDrop,
+			expectedTopic: "gom2k.livingroom.lamp1",
+			sanitized:     true,
+		},
+		{
+			name:          "encode illegal characters",
+			mqttTopic:     "living room/lamp+1",
+			policy:        mapping.SanitizeEncode,
+			expectedTopic: "gom2k.living_20room.lamp_2B1",
+			sanitized:     true,
+		},
+		{
+			name:          "encode escapes underscore and dot",
+			mqttTopic:     "a_b/c.d",
+			policy:        mapping.SanitizeEncode,
+			expectedTopic: "gom2k.a_5Fb.c_2Ed",
+			sanitized:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper := mapping.NewTopicMapper(&types.MappingConfig{
+				KafkaPrefix:    "gom2k",
+				MaxTopicLevels: 3,
+				Sanitize:       tt.policy,
+				Replacement:    "_",
+			})
+
+			result := mapper.MapTopic(tt.mqttTopic)
+			if result.KafkaTopic != tt.expectedTopic {
+				t.Errorf("MapTopic(%q) = %q, want %q", tt.mqttTopic, result.KafkaTopic, tt.expectedTopic)
+			}
+			if result.Sanitized != tt.sanitized {
+				t.Errorf("Expected sanitized=%v, got %v", tt.sanitized, result.Sanitized)
+			}
+			if !mapping.IsLegalTopicName(result.KafkaTopic) {
+				t.Errorf("Mapped topic %q contains illegal characters", result.KafkaTopic)
+			}
+		})
+	}
+}
+
+func TestTopicMapperMatchesLevelMapping(t *testing.T) {
+	mapper := mapping.NewTopicMapper(&types.MappingConfig{
+		KafkaPrefix:    "gom2k",
+		MaxTopicLevels: 3,
+		Sanitize:       mapping.SanitizeReplace,
+		Replacement:    "_",
+	})
+
+	for _, topic := range []string{"temp", "sensor/room/temp", "home/floor1/room2/sensor/temp", "/sensor/temp", "sensor/temp/", "///"} {
+		expected := mapMQTTToKafkaTopic(topic, "gom2k", 3)
+		if result := mapper.Map(topic); result != expected {
+			t.Errorf("Map(%q) = %q, want %q", topic, result, expected)
+		}
+	}
+}
+
+func TestTopicSanitizationCollisionWarnings(t *testing.T) {
+	var logOutput bytes.Buffer
+	log.SetOutput(&logOutput)
+	defer log.SetOutput(os.Stderr)
+
+	mapper := mapping.NewTopicMapper(&types.MappingConfig{
+		KafkaPrefix:    "gom2k",
+		MaxTopicLevels: 3,
+		Sanitize:       mapping.SanitizeReplace,
+		Replacement:    "_",
+	})
+
+	// Same MQTT topic twice is not a collision
+	mapper.Map("room 1/temp")
+	mapper.Map("room 1/temp")
+	if logOutput.Len() != 0 {
+		t.Errorf("Expected no warnings for repeated topic, got %q", logOutput.String())
+	}
+
+	// Different MQTT topics that only differ in illegal characters collide
+	mapper.Map("room+1/temp")
+	if !contains(logOutput.String(), "after sanitization") {
+		t.Errorf("Expected sanitization collision warning, got %q", logOutput.String())
+	}
+
+	// Collisions are reported once
+	logOutput.Reset()
+	mapper.Map("room+1/temp")
+	if logOutput.Len() != 0 {
+		t.Errorf("Expected collision to be reported once, got %q", logOutput.String())
+	}
+
+	// Topics that only differ in '.' and '_' clash in Kafka metric names
+	mapper.Map("a_b")
+	mapper.Map("a/b")
+	if !contains(logOutput.String(), "metric names") {
+		t.Errorf("Expected metric name collision warning, got %q", logOutput.String())
+	}
+}
+
+func TestTopicSanitizationConfigValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		mapping   types.MappingConfig
+		expectErr bool
+	}{
+		{"valid policy", types.MappingConfig{KafkaPrefix: "gom2k", Sanitize: "encode", Replacement: "_"}, false},
+		{"unknown policy", types.MappingConfig{KafkaPrefix: "gom2k", Sanitize: "escape", Replacement: "_"}, true},
+		{"illegal replacement", types.MappingConfig{KafkaPrefix: "gom2k", Sanitize: "replace", Replacement: " "}, true},
+		{"illegal prefix", types.MappingConfig{KafkaPrefix: "gom 2k", Sanitize: "replace", Replacement: "_"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &types.Config{}
+			cfg.MQTT.Broker.Host = "localhost"
+			cfg.MQTT.Broker.Port = 1883
+			cfg.Kafka.Brokers = []string{"localhost:9092"}
+			cfg.Bridge.Features.MQTTToKafka = true
+			cfg.Bridge.Mapping = tt.mapping
+
+			err := config.ValidateConfig(cfg, true)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Expected error: %v, got: %v", tt.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package unit
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"gom2k/internal/mapping"
+	"gom2k/pkg/types"
+)
+
+func newTruncationMapper(strategy string) *mapping.TopicMapper {
+	return mapping.NewTopicMapper(&types.MappingConfig{
+		KafkaPrefix:    "gom2k",
+		MaxTopicLevels: 10,
+		Sanitize:       mapping.SanitizeReplace,
+		Replacement:    "_",
+		Truncation:     strategy,
+	})
+}
+
+func TestHashTruncation(t *testing.T) {
+	mapper := newTruncationMapper(mapping.TruncateHash)
+
+	// Two topics that only differ after the 249 character limit
+	base := strings.Repeat("a", 250)
+	first := mapper.MapTopic(base + "/first")
+	second := mapper.MapTopic(base + "/second")
+
+	for _, result := range []mapping.TopicMapping{first, second} {
+		if len(result.KafkaTopic) > mapping.MaxKafkaTopicLength {
+			t.Errorf("Result exceeds %d chars: len=%d", mapping.MaxKafkaTopicLength, len(result.KafkaTopic))
+		}
+		if !result.Truncated {
+			t.Errorf("Expected %q to be marked as truncated", result.KafkaTopic)
+		}
+		if !strings.HasPrefix(result.FullTopic, "gom2k."+base) {
+			t.Errorf("Expected full topic to keep the untruncated name, got %q", result.FullTopic)
+		}
+	}
+
+	if first.KafkaTopic == second.KafkaTopic {
+		t.Errorf("Expected distinct Kafka topics for distinct long names, both got %q", first.KafkaTopic)
+	}
+
+	// The hash suffix must be stable across mappers
+	again := newTruncationMapper(mapping.TruncateHash).Map(base + "/first")
+	if again != first.KafkaTopic {
+		t.Errorf("Expected stable mapping, got %q and %q", first.KafkaTopic, again)
+	}
+}
+
+func TestHashTruncationTrailingDot(t *testing.T) {
+	mapper := newTruncationMapper(mapping.TruncateHash)
+
+	// Level boundary falls exactly where the hash suffix starts
+	topic := strings.Repeat("a", 233) + "/" + strings.Repeat("b", 20)
+	result := mapper.Map(topic)
+
+	if strings.Contains(result, ".-") {
+		t.Errorf("Expected trailing dot to be removed before the hash suffix, got %q", result)
+	}
+}
+
+func TestShortTopicsAreNotHashed(t *testing.T) {
+	mapper := newTruncationMapper(mapping.TruncateHash)
+
+	result := mapper.MapTopic("home/living-room/temperature")
+	if result.KafkaTopic != "gom2k.home.living-room.temperature" || result.Truncated {
+		t.Errorf("Expected short topic to be unchanged, got %+v", result)
+	}
+}
+
+func TestSliceTruncationCollisionWarning(t *testing.T) {
+	var logOutput bytes.Buffer
+	log.SetOutput(&logOutput)
+	defer log.SetOutput(os.Stderr)
+
+	mapper := newTruncationMapper(mapping.TruncateSlice)
+
+	base := strings.Repeat("a", 250)
+	first := mapper.Map(base + "/first")
+	second := mapper.Map(base + "/second")
+
+	if first != second {
+		t.Fatalf("Expected slice truncation to collide, got %q and %q", first, second)
+	}
+	if !contains(logOutput.String(), "after truncation") {
+		t.Errorf("Expected truncation collision warning, got %q", logOutput.String())
+	}
+}
@@ -0,0 +1,115 @@
+package unit
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"gom2k/internal/kafka"
+	"gom2k/pkg/types"
+
+	"github.com/segmentio/kafka-go/compress"
+	"github.com/segmentio/kafka-go/protocol"
+)
+
+func TestEncodeTransactionalRecordBatch(t *testing.T) {
+	messages := []*types.KafkaMessage{
+		{Topic: "gom2k.sensor", Key: "sensor/room1", Value: []byte(`{"payload":"23.5"}`)},
+		{Topic: "gom2k.sensor", Key: "sensor/room1", Value: []byte(`{"payload":"23.6"}`), Headers: []types.KafkaHeader{
+			{Key: kafka.HeaderMQTTTopic, Value: []byte("sensor/room1/temp")},
+		}},
+	}
+
+	for _, compression := range []compress.Compression{compress.None, compress.Gzip, compress.Zstd} {
+		t.Run(compression.String(), func(t *testing.T) {
+			data, err := kafka.EncodeRecordBatch(messages, kafka.RecordBatchHeader{
+				ProducerID:    4711,
+				ProducerEpoch: 3,
+				BaseSequence:  42,
+				Transactional: true,
+				Compression:   compression,
+			}, time.UnixMilli(1704110400000))
+			if err != nil {
+				t.Fatalf("Failed to encode record batch: %v", err)
+			}
+
+			// kafka-go's decoder verifies the size prefix and CRC-32C checksum
+			var recordSet protocol.RecordSet
+			if _, err := recordSet.ReadFrom(bytes.NewReader(data)); err != nil {
+				t.Fatalf("Failed to decode record batch: %v", err)
+			}
+			if recordSet.Version != 2 || !recordSet.Attributes.Transactional() || recordSet.Attributes.Compression() != compression {
+				t.Errorf("Unexpected record set version %d, attributes %v", recordSet.Version, recordSet.Attributes)
+			}
+
+			stream, ok := recordSet.Records.(*protocol.RecordStream)
+			if !ok || len(stream.Records) != 1 {
+				t.Fatalf("Expected a single record batch, got %T", recordSet.Records)
+			}
+			batch, ok := stream.Records[0].(*protocol.RecordBatch)
+			if !ok {
+				t.Fatalf("Expected a record batch, got %T", stream.Records[0])
+			}
+			if batch.ProducerID != 4711 || batch.ProducerEpoch != 3 || batch.BaseSequence != 42 {
+				t.Errorf("Unexpected producer fields: ID %d, epoch %d, sequence %d", batch.ProducerID, batch.ProducerEpoch, batch.BaseSequence)
+			}
+
+			for i, expected := range messages {
+				record, err := batch.ReadRecord()
+				if err != nil {
+					t.Fatalf("Failed to read record %d: %v", i, err)
+				}
+				key, _ := protocol.ReadAll(record.Key)
+				value, _ := protocol.ReadAll(record.Value)
+				if string(key) != expected.Key || !bytes.Equal(value, expected.Value) {
+					t.Errorf("Record %d: got key %q value %q", i, key, value)
+				}
+				if record.Offset != int64(i) || record.Time.UnixMilli() != 1704110400000 {
+					t.Errorf("Record %d: unexpected offset %d or time %v", i, record.Offset, record.Time)
+				}
+				if len(record.Headers) != len(expected.Headers) {
+					t.Fatalf("Record %d: expected %d headers, got %d", i, len(expected.Headers), len(record.Headers))
+				}
+				for j, header := range expected.Headers {
+					if record.Headers[j].Key != header.Key || !bytes.Equal(record.Headers[j].Value, header.Value) {
+						t.Errorf("Record %d: unexpected header %+v", i, record.Headers[j])
+					}
+				}
+			}
+			if _, err := batch.ReadRecord(); err != io.EOF {
+				t.Errorf("Expected end of batch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEncodeEmptyRecordBatch(t *testing.T) {
+	if _, err := kafka.EncodeRecordBatch(nil, kafka.RecordBatchHeader{}, time.Now()); err == nil {
+		t.Error("Expected error for an empty record batch")
+	}
+}
+
+func TestProducerConfigTransactionalID(t *testing.T) {
+	config := &types.KafkaConfig{}
+	config.Producer.TransactionalID = "gom2k-bridge-1"
+
+	// Each producer role gets its own ID, the bridge config stays unchanged
+	ids := map[string]bool{}
+	for _, role := range []string{kafka.ProducerRoleMQTTToKafka, kafka.ProducerRoleDeadLetter, kafka.ProducerRoleReplay} {
+		id := kafka.ProducerConfig(config, role).Producer.TransactionalID
+		if id != "gom2k-bridge-1-"+role || ids[id] {
+			t.Errorf("Unexpected transactional ID %q for role %s", id, role)
+		}
+		ids[id] = true
+	}
+	if config.Producer.TransactionalID != "gom2k-bridge-1" {
+		t.Errorf("Expected the bridge config to stay unchanged, got %q", config.Producer.TransactionalID)
+	}
+
+	// Non-transactional producers get no ID
+	config.Producer.TransactionalID = ""
+	if id := kafka.ProducerConfig(config, kafka.ProducerRoleDeadLetter).Producer.TransactionalID; id != "" {
+		t.Errorf("Expected no transactional ID, got %q", id)
+	}
+}